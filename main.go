@@ -2,7 +2,6 @@
 package main
 
 import (
-	"context"
 	goflag "flag"
 
 	"k8s.io/cloud-provider/names"
@@ -31,24 +30,25 @@ func main() {
 
 	controllerAliases := names.CCMControllerAliases()
 
+	fss := flag.NamedFlagSets{}
+	vultrFlags := fss.FlagSet("vultr")
+	vultrFlags.StringVar(&vultr.Options.ClusterID, "vultr-cluster-id", "", "Identifies the cluster that owns the Vultr resources managed by the CCM. Overrides clusterID from the cloud config.")
+	vultrFlags.StringVar(&vultr.Options.Region, "vultr-region", "", "Region of the cluster. Overrides region from the cloud config, the metadata service is used when neither is set.")
+	vultrFlags.StringVar(&vultr.Options.VPCID, "vultr-vpc-id", "", "VPC attached to load balancers which request one. Overrides vpcID from the cloud config, the metadata service is used when neither is set.")
+
 	command := app.NewCloudControllerManagerCommand(
 		ccmOptions,
 		cloudInitializer,
 		app.DefaultInitFuncConstructors,
 		controllerAliases,
-		flag.NamedFlagSets{},
+		fss,
 		wait.NeverStop)
 
-	vultr.Options.KubeconfigFlag = command.Flags().Lookup("kubeconfig")
-
 	pflag.CommandLine.SetNormalizeFunc(flag.WordSepNormalizeFunc)
 	pflag.CommandLine.AddGoFlagSet(goflag.CommandLine)
 
 	defer logs.FlushLogs()
 
-	vultr.SetupSecretWatcher(context.Background())
-	go vultr.SecretWatcher.WatchSecrets()
-
 	if err := command.Execute(); err != nil {
 		klog.Fatal(err)
 	}
@@ -0,0 +1,505 @@
+package vultr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// eventReasonInvalidAnnotation is recorded on a service for each annotation which stops its load balancer
+	// from being reconciled
+	eventReasonInvalidAnnotation = "InvalidAnnotation"
+	// eventReasonAnnotationWarning is recorded on a service for each annotation which is ignored or has no effect
+	eventReasonAnnotationWarning = "AnnotationWarning"
+
+	algorithmRoundRobin       = "roundrobin"
+	algorithmLeastConnections = "leastconn"
+
+	stickySessionOn  = "on"
+	stickySessionOff = "off"
+)
+
+// knownLBAnnotations are all annotations with the load balancer prefix understood by the CCM
+var knownLBAnnotations = map[string]bool{
+	annoVultrLoadBalancerLabel:             true,
+	annoVultrLoadBalancerID:                true,
+	annoVultrLoadBalancerCreate:            true,
+	annoVultrLBProtocol:                    true,
+	annoVultrLBHTTPSPorts:                  true,
+	annoVultrLBSSLPassthrough:              true,
+	annoVultrLBSSL:                         true,
+	annoVultrLBAutoSSL:                     true,
+	annoVultrLBBackendProtocol:             true,
+	annoVultrHostname:                      true,
+	annoVultrHealthCheckPath:               true,
+	annoVultrHealthCheckProtocol:           true,
+	annoVultrHealthCheckPort:               true,
+	annoVultrHealthCheckInterval:           true,
+	annoVultrHealthCheckResponseTimeout:    true,
+	annoVultrHealthCheckUnhealthyThreshold: true,
+	annoVultrHealthCheckHealthyThreshold:   true,
+	annoVultrAlgorithm:                     true,
+	annoVultrSSLRedirect:                   true,
+	annoVultrProxyProtocol:                 true,
+	annoVultrLBHTTP2:                       true,
+	annoVultrLBHTTP3:                       true,
+	annoVultrLBTimeout:                     true,
+	annoVultrStickySessionEnabled:          true,
+	annoVultrStickySessionCookieName:       true,
+	annoVultrFirewallRules:                 true,
+	annoVultrFirewallRulesCM:               true,
+	annoVultrPrivateNetwork:                true,
+	annoVultrVPC:                           true,
+	annoVultrNodeCount:                     true,
+	annoVultrLBSSLLastUpdatedTime:          true,
+	annoVultrLBEndpointNodesOnly:           true,
+	annoVultrLBEndpointsLastUpdatedTime:    true,
+	annoVultrLBNodeSelector:                true,
+	annoVultrLBAllowEmptyBackends:          true,
+	annoVultrLBNodesLastUpdatedTime:        true,
+}
+
+// lbAnnotations are the parsed load balancer annotations of a service. Annotations which need the kube API,
+// such as SSL secrets and firewall rule ConfigMaps, are resolved when the load balancer request is built.
+type lbAnnotations struct {
+	create          bool
+	hostname        string
+	forwardingRules []govultr.ForwardingRule
+	healthCheck     govultr.HealthCheck
+	// stickySessionCookie is empty when sticky sessions are off
+	stickySessionCookie string
+	algorithm           string
+	sslRedirect         bool
+	proxyProtocol       bool
+	http2               bool
+	http3               bool
+	timeout             int
+	nodeCount           int
+	// endpointNodesOnly attaches only nodes hosting ready endpoints
+	endpointNodesOnly bool
+	// nodeSelector is nil when all nodes are attached
+	nodeSelector       labels.Selector
+	allowEmptyBackends bool
+}
+
+// annotationProblems are the problems found while parsing the annotations of a service. Errors stop the load
+// balancer from being reconciled, warnings point out annotations which are ignored or have no effect.
+type annotationProblems struct {
+	errors   []string
+	warnings []string
+}
+
+func (p *annotationProblems) errorf(format string, args ...interface{}) {
+	p.errors = append(p.errors, fmt.Sprintf(format, args...))
+}
+
+func (p *annotationProblems) warnf(format string, args ...interface{}) {
+	p.warnings = append(p.warnings, fmt.Sprintf(format, args...))
+}
+
+// err returns all errors as one, nil if there are none
+func (p *annotationProblems) err() error {
+	if len(p.errors) == 0 {
+		return nil
+	}
+	return fmt.Errorf("invalid load balancer annotations: %s", strings.Join(p.errors, "; "))
+}
+
+// record reports every problem as an event on the service
+func (p *annotationProblems) record(recorder record.EventRecorder, service *v1.Service) {
+	for _, warning := range p.warnings {
+		klog.Warningf("service %s/%s: %s", service.Namespace, service.Name, warning)
+		if recorder != nil {
+			recorder.Event(service, v1.EventTypeWarning, eventReasonAnnotationWarning, warning)
+		}
+	}
+	for _, message := range p.errors {
+		if recorder != nil {
+			recorder.Event(service, v1.EventTypeWarning, eventReasonInvalidAnnotation, message)
+		}
+	}
+}
+
+// annotationParser reads typed values from the annotations of a service and collects the problems of each
+type annotationParser struct {
+	annotations map[string]string
+	problems    *annotationProblems
+}
+
+func (p *annotationParser) string(key string) (string, bool) {
+	value, ok := p.annotations[key]
+	return strings.TrimSpace(value), ok
+}
+
+func (p *annotationParser) bool(key string, def bool) bool {
+	value, ok := p.string(key)
+	if !ok {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		p.problems.errorf("%s: %q is not a boolean", key, value)
+		return def
+	}
+	return b
+}
+
+// int returns the value of an annotation which has to be at least minimum
+func (p *annotationParser) int(key string, def, minimum int) int {
+	value, ok := p.string(key)
+	if !ok {
+		return def
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		p.problems.errorf("%s: %q is not an integer", key, value)
+		return def
+	}
+	if i < minimum {
+		p.problems.errorf("%s: %d must be at least %d", key, i, minimum)
+		return def
+	}
+	return i
+}
+
+// oneOf returns the lowercased value of an annotation which has to be one of the values
+func (p *annotationParser) oneOf(key, def string, values ...string) string {
+	value, ok := p.string(key)
+	if !ok {
+		return def
+	}
+	value = strings.ToLower(value)
+	for _, v := range values {
+		if value == v {
+			return value
+		}
+	}
+	p.problems.errorf("%s: %q is not supported, supported values are [%s]", key, value, strings.Join(values, " "))
+	return def
+}
+
+// ports returns the comma separated ports of an annotation
+func (p *annotationParser) ports(key string) map[int32]bool {
+	value, ok := p.string(key)
+	if !ok {
+		return nil
+	}
+	ports := map[int32]bool{}
+	for _, port := range strings.Split(value, ",") {
+		i, err := strconv.ParseInt(strings.TrimSpace(port), 10, 32)
+		if err != nil || i < 1 || i > 65535 {
+			p.problems.errorf("%s: %q is not a valid port", key, port)
+			continue
+		}
+		ports[int32(i)] = true
+	}
+	return ports
+}
+
+// parseLBAnnotations parses the load balancer annotations of a service, the defaults are used for annotations
+// which are not set or invalid
+func parseLBAnnotations(service *v1.Service) (*lbAnnotations, *annotationProblems) {
+	problems := &annotationProblems{}
+	p := &annotationParser{annotations: service.Annotations, problems: problems}
+	a := &lbAnnotations{}
+
+	checkUnknownAnnotations(service.Annotations, problems)
+
+	a.create = p.bool(annoVultrLoadBalancerCreate, true)
+
+	if hostname, ok := p.string(annoVultrHostname); ok && hostname != "" && !govalidator.IsDNSName(hostname) {
+		problems.errorf("%s: %q is not a valid DNS name", annoVultrHostname, hostname)
+	} else {
+		a.hostname = hostname
+	}
+
+	a.forwardingRules = parseForwardingRules(service, p)
+	a.healthCheck = parseHealthCheck(service, p)
+
+	switch p.oneOf(annoVultrStickySessionEnabled, stickySessionOff, stickySessionOn, stickySessionOff) {
+	case stickySessionOn:
+		cookie, _ := p.string(annoVultrStickySessionCookieName)
+		if cookie == "" {
+			problems.errorf("%s: must be set when sticky sessions are enabled", annoVultrStickySessionCookieName)
+		}
+		a.stickySessionCookie = cookie
+	default:
+		if _, ok := p.string(annoVultrStickySessionCookieName); ok {
+			problems.warnf("%s: ignored, sticky sessions are not enabled with %s", annoVultrStickySessionCookieName, annoVultrStickySessionEnabled)
+		}
+	}
+
+	// round_robin is accepted as an alias of roundrobin
+	switch p.oneOf(annoVultrAlgorithm, algorithmRoundRobin, algorithmRoundRobin, "round_robin", "least_connections") {
+	case "least_connections":
+		a.algorithm = algorithmLeastConnections
+	default:
+		a.algorithm = algorithmRoundRobin
+	}
+
+	a.sslRedirect = p.bool(annoVultrSSLRedirect, false)
+	a.proxyProtocol = p.bool(annoVultrProxyProtocol, false)
+	a.http2 = p.bool(annoVultrLBHTTP2, false)
+	a.http3 = p.bool(annoVultrLBHTTP3, false)
+	a.timeout = p.int(annoVultrLBTimeout, defaultLBTimeout, 1)
+
+	a.nodeCount = p.int(annoVultrNodeCount, 1, 1)
+	if a.nodeCount&1 == 0 {
+		problems.errorf("%s: %d must be odd", annoVultrNodeCount, a.nodeCount)
+	}
+
+	_, privateNetwork := p.string(annoVultrPrivateNetwork)
+	_, vpc := p.string(annoVultrVPC)
+	switch {
+	case privateNetwork && vpc:
+		problems.errorf("%s and %s can not be used together, %s is deprecated", annoVultrPrivateNetwork, annoVultrVPC, annoVultrPrivateNetwork)
+	case privateNetwork:
+		problems.warnf("%s: deprecated, use %s instead", annoVultrPrivateNetwork, annoVultrVPC)
+		p.bool(annoVultrPrivateNetwork, false)
+	case vpc:
+		p.bool(annoVultrVPC, false)
+	}
+
+	a.endpointNodesOnly = p.bool(annoVultrLBEndpointNodesOnly, false)
+	if a.endpointNodesOnly && !usesLocalTrafficPolicy(service) {
+		problems.warnf("%s: has no effect without externalTrafficPolicy Local", annoVultrLBEndpointNodesOnly)
+		a.endpointNodesOnly = false
+	}
+	if a.endpointNodesOnly && hasSharedLoadBalancerLabel(service) {
+		problems.warnf("%s: has no effect on load balancers shared with %s", annoVultrLBEndpointNodesOnly, annoVultrLoadBalancerLabel)
+		a.endpointNodesOnly = false
+	}
+
+	if selector, ok := p.string(annoVultrLBNodeSelector); ok {
+		nodeSelector, err := labels.Parse(selector)
+		if err != nil {
+			problems.errorf("%s: %q is not a valid label selector: %v", annoVultrLBNodeSelector, selector, err)
+		} else {
+			a.nodeSelector = nodeSelector
+		}
+	}
+	a.allowEmptyBackends = p.bool(annoVultrLBAllowEmptyBackends, false)
+
+	checkHTTPSOnlyAnnotations(a, p)
+
+	return a, problems
+}
+
+// parseForwardingRules builds a forwarding rule for each port of the service
+func parseForwardingRules(service *v1.Service, p *annotationParser) []govultr.ForwardingRule {
+	protocols := []string{protocolTCP, protocolUDP, protocolHTTP, protocolHTTPS}
+	defaultProtocol := p.oneOf(annoVultrLBProtocol, protocolTCP, protocols...)
+	backendProtocol := p.oneOf(annoVultrLBBackendProtocol, "", protocols...)
+	httpsPorts := p.ports(annoVultrLBHTTPSPorts)
+	sslPassthrough := p.bool(annoVultrLBSSLPassthrough, false)
+
+	if sslPassthrough && len(httpsPorts) == 0 {
+		p.problems.warnf("%s: has no effect without %s", annoVultrLBSSLPassthrough, annoVultrLBHTTPSPorts)
+	}
+
+	servicePorts := make(map[int32]bool, len(service.Spec.Ports))
+	rules := make([]govultr.ForwardingRule, 0, len(service.Spec.Ports))
+	for _, port := range service.Spec.Ports {
+		servicePorts[port.Port] = true
+
+		frontend := defaultProtocol
+		if httpsPorts[port.Port] {
+			if sslPassthrough {
+				frontend = protocolTCP
+			} else {
+				frontend = protocolHTTPS
+			}
+		}
+
+		backend := backendProtocol
+		if backend != "" && !backendSupported(frontend, backend) {
+			p.problems.warnf("%s: %s is not supported behind %s port %d, using %s", annoVultrLBBackendProtocol,
+				backend, frontend, port.Port, frontend)
+			backend = ""
+		}
+		// unset backend should be same as frontend
+		if backend == "" {
+			backend = frontend
+		}
+
+		rules = append(rules, govultr.ForwardingRule{
+			FrontendProtocol: frontend,
+			FrontendPort:     int(port.Port),
+			BackendProtocol:  backend,
+			BackendPort:      int(port.NodePort),
+		})
+	}
+
+	for _, port := range sortedPorts(httpsPorts) {
+		if !servicePorts[port] {
+			p.problems.warnf("%s: port %d is not a port of the service", annoVultrLBHTTPSPorts, port)
+		}
+	}
+
+	return rules
+}
+
+// backendSupported returns whether the load balancer can forward traffic received with the frontend protocol
+// to the backend protocol
+func backendSupported(frontend, backend string) bool {
+	switch frontend {
+	case protocolHTTP, protocolHTTPS:
+		return backend == protocolHTTP || backend == protocolHTTPS
+	}
+	return backend == frontend
+}
+
+// parseHealthCheck builds the health check, the first NodePort is checked unless a service port is annotated.
+// Services with externalTrafficPolicy Local check the kube-proxy health check NodePort unless annotated otherwise.
+func parseHealthCheck(service *v1.Service, p *annotationParser) govultr.HealthCheck {
+	path, hasPath := p.string(annoVultrHealthCheckPath)
+	_, hasProtocol := p.string(annoVultrHealthCheckProtocol)
+	_, hasPort := p.string(annoVultrHealthCheckPort)
+
+	if usesLocalTrafficPolicy(service) && service.Spec.HealthCheckNodePort != 0 {
+		if !hasPath && !hasProtocol && !hasPort {
+			return govultr.HealthCheck{
+				Protocol:           protocolHTTP,
+				Port:               int(service.Spec.HealthCheckNodePort),
+				Path:               kubeProxyHealthCheckPath,
+				CheckInterval:      p.int(annoVultrHealthCheckInterval, healthCheckInterval, 1),
+				ResponseTimeout:    p.int(annoVultrHealthCheckResponseTimeout, healthCheckResponse, 1),
+				UnhealthyThreshold: p.int(annoVultrHealthCheckUnhealthyThreshold, healthCheckUnhealthy, 1),
+				HealthyThreshold:   p.int(annoVultrHealthCheckHealthyThreshold, healthCheckHealthy, 1),
+			}
+		}
+		p.problems.warnf("health check annotations replace the kube-proxy health check NodePort %d, nodes without ready endpoints may receive traffic",
+			service.Spec.HealthCheckNodePort)
+	}
+
+	defaultProtocol := protocolTCP
+	if path != "" {
+		defaultProtocol = protocolHTTP
+	}
+	protocol := p.oneOf(annoVultrHealthCheckProtocol, defaultProtocol, protocolHTTP, protocolTCP, protocolUDP)
+	if hasPath && protocol != protocolHTTP {
+		p.problems.warnf("%s: has no effect with %s health checks", annoVultrHealthCheckPath, protocol)
+	}
+
+	var port int
+	if len(service.Spec.Ports) > 0 {
+		port = int(service.Spec.Ports[0].NodePort)
+	}
+	if _, ok := p.string(annoVultrHealthCheckPort); ok {
+		annotated := p.int(annoVultrHealthCheckPort, 0, 1)
+		if annotated != 0 {
+			found := false
+			for _, servicePort := range service.Spec.Ports {
+				found = found || int(servicePort.Port) == annotated
+			}
+			if found {
+				port = annotated
+			} else {
+				p.problems.errorf("%s: port %d is not a port of the service", annoVultrHealthCheckPort, annotated)
+			}
+		}
+	}
+
+	return govultr.HealthCheck{
+		Protocol:           protocol,
+		Port:               port,
+		Path:               path,
+		CheckInterval:      p.int(annoVultrHealthCheckInterval, healthCheckInterval, 1),
+		ResponseTimeout:    p.int(annoVultrHealthCheckResponseTimeout, healthCheckResponse, 1),
+		UnhealthyThreshold: p.int(annoVultrHealthCheckUnhealthyThreshold, healthCheckUnhealthy, 1),
+		HealthyThreshold:   p.int(annoVultrHealthCheckHealthyThreshold, healthCheckHealthy, 1),
+	}
+}
+
+// checkHTTPSOnlyAnnotations reports annotations which need a forwarding rule terminating HTTPS
+func checkHTTPSOnlyAnnotations(a *lbAnnotations, p *annotationParser) {
+	for _, rule := range a.forwardingRules {
+		if rule.FrontendProtocol == protocolHTTPS {
+			return
+		}
+	}
+
+	if a.http3 {
+		p.problems.errorf("%s: requires an HTTPS forwarding rule, set %s or %s", annoVultrLBHTTP3, annoVultrLBProtocol, annoVultrLBHTTPSPorts)
+	}
+	if a.http2 {
+		p.problems.warnf("%s: has no effect without an HTTPS forwarding rule", annoVultrLBHTTP2)
+	}
+	if a.sslRedirect {
+		p.problems.warnf("%s: has no effect without an HTTPS forwarding rule", annoVultrSSLRedirect)
+	}
+}
+
+// checkUnknownAnnotations warns about annotations with the load balancer prefix which are not known, most
+// likely typos, and suggests the closest known annotation
+func checkUnknownAnnotations(annotations map[string]string, problems *annotationProblems) {
+	keys := make([]string, 0, len(annotations))
+	for key := range annotations {
+		if strings.HasPrefix(key, annoVultrLoadBalancerPrefix) && !knownLBAnnotations[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if suggestion := closestLBAnnotation(key); suggestion != "" {
+			problems.warnf("%s: unknown annotation, did you mean %s?", key, suggestion)
+		} else {
+			problems.warnf("%s: unknown annotation", key)
+		}
+	}
+}
+
+// closestLBAnnotation returns the known annotation within a few edits of the key, empty if there is none
+func closestLBAnnotation(key string) string {
+	const maxDistance = 3
+
+	suffix := strings.TrimPrefix(key, annoVultrLoadBalancerPrefix)
+	best, bestDistance := "", maxDistance+1
+	for known := range knownLBAnnotations {
+		distance := editDistance(suffix, strings.TrimPrefix(known, annoVultrLoadBalancerPrefix))
+		if distance < bestDistance || (distance == bestDistance && known < best) {
+			best, bestDistance = known, distance
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance of a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func sortedPorts(ports map[int32]bool) []int32 {
+	sorted := make([]int32, 0, len(ports))
+	for port := range ports {
+		sorted = append(sorted, port)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
@@ -0,0 +1,183 @@
+package vultr
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestParseLBAnnotations(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		errors      []string
+		warnings    []string
+	}{
+		{
+			name: "valid",
+			annotations: map[string]string{
+				annoVultrLBProtocol:   "http",
+				annoVultrLBHTTPSPorts: "443",
+				annoVultrLBHTTP3:      "true",
+				annoVultrAlgorithm:    "least_connections",
+			},
+		},
+		{
+			name: "invalid values",
+			annotations: map[string]string{
+				annoVultrProxyProtocol:        "yes",
+				annoVultrLBBackendProtocol:    "grpc",
+				annoVultrLBTimeout:            "0",
+				annoVultrNodeCount:            "2",
+				annoVultrStickySessionEnabled: "on",
+			},
+			errors: []string{
+				annoVultrLBBackendProtocol + `: "grpc" is not supported`,
+				annoVultrProxyProtocol + `: "yes" is not a boolean`,
+				annoVultrLBTimeout + ": 0 must be at least 1",
+				annoVultrNodeCount + ": 2 must be odd",
+				annoVultrStickySessionCookieName + ": must be set",
+			},
+		},
+		{
+			name: "unknown annotation",
+			annotations: map[string]string{
+				"service.beta.kubernetes.io/vultr-loadbalancer-proxy-protocl": "true",
+				"service.beta.kubernetes.io/vultr-loadbalancer-something":     "true",
+			},
+			warnings: []string{
+				"vultr-loadbalancer-proxy-protocl: unknown annotation, did you mean " + annoVultrProxyProtocol,
+				"vultr-loadbalancer-something: unknown annotation",
+			},
+		},
+		{
+			name: "http3 without https",
+			annotations: map[string]string{
+				annoVultrLBHTTP3:     "true",
+				annoVultrSSLRedirect: "true",
+			},
+			errors:   []string{annoVultrLBHTTP3 + ": requires an HTTPS forwarding rule"},
+			warnings: []string{annoVultrSSLRedirect + ": has no effect"},
+		},
+		{
+			name: "unsupported backend",
+			annotations: map[string]string{
+				annoVultrLBProtocol:        "tcp",
+				annoVultrLBBackendProtocol: "http",
+			},
+			warnings: []string{
+				annoVultrLBBackendProtocol + ": http is not supported behind tcp port 80, using tcp",
+				annoVultrLBBackendProtocol + ": http is not supported behind tcp port 443, using tcp",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := &v1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "lb-name", Annotations: test.annotations},
+				Spec: v1.ServiceSpec{
+					Ports: []v1.ServicePort{{Port: 80, NodePort: 30080}, {Port: 443, NodePort: 30443}},
+				},
+			}
+
+			_, problems := parseLBAnnotations(svc)
+			assertProblems(t, "errors", test.errors, problems.errors)
+			assertProblems(t, "warnings", test.warnings, problems.warnings)
+		})
+	}
+}
+
+func assertProblems(t *testing.T, kind string, expected, actual []string) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Fatalf("expcted %d %s got %+v", len(expected), kind, actual)
+	}
+	for _, want := range expected {
+		found := false
+		for _, got := range actual {
+			found = found || strings.Contains(got, want)
+		}
+		if !found {
+			t.Errorf("expcted %s to contain %q got %+v", kind, want, actual)
+		}
+	}
+}
+
+func TestParseLBAnnotations_ForwardingRules(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "lb-name",
+			Annotations: map[string]string{
+				annoVultrLBProtocol:        "HTTP",
+				annoVultrLBHTTPSPorts:      "443",
+				annoVultrLBBackendProtocol: "http",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Port: 80, NodePort: 30080}, {Port: 443, NodePort: 30443}},
+		},
+	}
+
+	annotations, problems := parseLBAnnotations(svc)
+	if err := problems.err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []govultr.ForwardingRule{
+		{FrontendProtocol: protocolHTTP, FrontendPort: 80, BackendProtocol: protocolHTTP, BackendPort: 30080},
+		{FrontendProtocol: protocolHTTPS, FrontendPort: 443, BackendProtocol: protocolHTTP, BackendPort: 30443},
+	}
+	if !reflect.DeepEqual(annotations.forwardingRules, expected) {
+		t.Errorf("expcted %+v got %+v", expected, annotations.forwardingRules)
+	}
+}
+
+func TestLoadbalancers_EnsureLoadBalancer_InvalidAnnotations(t *testing.T) {
+	client := newFakeClient()
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{}).(*loadbalancers)
+	recorder := record.NewFakeRecorder(10)
+	lb.setEventRecorder(recorder)
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lb-name",
+			Namespace: v1.NamespaceDefault,
+			UID:       "lb-name",
+			Annotations: map[string]string{
+				annoVultrLBHTTP2: "maybe",
+				annoVultrLBHTTP3: "true",
+				"service.beta.kubernetes.io/vultr-loadbalancer-timout": "60",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Port: 80, NodePort: 30080}},
+		},
+	}
+	setFakeKubeClient(t, lb, svc)
+
+	_, err := lb.EnsureLoadBalancer(context.Background(), "cluster-name", svc, nil)
+	if err == nil {
+		t.Fatal("expected error got nil")
+	}
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+	expected := []string{
+		"Warning " + eventReasonAnnotationWarning + " service.beta.kubernetes.io/vultr-loadbalancer-timout: unknown annotation, did you mean " + annoVultrLBTimeout + "?",
+		"Warning " + eventReasonInvalidAnnotation + " " + annoVultrLBHTTP2 + `: "maybe" is not a boolean`,
+		"Warning " + eventReasonInvalidAnnotation + " " + annoVultrLBHTTP3 + ": requires an HTTPS forwarding rule, set " + annoVultrLBProtocol + " or " + annoVultrLBHTTPSPorts,
+	}
+	if !reflect.DeepEqual(events, expected) {
+		t.Errorf("expcted %+v got %+v", expected, events)
+	}
+}
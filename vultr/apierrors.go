@@ -0,0 +1,151 @@
+package vultr
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// apiErrorClass is the kind of failure reported by the Vultr API
+type apiErrorClass int
+
+const (
+	apiErrorUnknown apiErrorClass = iota
+	apiErrorNotFound
+	apiErrorConflict
+	apiErrorRateLimited
+	apiErrorActivating
+	apiErrorInvalidID
+)
+
+func (c apiErrorClass) String() string {
+	switch c {
+	case apiErrorNotFound:
+		return "not found"
+	case apiErrorConflict:
+		return "conflict"
+	case apiErrorRateLimited:
+		return "rate limited"
+	case apiErrorActivating:
+		return "activating"
+	case apiErrorInvalidID:
+		return "invalid ID"
+	default:
+		return "unknown"
+	}
+}
+
+// invalidIDRegex matches the messages returned for malformed IDs such as "invalid instance ID" or "Invalid server"
+var invalidIDRegex = regexp.MustCompile(`(?i)\binvalid (\w+ )*(id|server)\b`)
+
+// apiError is an error returned by the Vultr API with its status code and message
+type apiError struct {
+	StatusCode int
+	Message    string
+	Class      apiErrorClass
+
+	err error
+}
+
+func (e *apiError) Error() string {
+	return e.err.Error()
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+// apiErrorBody is the body of an error response from the Vultr API
+type apiErrorBody struct {
+	Error  string `json:"error"`
+	Status int    `json:"status"`
+}
+
+// newAPIError classifies an error returned by govultr. The status code is taken from the response when
+// there is one, otherwise from the error body. Returns nil if err is nil.
+func newAPIError(resp *http.Response, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var existing *apiError
+	if errors.As(err, &existing) {
+		return err
+	}
+
+	apiErr := &apiError{err: err}
+
+	body := parseAPIErrorBody(err.Error())
+	apiErr.Message = body.Error
+	apiErr.StatusCode = body.Status
+	if resp != nil {
+		apiErr.StatusCode = resp.StatusCode
+	}
+
+	apiErr.Class = classifyAPIError(apiErr.StatusCode, apiErr.Message)
+	return apiErr
+}
+
+// parseAPIErrorBody extracts the JSON error body from a govultr error. Requests which exhausted the
+// retries of govultr carry the body as a quoted string after "last error: ".
+func parseAPIErrorBody(msg string) apiErrorBody {
+	if _, after, ok := strings.Cut(msg, "last error: "); ok {
+		if unquoted, err := strconv.Unquote(after); err == nil {
+			msg = unquoted
+		}
+	}
+
+	var body apiErrorBody
+	start, end := strings.Index(msg, "{"), strings.LastIndex(msg, "}")
+	if start < 0 || end < start || json.Unmarshal([]byte(msg[start:end+1]), &body) != nil {
+		return apiErrorBody{Error: msg}
+	}
+
+	return body
+}
+
+// classifyAPIError classifies an error by its status code. The message is only matched for statuses which
+// the API uses for several kinds of failure, such as 400 for malformed IDs and load balancers which are
+// still activating, or when no status is known.
+func classifyAPIError(status int, message string) apiErrorClass {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return apiErrorRateLimited
+	case status == http.StatusNotFound:
+		return apiErrorNotFound
+	case status == http.StatusConflict:
+		return apiErrorConflict
+	case status != 0 && status != http.StatusBadRequest:
+		return apiErrorUnknown
+	case strings.Contains(strings.ToLower(message), "activating"):
+		return apiErrorActivating
+	case invalidIDRegex.MatchString(message):
+		return apiErrorInvalidID
+	}
+
+	return apiErrorUnknown
+}
+
+// apiErrorClassOf returns the class of an error returned by govultr
+func apiErrorClassOf(err error) apiErrorClass {
+	if err == nil {
+		return apiErrorUnknown
+	}
+
+	var apiErr *apiError
+	if !errors.As(newAPIError(nil, err), &apiErr) {
+		return apiErrorUnknown
+	}
+
+	return apiErr.Class
+}
+
+// isAPINotFound returns whether the API reported that the resource does not exist, either because it
+// was not found or because the ID can not belong to any resource
+func isAPINotFound(err error) bool {
+	class := apiErrorClassOf(err)
+	return class == apiErrorNotFound || class == apiErrorInvalidID
+}
@@ -0,0 +1,110 @@
+package vultr
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestNewAPIError(t *testing.T) {
+	tests := []struct {
+		name       string
+		resp       *http.Response
+		err        error
+		wantStatus int
+		wantClass  apiErrorClass
+	}{
+		{
+			name:       "not found body",
+			err:        errors.New(`{"error":"instance not found","status":404}`),
+			wantStatus: http.StatusNotFound,
+			wantClass:  apiErrorNotFound,
+		},
+		{
+			name:       "status from response",
+			resp:       &http.Response{StatusCode: http.StatusConflict},
+			err:        errors.New(`{"error":"resource is locked"}`),
+			wantStatus: http.StatusConflict,
+			wantClass:  apiErrorConflict,
+		},
+		{
+			name:       "retries exhausted",
+			err:        errors.New(`gave up after 1 attempts, last error: "{\"error\":\"rate limit exceeded\",\"status\":429}"`),
+			wantStatus: http.StatusTooManyRequests,
+			wantClass:  apiErrorRateLimited,
+		},
+		{
+			name:       "invalid instance ID",
+			err:        errors.New(`{"error":"invalid instance ID","status":400}`),
+			wantStatus: http.StatusBadRequest,
+			wantClass:  apiErrorInvalidID,
+		},
+		{
+			name:       "invalid server",
+			err:        errors.New(`{"error":"Invalid server.","status":400}`),
+			wantStatus: http.StatusBadRequest,
+			wantClass:  apiErrorInvalidID,
+		},
+		{
+			name:       "activating",
+			err:        errors.New(`{"error":"Load balancer is still activating","status":400}`),
+			wantStatus: http.StatusBadRequest,
+			wantClass:  apiErrorActivating,
+		},
+		{
+			name:       "not found with an ID in the message",
+			err:        errors.New(`{"error":"invalid instance ID or instance not found","status":404}`),
+			wantStatus: http.StatusNotFound,
+			wantClass:  apiErrorNotFound,
+		},
+		{
+			name:       "server error mentioning activating",
+			err:        errors.New(`{"error":"failed while activating","status":500}`),
+			wantStatus: http.StatusInternalServerError,
+			wantClass:  apiErrorUnknown,
+		},
+		{
+			name:       "unauthorized mentioning an invalid server",
+			err:        errors.New(`{"error":"Invalid API key or invalid server access","status":401}`),
+			wantStatus: http.StatusUnauthorized,
+			wantClass:  apiErrorUnknown,
+		},
+		{
+			name:      "network error",
+			err:       errors.New("dial tcp: connection refused"),
+			wantClass: apiErrorUnknown,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := newAPIError(test.resp, test.err)
+
+			var apiErr *apiError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("expected *apiError got %T", err)
+			}
+			if apiErr.StatusCode != test.wantStatus {
+				t.Errorf("expcted status %d got %d", test.wantStatus, apiErr.StatusCode)
+			}
+			if apiErr.Class != test.wantClass {
+				t.Errorf("expcted class %s got %s", test.wantClass, apiErr.Class)
+			}
+			if !errors.Is(err, test.err) {
+				t.Errorf("expected %v to wrap %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestIsAPINotFound(t *testing.T) {
+	if !isAPINotFound(errors.New(`{"error":"invalid baremetal ID","status":400}`)) {
+		t.Error("expected invalid ID to be not found")
+	}
+	if isAPINotFound(errors.New(`{"error":"internal error","status":500}`)) {
+		t.Error("expected server error not to be not found")
+	}
+	if isAPINotFound(nil) {
+		t.Error("expected nil not to be not found")
+	}
+}
@@ -2,16 +2,22 @@
 package vultr
 
 import (
-	"context"
 	"fmt"
 	"io"
+	"net/http"
 	"os"
-	"strings"
+	"time"
 
-	"github.com/spf13/pflag"
+	"github.com/asaskevich/govalidator"
 	"github.com/vultr/govultr/v3"
-	"github.com/vultr/metadata"
 	"golang.org/x/oauth2"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 )
@@ -22,46 +28,117 @@ const (
 	accessTokenEnv = "VULTR_API_KEY" //nolint:gosec
 	userAgent      = "CCM_USER_AGENT"
 	apiURL         = "API_URL"
+
+	// kubeClientName is the user agent of the shared kube client
+	kubeClientName = "vultr-cloud-controller-manager"
+
+	informerResyncPeriod = 10 * time.Minute
 )
 
-// Options currently stores the Kubeconfig that was passed in.
+// Options stores the vultr specific flags that were passed in.
 // We can use this to extend any other flags that may have been passed in that we require
 var Options struct {
-	KubeconfigFlag *pflag.Flag
+	ClusterID string
+	Region    string
+	VPCID     string
 }
 
 type cloud struct {
 	client        *govultr.Client
+	config        *CloudConfig
 	instances     cloudprovider.InstancesV2
 	zones         cloudprovider.Zones
 	loadbalancers cloudprovider.LoadBalancer
+	inventory     *inventory
+	// tokenSource is set when the API key is read from a file
+	tokenSource *fileTokenSource
+
+	kubeClient      kubernetes.Interface
+	informerFactory informers.SharedInformerFactory
+	eventRecorder   record.EventRecorder
 }
 
 //nolint:gochecknoinits
 func init() {
-	cloudprovider.RegisterCloudProvider(ProviderName, func(_ io.Reader) (i cloudprovider.Interface, err error) {
-		return newCloud()
+	cloudprovider.RegisterCloudProvider(ProviderName, func(config io.Reader) (i cloudprovider.Interface, err error) {
+		return newCloud(config)
 	})
 }
 
-func newCloud() (cloudprovider.Interface, error) {
-	apiToken := os.Getenv(accessTokenEnv)
-	if apiToken == "" {
-		return nil, fmt.Errorf("%s must be set in the environment (use a k8s secret)", accessTokenEnv)
+func newCloud(config io.Reader) (cloudprovider.Interface, error) {
+	cfg, err := readCloudConfig(config)
+	if err != nil {
+		return nil, err
 	}
 
-	mClient := metadata.NewClient()
-	meta, err := mClient.Metadata()
-	if err != nil {
-		return nil, fmt.Errorf("failed to retrieve metadata: %v", err)
+	registerMetrics()
+
+	if Options.ClusterID != "" {
+		if err := validateClusterID(Options.ClusterID); err != nil {
+			return nil, fmt.Errorf("invalid cluster ID flag: %v", err)
+		}
+		cfg.ClusterID = Options.ClusterID
 	}
 
-	tokenSrc := oauth2.StaticTokenSource(&oauth2.Token{
-		AccessToken: apiToken,
-	})
-	client := oauth2.NewClient(context.Background(), tokenSrc)
+	if Options.Region != "" {
+		if !regionCodeRegex.MatchString(Options.Region) {
+			return nil, fmt.Errorf("invalid region flag: %q is not a valid region code", Options.Region)
+		}
+		cfg.Region = Options.Region
+	}
+
+	if Options.VPCID != "" {
+		if !govalidator.IsUUID(Options.VPCID) {
+			return nil, fmt.Errorf("invalid VPC ID flag: %q is not a valid VPC ID", Options.VPCID)
+		}
+		cfg.VPCID = Options.VPCID
+	}
+
+	url := cfg.APIURL
+	if url == "" {
+		url = os.Getenv(apiURL)
+	}
+
+	var (
+		tokenSrc     oauth2.TokenSource
+		fileTokenSrc *fileTokenSource
+	)
+	if cfg.APIKeyFile != "" {
+		fileTokenSrc, err = newFileTokenSource(cfg.APIKeyFile, newAPIKeyValidator(url, cfg.Timeouts.APIRequest))
+		if err != nil {
+			return nil, err
+		}
+		tokenSrc = fileTokenSrc
+		apiKeyAge.setSource(fileTokenSrc)
+	} else {
+		apiToken := os.Getenv(accessTokenEnv)
+		if apiToken == "" {
+			return nil, fmt.Errorf("%s must be set in the environment (use a k8s secret) or apiKeyFile must be set in the cloud config", accessTokenEnv)
+		}
+		tokenSrc = oauth2.StaticTokenSource(&oauth2.Token{
+			AccessToken: apiToken,
+		})
+	}
+
+	region := cfg.Region
+	if region == "" {
+		region, err = hostMeta.region()
+		if err != nil {
+			return nil, fmt.Errorf("region is not configured, set region in the cloud config or --vultr-region: %v", err)
+		}
+	}
+
+	// the token source is not wrapped in a reuse token source so a rotated key is used on the next request
+	client := &http.Client{
+		Transport: &oauth2.Transport{
+			Source: tokenSrc,
+			Base:   newMetricsTransport(newRetryTransport(http.DefaultTransport, cfg.RateLimit, cfg.Retry, cfg.Timeouts.APIRequest)),
+		},
+	}
 
 	vultr := govultr.NewClient(client)
+	// retries are done by the retry transport which only retries idempotent requests
+	vultr.SetRetryLimit(0)
 
 	ua := os.Getenv(userAgent)
 	if ua != "" {
@@ -70,26 +147,145 @@ func newCloud() (cloudprovider.Interface, error) {
 		vultr.SetUserAgent(fmt.Sprintf("vultr-cloud-controller-manager:%s", vultr.UserAgent))
 	}
 
-	url := os.Getenv(apiURL)
 	if url != "" {
 		if err := vultr.SetBaseURL(url); err != nil {
 			return nil, err
 		}
 	}
 
+	inv := newInventory(vultr, cfg.Cache)
+
+	// the firewall group prunes the rules it does not want, clusters sharing one group would prune each other's rules
+	if cfg.Features.NodePortFirewall && cfg.ClusterID == "" {
+		return nil, fmt.Errorf("features.nodePortFirewall requires a cluster ID")
+	}
+
+	var dnsTemplate *reverseDNSTemplate
+	if cfg.Features.ReverseDNS {
+		if usesReverseDNSPlaceholder(cfg.ReverseDNS.Template, reverseDNSPlaceholderCluster) && cfg.ClusterID == "" {
+			return nil, fmt.Errorf("reverseDNS.template uses {{%s}} but no cluster ID is set", reverseDNSPlaceholderCluster)
+		}
+		dnsTemplate = &reverseDNSTemplate{template: cfg.ReverseDNS.Template, cluster: cfg.ClusterID}
+	}
+
 	return &cloud{
 		client:        vultr,
-		instances:     newInstancesV2(vultr),
-		zones:         newZones(vultr, strings.ToLower(meta.Region.RegionCode)),
-		loadbalancers: newLoadbalancers(vultr, strings.ToLower(meta.Region.RegionCode)),
+		config:        cfg,
+		instances:     newInstancesV2(vultr, inv, cfg.NodeAddresses, cfg.NodeMatching, dnsTemplate),
+		zones:         newZones(inv, region),
+		loadbalancers: newLoadbalancers(vultr, inv, region, cfg),
+		inventory:     inv,
+		tokenSource:   fileTokenSrc,
 	}, nil
 }
 
-func (c *cloud) Initialize(_ cloudprovider.ControllerClientBuilder, _ <-chan struct{}) {
+// Initialize creates the kube client and informers shared by every part of the cloud provider.
+// The informers run until stop is closed.
+func (c *cloud) Initialize(clientBuilder cloudprovider.ControllerClientBuilder, stop <-chan struct{}) {
+	ctx := wait.ContextForChannel(stop)
+
+	if c.tokenSource != nil {
+		go c.tokenSource.Run(ctx)
+	}
+	if c.inventory != nil {
+		go c.inventory.run(ctx)
+	}
+
+	c.kubeClient = clientBuilder.ClientOrDie(kubeClientName)
+	c.informerFactory = informers.NewSharedInformerFactory(c.kubeClient, informerResyncPeriod)
+
+	broadcaster := record.NewBroadcaster(record.WithContext(ctx))
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: c.kubeClient.CoreV1().Events("")})
+	c.eventRecorder = broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: kubeClientName})
+
+	if instances, ok := c.instances.(*instancesv2); ok {
+		instances.setEventRecorder(c.eventRecorder)
+		instances.setNodeLister(c.informerFactory.Core().V1().Nodes().Lister())
+	}
+
+	if c.config.loadBalancersEnabled() {
+		if lbs, ok := c.loadbalancers.(*loadbalancers); ok {
+			lbs.setKubeClient(c.kubeClient, c.informerFactory)
+			lbs.setEventRecorder(c.eventRecorder)
+			if err := lbs.watchEndpointSlices(c.informerFactory); err != nil {
+				klog.Errorf("failed to set up endpoint slice watcher: %v", err)
+			}
+			if err := lbs.watchNodeLabels(c.informerFactory); err != nil {
+				klog.Errorf("failed to set up node label watcher: %v", err)
+			}
+		}
+
+		if err := SetupSecretWatcher(ctx, c.kubeClient, c.informerFactory); err != nil {
+			klog.Errorf("failed to set up secret watcher: %v", err)
+		}
+	}
+
+	var tagController *nodeTagController
+	if c.config.Features.NodeTags {
+		if instances, ok := c.instances.(*instancesv2); ok {
+			var err error
+			if tagController, err = newNodeTagController(c.kubeClient, c.informerFactory, instances); err != nil {
+				klog.Errorf("failed to set up node tag controller: %v", err)
+			}
+		}
+	}
+
+	var dnsController *reverseDNSController
+	if c.config.Features.ReverseDNS {
+		if instances, ok := c.instances.(*instancesv2); ok {
+			var err error
+			if dnsController, err = newReverseDNSController(c.informerFactory, instances, instances.dnsTemplate); err != nil {
+				klog.Errorf("failed to set up reverse DNS controller: %v", err)
+			}
+		}
+	}
+
+	var firewallController *nodePortFirewallController
+	if c.config.Features.NodePortFirewall && c.config.loadBalancersEnabled() {
+		lbs, lbsOK := c.loadbalancers.(*loadbalancers)
+		instances, instancesOK := c.instances.(*instancesv2)
+		if lbsOK && instancesOK {
+			var err error
+			if firewallController, err = newNodePortFirewallController(c.informerFactory, c.client, lbs, instances, c.config.ClusterID,
+				c.config.NodePortFirewall.AttachToNodes); err != nil {
+				klog.Errorf("failed to set up node port firewall controller: %v", err)
+			}
+		}
+	}
+
+	c.informerFactory.Start(stop)
+	for informerType, synced := range c.informerFactory.WaitForCacheSync(stop) {
+		if !synced {
+			klog.Errorf("failed to sync informer cache for %v", informerType)
+		}
+	}
+
+	if c.config.loadBalancersEnabled() {
+		if lbs, ok := c.loadbalancers.(*loadbalancers); ok {
+			go lbs.seedManagedLBs(ctx)
+			go lbs.runEndpointNodeWorkers(ctx)
+			go lbs.runNodeSelectorWorkers(ctx)
+		}
+	}
+
+	if tagController != nil {
+		go tagController.Run(ctx)
+	}
+
+	if dnsController != nil {
+		go dnsController.Run(ctx)
+	}
+
+	if firewallController != nil {
+		go firewallController.Run(ctx)
+	}
 }
 
 func (c *cloud) LoadBalancer() (cloudprovider.LoadBalancer, bool) {
 	klog.V(5).Info("called LoadBalancer") //nolint
+	if !c.config.loadBalancersEnabled() {
+		return nil, false
+	}
 	return c.loadbalancers, true
 }
 
@@ -104,7 +300,7 @@ func (c *cloud) InstancesV2() (cloudprovider.InstancesV2, bool) {
 
 func (c *cloud) Zones() (cloudprovider.Zones, bool) {
 	klog.V(5).Info("called Zones") //nolint
-	return nil, false
+	return c.zones, true
 }
 
 func (c *cloud) Clusters() (cloudprovider.Clusters, bool) {
@@ -124,5 +320,5 @@ func (c *cloud) ProviderName() string {
 
 func (c *cloud) HasClusterID() bool {
 	klog.V(5).Info("called HasClusterID") //nolint
-	return false
+	return c.config.ClusterID != ""
 }
@@ -0,0 +1,427 @@
+// Package vultr is vultr cloud specific implementation
+package vultr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asaskevich/govalidator"
+	"github.com/vultr/govultr/v3"
+	"go.yaml.in/yaml/v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// cloudConfigVersionV1 is the only cloud config schema version currently supported
+	cloudConfigVersionV1 = "v1"
+
+	// annoVultrLoadBalancerPrefix is the prefix shared by every load balancer annotation
+	annoVultrLoadBalancerPrefix = "service.beta.kubernetes.io/vultr-loadbalancer-"
+
+	defaultAPIRequestTimeout = 60 * time.Second
+
+	// the Vultr API allows 30 requests per second per API key
+	defaultRateLimitQPS   = 10
+	defaultRateLimitBurst = 20
+
+	defaultCacheTTL = time.Minute
+	// plans rarely change, plans missing from the catalog are looked up again regardless
+	defaultPlanCacheTTL = time.Hour
+
+	defaultMaxRetries     = 3
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 30 * time.Second
+
+	maxClusterIDLength = 32
+)
+
+var regionCodeRegex = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// CloudConfig is the schema of the file passed to the CCM through --cloud-config.
+// Both YAML and JSON are accepted and unknown fields are rejected.
+type CloudConfig struct {
+	// Version of the config schema, currently only "v1" is supported
+	Version string `yaml:"version"`
+
+	// ClusterID scopes the Vultr resources managed by the CCM to this cluster,
+	// the --vultr-cluster-id flag takes precedence when set
+	ClusterID string `yaml:"clusterID"`
+
+	// Region overrides the region otherwise discovered through the metadata service
+	Region string `yaml:"region"`
+
+	// APIURL overrides the Vultr API base URL, takes precedence over the API_URL env var
+	APIURL string `yaml:"apiURL"`
+
+	// APIKeyFile is a file holding the Vultr API key, typically a mounted Secret. The file is
+	// watched for a new key so the key can be rotated without a restart. Takes precedence over
+	// the VULTR_API_KEY env var
+	APIKeyFile string `yaml:"apiKeyFile"`
+
+	// VPCID is the VPC attached to load balancers which request one through annotations
+	VPCID string `yaml:"vpcID"`
+
+	LoadBalancer     LoadBalancerConfig     `yaml:"loadBalancer"`
+	NodeAddresses    NodeAddressConfig      `yaml:"nodeAddresses"`
+	NodeMatching     NodeMatchingConfig     `yaml:"nodeMatching"`
+	ReverseDNS       ReverseDNSConfig       `yaml:"reverseDNS"`
+	NodePortFirewall NodePortFirewallConfig `yaml:"nodePortFirewall"`
+	Timeouts         TimeoutConfig          `yaml:"timeouts"`
+	RateLimit        RateLimitConfig        `yaml:"rateLimit"`
+	Retry            RetryConfig            `yaml:"retry"`
+	Cache            CacheConfig            `yaml:"cache"`
+	Features         FeatureConfig          `yaml:"features"`
+}
+
+// LoadBalancerConfig holds cluster wide defaults for load balancer services
+type LoadBalancerConfig struct {
+	// DefaultAnnotations are applied to every LoadBalancer service which does not set the annotation itself
+	DefaultAnnotations map[string]string `yaml:"defaultAnnotations"`
+}
+
+// NodeAddressConfig controls which addresses are reported for nodes attached to VPCs,
+// both settings can be overridden per node through annotations
+type NodeAddressConfig struct {
+	// InternalVPC is the ID or description of the VPC which supplies the InternalIP of nodes.
+	// When it is not set instances use their internal IP and bare metal servers the VPC with the lowest ID.
+	InternalVPC string `yaml:"internalVPC"`
+
+	// OtherVPCAddresses is how the addresses of the other VPCs are reported, "internal" adds them
+	// as further InternalIPs and "none" leaves them out, defaults to "internal"
+	OtherVPCAddresses string `yaml:"otherVPCAddresses"`
+
+	// IPFamilyPolicy is which IP families are reported and which comes first: "ipv4", "ipv6",
+	// "dual-stack-primary-v4" or "dual-stack-primary-v6". When it is not set IPv6 is only reported as ExternalIP.
+	IPFamilyPolicy string `yaml:"ipFamilyPolicy"`
+}
+
+// NodeMatchingConfig controls how nodes without a providerID are matched to the Vultr server backing them
+type NodeMatchingConfig struct {
+	// Strategies are tried in order until one matches a single server: "label" matches the server label
+	// against the node name, "address" the server IPs against the node IPs and "hostname" the server
+	// hostname or label against the node hostnames and their first DNS label. Defaults to ["label"]
+	Strategies []string `yaml:"strategies"`
+}
+
+// ReverseDNSConfig holds the PTR records set for the public IPs of nodes when features.reverseDNS is enabled
+type ReverseDNSConfig struct {
+	// Template is the PTR record of a node, {{node}} is replaced with the node name and {{cluster}} with the
+	// cluster ID, such as {{node}}.{{cluster}}.example.com
+	Template string `yaml:"template"`
+}
+
+// NodePortFirewallConfig holds the settings of the firewall group managed when features.nodePortFirewall is enabled
+type NodePortFirewallConfig struct {
+	// AttachToNodes attaches the group to the instances backing nodes which have no firewall group, defaults to
+	// false. The group drops all public traffic it does not allow, such as SSH or kubelet traffic, so rules for it
+	// have to be added to the group first.
+	AttachToNodes bool `yaml:"attachToNodes"`
+}
+
+// TimeoutConfig holds the timeouts used when talking to the Vultr API
+type TimeoutConfig struct {
+	// APIRequest is the timeout for a single attempt of a request to the Vultr API, retries get their own timeout
+	APIRequest time.Duration `yaml:"apiRequest"`
+
+	// LoadBalancerSync is how long a deferred load balancer update is retried in the background
+	LoadBalancerSync time.Duration `yaml:"loadBalancerSync"`
+}
+
+// RateLimitConfig is the client side token bucket applied to every Vultr API request
+type RateLimitConfig struct {
+	// QPS is the sustained number of requests per second
+	QPS float32 `yaml:"qps"`
+
+	// Burst is the number of requests which can be sent at once before QPS applies
+	Burst int `yaml:"burst"`
+}
+
+// RetryConfig controls how idempotent Vultr API requests are retried after a network error, 429 or 5xx
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt, 0 disables retries and unset uses the default
+	MaxRetries *int `yaml:"maxRetries"`
+
+	// BaseDelay is the delay before the first retry, it doubles with every retry
+	BaseDelay time.Duration `yaml:"baseDelay"`
+
+	// MaxDelay caps the delay between retries, a Retry-After asking for longer is not retried
+	MaxDelay time.Duration `yaml:"maxDelay"`
+}
+
+// CacheConfig holds how long the inventory of each kind of Vultr resource is served before it is listed again
+type CacheConfig struct {
+	Instances     time.Duration `yaml:"instances"`
+	BareMetal     time.Duration `yaml:"bareMetal"`
+	LoadBalancers time.Duration `yaml:"loadBalancers"`
+	Plans         time.Duration `yaml:"plans"`
+	VPCs          time.Duration `yaml:"vpcs"`
+}
+
+// FeatureConfig toggles optional CCM functionality
+type FeatureConfig struct {
+	// LoadBalancers enables the load balancer interface, defaults to true
+	LoadBalancers *bool `yaml:"loadBalancers"`
+
+	// NodeTags syncs the tags of Vultr servers into labels and taints of their nodes, defaults to false
+	NodeTags bool `yaml:"nodeTags"`
+
+	// ReverseDNS sets the reverse DNS of the public IPs of instances backing nodes to reverseDNS.template, defaults to false
+	ReverseDNS bool `yaml:"reverseDNS"`
+
+	// NodePortFirewall manages a firewall group of the cluster which allows the load balancers of LoadBalancer services
+	// to reach their NodePorts and health check ports, see nodePortFirewall.attachToNodes. Requires a cluster ID, defaults to false
+	NodePortFirewall bool `yaml:"nodePortFirewall"`
+}
+
+// readCloudConfig parses and validates the cloud config. A nil or empty reader returns the default config.
+func readCloudConfig(r io.Reader) (*CloudConfig, error) {
+	cfg := &CloudConfig{}
+
+	if r != nil {
+		dec := yaml.NewDecoder(r)
+		dec.KnownFields(true)
+		err := dec.Decode(cfg)
+		switch {
+		case errors.Is(err, io.EOF):
+			// an empty config file is treated the same as no config file
+		case err != nil:
+			return nil, fmt.Errorf("failed to parse cloud config: %w", err)
+		default:
+			if err := cfg.validate(); err != nil {
+				return nil, fmt.Errorf("invalid cloud config: %w", err)
+			}
+		}
+	}
+
+	cfg.setDefaults()
+	return cfg, nil
+}
+
+// setDefaults fills in any value which was not supplied through the config file
+func (c *CloudConfig) setDefaults() {
+	if c.Version == "" {
+		c.Version = cloudConfigVersionV1
+	}
+
+	if c.Timeouts.APIRequest == 0 {
+		c.Timeouts.APIRequest = defaultAPIRequestTimeout
+	}
+
+	if c.Timeouts.LoadBalancerSync == 0 {
+		c.Timeouts.LoadBalancerSync = syncTimeout * time.Minute
+	}
+
+	if c.RateLimit.QPS == 0 {
+		c.RateLimit.QPS = defaultRateLimitQPS
+	}
+
+	if c.RateLimit.Burst == 0 {
+		c.RateLimit.Burst = defaultRateLimitBurst
+	}
+
+	if c.Retry.MaxRetries == nil {
+		c.Retry.MaxRetries = govultr.IntToIntPtr(defaultMaxRetries)
+	}
+
+	if c.Retry.BaseDelay == 0 {
+		c.Retry.BaseDelay = defaultRetryBaseDelay
+	}
+
+	if c.Retry.MaxDelay == 0 {
+		c.Retry.MaxDelay = defaultRetryMaxDelay
+	}
+
+	if c.Cache.Instances == 0 {
+		c.Cache.Instances = defaultCacheTTL
+	}
+
+	if c.Cache.BareMetal == 0 {
+		c.Cache.BareMetal = defaultCacheTTL
+	}
+
+	if c.Cache.LoadBalancers == 0 {
+		c.Cache.LoadBalancers = defaultCacheTTL
+	}
+
+	if c.Cache.Plans == 0 {
+		c.Cache.Plans = defaultPlanCacheTTL
+	}
+
+	if c.Cache.VPCs == 0 {
+		c.Cache.VPCs = defaultCacheTTL
+	}
+
+	if c.NodeAddresses.OtherVPCAddresses == "" {
+		c.NodeAddresses.OtherVPCAddresses = otherVPCAddressesInternal
+	}
+
+	if len(c.NodeMatching.Strategies) == 0 {
+		c.NodeMatching.Strategies = []string{nodeMatchLabel}
+	}
+
+	if c.Features.LoadBalancers == nil {
+		c.Features.LoadBalancers = govultr.BoolToBoolPtr(true)
+	}
+}
+
+// validate returns every problem found with the config joined into a single error
+func (c *CloudConfig) validate() error {
+	var errs []error
+
+	if c.Version == "" {
+		errs = append(errs, fmt.Errorf("version: must be set, supported versions are [%s]", cloudConfigVersionV1))
+	} else if c.Version != cloudConfigVersionV1 {
+		errs = append(errs, fmt.Errorf("version: %q is not supported, supported versions are [%s]", c.Version, cloudConfigVersionV1))
+	}
+
+	if err := validateClusterID(c.ClusterID); err != nil {
+		errs = append(errs, fmt.Errorf("clusterID: %w", err))
+	}
+
+	if c.Region != "" && !regionCodeRegex.MatchString(c.Region) {
+		errs = append(errs, fmt.Errorf("region: %q is not a valid region code", c.Region))
+	}
+
+	if c.APIURL != "" {
+		u, err := url.Parse(c.APIURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("apiURL: %q must be an absolute http(s) URL", c.APIURL))
+		}
+	}
+
+	if c.VPCID != "" && !govalidator.IsUUID(c.VPCID) {
+		errs = append(errs, fmt.Errorf("vpcID: %q is not a valid VPC ID", c.VPCID))
+	}
+
+	keys := make([]string, 0, len(c.LoadBalancer.DefaultAnnotations))
+	for key := range c.LoadBalancer.DefaultAnnotations {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := validateDefaultAnnotation(key); err != nil {
+			errs = append(errs, fmt.Errorf("loadBalancer.defaultAnnotations[%q]: %w", key, err))
+		}
+	}
+
+	if c.Timeouts.APIRequest < 0 {
+		errs = append(errs, fmt.Errorf("timeouts.apiRequest: must not be negative"))
+	}
+
+	if c.Timeouts.LoadBalancerSync < 0 {
+		errs = append(errs, fmt.Errorf("timeouts.loadBalancerSync: must not be negative"))
+	}
+
+	if c.RateLimit.QPS < 0 {
+		errs = append(errs, fmt.Errorf("rateLimit.qps: must not be negative"))
+	}
+
+	if c.RateLimit.Burst < 0 {
+		errs = append(errs, fmt.Errorf("rateLimit.burst: must not be negative"))
+	}
+
+	if c.Retry.MaxRetries != nil && *c.Retry.MaxRetries < 0 {
+		errs = append(errs, fmt.Errorf("retry.maxRetries: must not be negative"))
+	}
+
+	if c.Retry.BaseDelay < 0 {
+		errs = append(errs, fmt.Errorf("retry.baseDelay: must not be negative"))
+	}
+
+	if c.Retry.MaxDelay < 0 {
+		errs = append(errs, fmt.Errorf("retry.maxDelay: must not be negative"))
+	} else if c.Retry.MaxDelay > 0 && c.Retry.MaxDelay < c.Retry.BaseDelay {
+		errs = append(errs, fmt.Errorf("retry.maxDelay: must not be less than retry.baseDelay"))
+	}
+
+	if c.Cache.Instances < 0 {
+		errs = append(errs, fmt.Errorf("cache.instances: must not be negative"))
+	}
+
+	if c.Cache.BareMetal < 0 {
+		errs = append(errs, fmt.Errorf("cache.bareMetal: must not be negative"))
+	}
+
+	if c.Cache.LoadBalancers < 0 {
+		errs = append(errs, fmt.Errorf("cache.loadBalancers: must not be negative"))
+	}
+
+	if c.Cache.Plans < 0 {
+		errs = append(errs, fmt.Errorf("cache.plans: must not be negative"))
+	}
+
+	if c.Cache.VPCs < 0 {
+		errs = append(errs, fmt.Errorf("cache.vpcs: must not be negative"))
+	}
+
+	if err := validateOtherVPCAddresses(c.NodeAddresses.OtherVPCAddresses); err != nil {
+		errs = append(errs, fmt.Errorf("nodeAddresses.otherVPCAddresses: %w", err))
+	}
+
+	if err := validateIPFamilyPolicy(c.NodeAddresses.IPFamilyPolicy); err != nil {
+		errs = append(errs, fmt.Errorf("nodeAddresses.ipFamilyPolicy: %w", err))
+	}
+
+	if c.Features.ReverseDNS && c.ReverseDNS.Template == "" {
+		errs = append(errs, fmt.Errorf("reverseDNS.template: must be set when features.reverseDNS is enabled"))
+	} else if c.ReverseDNS.Template != "" {
+		if err := validateReverseDNSTemplate(c.ReverseDNS.Template); err != nil {
+			errs = append(errs, fmt.Errorf("reverseDNS.template: %w", err))
+		}
+	}
+
+	if err := validateNodeMatchStrategies(c.NodeMatching.Strategies); err != nil {
+		errs = append(errs, fmt.Errorf("nodeMatching.strategies: %w", err))
+	}
+
+	return errors.Join(errs...)
+}
+
+// validateClusterID makes sure the cluster ID can be used as part of a load balancer label
+func validateClusterID(clusterID string) error {
+	if clusterID == "" {
+		return nil
+	}
+
+	if errs := validation.IsDNS1123Label(clusterID); len(errs) > 0 {
+		return fmt.Errorf("%q is invalid: %s", clusterID, strings.Join(errs, ", "))
+	}
+
+	if len(clusterID) > maxClusterIDLength {
+		return fmt.Errorf("%q must be no more than %d characters", clusterID, maxClusterIDLength)
+	}
+
+	return nil
+}
+
+// validateDefaultAnnotation makes sure a default annotation is a load balancer annotation which is
+// safe to share between services
+func validateDefaultAnnotation(key string) error {
+	if !strings.HasPrefix(key, annoVultrLoadBalancerPrefix) {
+		return fmt.Errorf("only %s* annotations can be defaulted", annoVultrLoadBalancerPrefix)
+	}
+
+	if !knownLBAnnotations[key] {
+		return fmt.Errorf("unknown load balancer annotation")
+	}
+
+	switch key {
+	case annoVultrLoadBalancerID, annoVultrLoadBalancerLabel, annoVultrLBSSLLastUpdatedTime, annoVultrLBEndpointsLastUpdatedTime,
+		annoVultrLBNodesLastUpdatedTime:
+		return fmt.Errorf("annotation is specific to a single service and can not be defaulted")
+	}
+
+	return nil
+}
+
+// loadBalancersEnabled returns whether the load balancer interface should be served
+func (c *CloudConfig) loadBalancersEnabled() bool {
+	return c.Features.LoadBalancers == nil || *c.Features.LoadBalancers
+}
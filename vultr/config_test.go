@@ -0,0 +1,215 @@
+package vultr
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_ReadCloudConfigYAML(t *testing.T) {
+	cfg, err := readCloudConfig(strings.NewReader(`
+version: v1
+region: ewr
+apiURL: https://api.vultr.com
+apiKeyFile: /etc/vultr/api-key
+vpcID: 9c7f4a36-3e52-4c3e-9d3f-2a0ad7a3bb11
+loadBalancer:
+  defaultAnnotations:
+    service.beta.kubernetes.io/vultr-loadbalancer-algorithm: least_connections
+timeouts:
+  apiRequest: 30s
+rateLimit:
+  qps: 5
+retry:
+  maxRetries: 5
+features:
+  loadBalancers: false
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Region != "ewr" {
+		t.Errorf("expected region ewr got %s", cfg.Region)
+	}
+	if cfg.APIKeyFile != "/etc/vultr/api-key" {
+		t.Errorf("expected apiKeyFile to be set got %s", cfg.APIKeyFile)
+	}
+	if cfg.VPCID != "9c7f4a36-3e52-4c3e-9d3f-2a0ad7a3bb11" {
+		t.Errorf("expected vpcID to be set got %s", cfg.VPCID)
+	}
+	if cfg.LoadBalancer.DefaultAnnotations[annoVultrAlgorithm] != "least_connections" {
+		t.Errorf("expected default algorithm annotation got %+v", cfg.LoadBalancer.DefaultAnnotations)
+	}
+	if cfg.Timeouts.APIRequest != 30*time.Second {
+		t.Errorf("expected apiRequest timeout 30s got %s", cfg.Timeouts.APIRequest)
+	}
+	if cfg.Timeouts.LoadBalancerSync != syncTimeout*time.Minute {
+		t.Errorf("expected default loadBalancerSync timeout got %s", cfg.Timeouts.LoadBalancerSync)
+	}
+	if cfg.RateLimit.QPS != 5 || cfg.RateLimit.Burst != defaultRateLimitBurst {
+		t.Errorf("expected qps 5 and default burst got %+v", cfg.RateLimit)
+	}
+	if *cfg.Retry.MaxRetries != 5 || cfg.Retry.BaseDelay != defaultRetryBaseDelay {
+		t.Errorf("expected 5 retries and default base delay got %+v", cfg.Retry)
+	}
+	if cfg.loadBalancersEnabled() {
+		t.Error("expected load balancers to be disabled")
+	}
+}
+
+func TestConfig_ReadCloudConfigJSON(t *testing.T) {
+	cfg, err := readCloudConfig(strings.NewReader(`{"version": "v1", "region": "sjc", "timeouts": {"loadBalancerSync": "5m"}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Region != "sjc" {
+		t.Errorf("expected region sjc got %s", cfg.Region)
+	}
+	if cfg.Timeouts.LoadBalancerSync != 5*time.Minute {
+		t.Errorf("expected loadBalancerSync timeout 5m got %s", cfg.Timeouts.LoadBalancerSync)
+	}
+	if !cfg.loadBalancersEnabled() {
+		t.Error("expected load balancers to be enabled by default")
+	}
+}
+
+func TestConfig_ReadCloudConfigZeroRetries(t *testing.T) {
+	cfg, err := readCloudConfig(strings.NewReader(`
+version: v1
+retry:
+  maxRetries: 0
+`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if *cfg.Retry.MaxRetries != 0 {
+		t.Errorf("expected retries to be disabled got %d", *cfg.Retry.MaxRetries)
+	}
+}
+
+func TestConfig_ReadCloudConfigDefaults(t *testing.T) {
+	for name, cfgReader := range map[string]io.Reader{
+		"nil":   nil,
+		"empty": strings.NewReader(""),
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := readCloudConfig(cfgReader)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if cfg.Version != cloudConfigVersionV1 {
+				t.Errorf("expected version %s got %s", cloudConfigVersionV1, cfg.Version)
+			}
+			if cfg.Timeouts.APIRequest != defaultAPIRequestTimeout {
+				t.Errorf("expected default apiRequest timeout got %s", cfg.Timeouts.APIRequest)
+			}
+			if *cfg.Retry.MaxRetries != defaultMaxRetries {
+				t.Errorf("expected default max retries got %d", *cfg.Retry.MaxRetries)
+			}
+			if cfg.NodeAddresses.OtherVPCAddresses != otherVPCAddressesInternal {
+				t.Errorf("expected other VPC addresses to default to %s got %s", otherVPCAddressesInternal, cfg.NodeAddresses.OtherVPCAddresses)
+			}
+			if len(cfg.NodeMatching.Strategies) != 1 || cfg.NodeMatching.Strategies[0] != nodeMatchLabel {
+				t.Errorf("expected node matching strategies to default to [%s] got %v", nodeMatchLabel, cfg.NodeMatching.Strategies)
+			}
+		})
+	}
+}
+
+func TestConfig_ReadCloudConfigErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{
+			name:     "unknown field",
+			config:   "version: v1\nregoin: ewr\n",
+			expected: []string{"field regoin not found"},
+		},
+		{
+			name:     "missing version",
+			config:   "region: ewr\n",
+			expected: []string{"version: must be set"},
+		},
+		{
+			name:     "unsupported version",
+			config:   "version: v2\n",
+			expected: []string{`version: "v2" is not supported`},
+		},
+		{
+			name:     "invalid duration",
+			config:   "version: v1\ntimeouts:\n  apiRequest: soon\n",
+			expected: []string{"failed to parse cloud config"},
+		},
+		{
+			name:     "max delay less than base delay",
+			config:   "version: v1\nretry:\n  baseDelay: 5s\n  maxDelay: 1s\n",
+			expected: []string{"retry.maxDelay: must not be less than retry.baseDelay"},
+		},
+		{
+			name:     "unsupported other VPC addresses",
+			config:   "version: v1\nnodeAddresses:\n  otherVPCAddresses: external\n",
+			expected: []string{`nodeAddresses.otherVPCAddresses: "external" is not supported`},
+		},
+		{
+			name:     "unsupported node match strategy",
+			config:   "version: v1\nnodeMatching:\n  strategies: [label, mac]\n",
+			expected: []string{`nodeMatching.strategies: "mac" is not supported`},
+		},
+		{
+			name:     "reverse DNS without template",
+			config:   "version: v1\nfeatures:\n  reverseDNS: true\n",
+			expected: []string{"reverseDNS.template: must be set when features.reverseDNS is enabled"},
+		},
+		{
+			name: "unknown default annotation",
+			config: `
+loadBalancer:
+  defaultAnnotations:
+    service.beta.kubernetes.io/vultr-loadbalancer-algorythm: least_connections
+`,
+			expected: []string{`loadBalancer.defaultAnnotations["service.beta.kubernetes.io/vultr-loadbalancer-algorythm"]: unknown load balancer annotation`},
+		},
+		{
+			name: "multiple errors",
+			config: `
+version: v1
+clusterID: Prod_1
+region: New Jersey
+apiURL: api.vultr.com
+vpcID: not-a-vpc
+loadBalancer:
+  defaultAnnotations:
+    service.beta.kubernetes.io/vultr-loadbalancer-id: abc123
+    example.com/other: "true"
+`,
+			expected: []string{
+				`clusterID: "Prod_1" is invalid`,
+				`region: "New Jersey" is not a valid region code`,
+				`apiURL: "api.vultr.com" must be an absolute http(s) URL`,
+				`vpcID: "not-a-vpc" is not a valid VPC ID`,
+				`loadBalancer.defaultAnnotations["example.com/other"]`,
+				`loadBalancer.defaultAnnotations["service.beta.kubernetes.io/vultr-loadbalancer-id"]`,
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := readCloudConfig(strings.NewReader(tc.config))
+			if err == nil {
+				t.Fatal("expected error got nil")
+			}
+
+			for _, expected := range tc.expected {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected error to contain %q got %q", expected, err.Error())
+				}
+			}
+		})
+	}
+}
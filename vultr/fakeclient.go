@@ -3,6 +3,7 @@ package vultr
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/vultr/govultr/v3"
@@ -11,9 +12,13 @@ import (
 func newFakeClient() *govultr.Client {
 	fakeInstance := FakeInstance{client: nil}
 	fakeLoadBalancer := fakeLB{client: nil}
+	fakeBareMetal := fakeBareMetalServer{client: nil}
 	return &govultr.Client{
-		Instance:     &fakeInstance,
-		LoadBalancer: &fakeLoadBalancer,
+		Instance:        &fakeInstance,
+		LoadBalancer:    &fakeLoadBalancer,
+		BareMetalServer: &fakeBareMetal,
+		Plan:            &fakePlan{},
+		VPC:             &fakeVPC{},
 	}
 }
 
@@ -22,14 +27,25 @@ type FakeInstance struct {
 	client *govultr.Client
 }
 
-// ListVPCInfo returns VPC info (not implemented, yet)
+// ListVPCInfo returns VPC info
 func (f *FakeInstance) ListVPCInfo(_ context.Context, _ string, _ *govultr.ListOptions) ([]govultr.VPCInfo, *govultr.Meta, *http.Response, error) {
-	panic("implement me")
+	return []govultr.VPCInfo{
+			{
+				ID:        "f2b4a8c1-57c3-4d9a-8e0b-6b1f2d3c4e5a",
+				IPAddress: "10.2.96.4",
+			},
+			{
+				ID:        "9c7f4a36-3e52-4c3e-9d3f-2a0ad7a3bb11",
+				IPAddress: "10.1.95.4",
+			},
+		}, &govultr.Meta{
+			Links: &govultr.Links{},
+		}, nil, nil
 }
 
-// ListVPC2Info returns VPC info (not implemented, yet)
+// ListVPC2Info returns VPC2 info
 func (f *FakeInstance) ListVPC2Info(_ context.Context, _ string, _ *govultr.ListOptions) ([]govultr.VPC2Info, *govultr.Meta, *http.Response, error) { //nolint:staticcheck
-	panic("implement me")
+	return nil, &govultr.Meta{Links: &govultr.Links{}}, nil, nil
 }
 
 // AttachVPC attaches VPC (not implemented, yet)
@@ -71,6 +87,7 @@ func (f *FakeInstance) Get(_ context.Context, _ string) (*govultr.Instance, *htt
 		Plan:         "vc2-4c-8gb",
 		Label:        "ccm-test",
 		InternalIP:   "10.1.95.4",
+		Tags:         []string{"pool=batch", "taint:dedicated=batch:NoSchedule"},
 	}, nil, nil
 }
 
@@ -99,6 +116,7 @@ func (f *FakeInstance) List(_ context.Context, _ *govultr.ListOptions) ([]govult
 				Plan:         "vc2-4c-8gb",
 				Label:        "ccm-test",
 				InternalIP:   "10.1.95.4",
+				Tags:         []string{"pool=batch", "taint:dedicated=batch:NoSchedule"},
 			},
 		}, &govultr.Meta{
 			Total: 0,
@@ -156,7 +174,7 @@ func (f *FakeInstance) GetBandwidth(_ context.Context, _ string) (*govultr.Bandw
 
 // GetNeighbors gets neighors for an instance
 func (f *FakeInstance) GetNeighbors(_ context.Context, _ string) (*govultr.Neighbors, *http.Response, error) {
-	panic("implement me")
+	return &govultr.Neighbors{Neighbors: []string{"0c51cc3d-529e-4e03-ad86-fd0af47467ba"}}, nil, nil
 }
 
 // ISOStatus gets ISO status from instance
@@ -242,6 +260,9 @@ func (f *FakeInstance) GetUpgrades(_ context.Context, _ string) (*govultr.Upgrad
 type fakeLB struct {
 	client *govultr.Client
 
+	// loadBalancers overrides the load balancers returned by Get and List when set
+	loadBalancers []govultr.LoadBalancer
+
 	forwardingRules []govultr.ForwardingRule
 	createdRules    []govultr.ForwardingRule
 	deletedRules    []string
@@ -261,7 +282,16 @@ func (f *fakeLB) Create(_ context.Context, _ *govultr.LoadBalancerReq) (*govultr
 }
 
 // Get gets loadbalancer
-func (f *fakeLB) Get(_ context.Context, _ string) (*govultr.LoadBalancer, *http.Response, error) {
+func (f *fakeLB) Get(_ context.Context, lbID string) (*govultr.LoadBalancer, *http.Response, error) {
+	if f.loadBalancers != nil {
+		for i := range f.loadBalancers {
+			if f.loadBalancers[i].ID == lbID {
+				return &f.loadBalancers[i], nil, nil
+			}
+		}
+		return nil, nil, errors.New(`{"error":"load balancer not found","status":404}`)
+	}
+
 	return &govultr.LoadBalancer{
 		ID:        "6334f227-6d96-4cbd-9bcb-5be0759354fa",
 		Region:    "ewr",
@@ -296,6 +326,16 @@ func (f *fakeLB) DeleteSSL(_ context.Context, _ string) error {
 
 // List gets loadbalancers
 func (f *fakeLB) List(_ context.Context, _ *govultr.ListOptions) ([]govultr.LoadBalancer, *govultr.Meta, *http.Response, error) {
+	if f.loadBalancers != nil {
+		return f.loadBalancers, &govultr.Meta{
+			Total: len(f.loadBalancers),
+			Links: &govultr.Links{
+				Next: "",
+				Prev: "",
+			},
+		}, nil, nil
+	}
+
 	return []govultr.LoadBalancer{
 			{
 				ID:     "6334f227-6d96-4cbd-9bcb-5be0759354fa",
@@ -366,3 +406,255 @@ func (f *fakeLB) ListFirewallRules(_ context.Context, _ string, _ *govultr.ListO
 func (f *fakeLB) GetFirewallRule(_ context.Context, _, _ string) (*govultr.LBFirewallRule, *http.Response, error) {
 	return nil, nil, nil
 }
+
+// fakeMissingInstance is a FakeInstance which can not find any instance
+type fakeMissingInstance struct {
+	FakeInstance
+}
+
+// Get returns an instance not found error
+func (f *fakeMissingInstance) Get(_ context.Context, _ string) (*govultr.Instance, *http.Response, error) {
+	return nil, nil, errors.New(`{"error":"instance not found","status":404}`)
+}
+
+// List returns no instances
+func (f *fakeMissingInstance) List(_ context.Context, _ *govultr.ListOptions) ([]govultr.Instance, *govultr.Meta, *http.Response, error) {
+	return nil, &govultr.Meta{Links: &govultr.Links{}}, nil, nil
+}
+
+// fakeMissingBareMetalServer is a fakeBareMetalServer which can not find any bare metal server
+type fakeMissingBareMetalServer struct {
+	fakeBareMetalServer
+}
+
+// Get returns a bare metal server not found error
+func (f *fakeMissingBareMetalServer) Get(_ context.Context, _ string) (*govultr.BareMetalServer, *http.Response, error) {
+	return nil, nil, errors.New(`{"error":"Invalid server.","status":400}`)
+}
+
+// List returns no bare metal servers
+func (f *fakeMissingBareMetalServer) List(_ context.Context, _ *govultr.ListOptions) ([]govultr.BareMetalServer, *govultr.Meta, *http.Response, error) {
+	return nil, &govultr.Meta{Links: &govultr.Links{}}, nil, nil
+}
+
+type fakeBareMetalServer struct {
+	client *govultr.Client
+}
+
+// Create creates a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) Create(_ context.Context, _ *govultr.BareMetalCreate) (*govultr.BareMetalServer, *http.Response, error) {
+	panic("implement me")
+}
+
+// Get returns bare metal server
+func (f *fakeBareMetalServer) Get(_ context.Context, _ string) (*govultr.BareMetalServer, *http.Response, error) {
+	return &govultr.BareMetalServer{
+		ID:       "cb676a46-66fd-4dfb-b839-443f2e6c0b60",
+		MainIP:   "45.63.11.8",
+		CPUCount: 24,
+		Region:   "sjc",
+		Status:   "active",
+		Plan:     "vbm-24c-256gb-amd",
+		Label:    "ccm-test-bm",
+	}, nil, nil
+}
+
+// Update updates a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) Update(_ context.Context, _ string, _ *govultr.BareMetalUpdate) (*govultr.BareMetalServer, *http.Response, error) {
+	panic("implement me")
+}
+
+// Delete deletes a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) Delete(_ context.Context, _ string) error {
+	panic("implement me")
+}
+
+// List lists bare metal servers
+func (f *fakeBareMetalServer) List(_ context.Context, _ *govultr.ListOptions) ([]govultr.BareMetalServer, *govultr.Meta, *http.Response, error) {
+	return []govultr.BareMetalServer{
+			{
+				ID:       "cb676a46-66fd-4dfb-b839-443f2e6c0b60",
+				MainIP:   "45.63.11.8",
+				CPUCount: 24,
+				Region:   "sjc",
+				Status:   "active",
+				Plan:     "vbm-24c-256gb-amd",
+				Label:    "ccm-test-bm",
+			},
+		}, &govultr.Meta{
+			Total: 0,
+			Links: &govultr.Links{
+				Next: "",
+				Prev: "",
+			},
+		}, nil, nil
+}
+
+// GetBandwidth gets bandwidth for a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) GetBandwidth(_ context.Context, _ string) (*govultr.Bandwidth, *http.Response, error) {
+	panic("implement me")
+}
+
+// GetUserData gets user data for a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) GetUserData(_ context.Context, _ string) (*govultr.UserData, *http.Response, error) {
+	panic("implement me")
+}
+
+// GetVNCUrl gets the VNC URL for a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) GetVNCUrl(_ context.Context, _ string) (*govultr.VNCUrl, *http.Response, error) {
+	panic("implement me")
+}
+
+// ListIPv4s lists IPv4 addresses for a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) ListIPv4s(_ context.Context, _ string, _ *govultr.ListOptions) ([]govultr.IPv4, *govultr.Meta, *http.Response, error) {
+	panic("implement me")
+}
+
+// ListIPv6s lists IPv6 addresses for a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) ListIPv6s(_ context.Context, _ string, _ *govultr.ListOptions) ([]govultr.IPv6, *govultr.Meta, *http.Response, error) {
+	panic("implement me")
+}
+
+// Halt halts a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) Halt(_ context.Context, _ string) error {
+	panic("implement me")
+}
+
+// Reboot reboots a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) Reboot(_ context.Context, _ string) error {
+	panic("implement me")
+}
+
+// Start starts a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) Start(_ context.Context, _ string) error {
+	panic("implement me")
+}
+
+// Reinstall reinstalls a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) Reinstall(_ context.Context, _ string) (*govultr.BareMetalServer, *http.Response, error) {
+	panic("implement me")
+}
+
+// MassStart bulk starts bare metal servers (not implemented, yet)
+func (f *fakeBareMetalServer) MassStart(_ context.Context, _ []string) error {
+	panic("implement me")
+}
+
+// MassHalt bulk halts bare metal servers (not implemented, yet)
+func (f *fakeBareMetalServer) MassHalt(_ context.Context, _ []string) error {
+	panic("implement me")
+}
+
+// MassReboot bulk reboots bare metal servers (not implemented, yet)
+func (f *fakeBareMetalServer) MassReboot(_ context.Context, _ []string) error {
+	panic("implement me")
+}
+
+// GetUpgrades gets upgrades for a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) GetUpgrades(_ context.Context, _ string) (*govultr.Upgrades, *http.Response, error) {
+	panic("implement me")
+}
+
+// ListVPCInfo returns VPC info for a bare metal server
+func (f *fakeBareMetalServer) ListVPCInfo(_ context.Context, _ string) ([]govultr.VPCInfo, *http.Response, error) {
+	return []govultr.VPCInfo{
+		{
+			ID:        "9c7f4a36-3e52-4c3e-9d3f-2a0ad7a3bb11",
+			IPAddress: "10.1.96.3",
+		},
+	}, nil, nil
+}
+
+// AttachVPC attaches a VPC to a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) AttachVPC(_ context.Context, _, _ string) error {
+	panic("implement me")
+}
+
+// DetachVPC detaches a VPC from a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) DetachVPC(_ context.Context, _, _ string) error {
+	panic("implement me")
+}
+
+// ListVPC2Info returns VPC2 info for a bare metal server
+func (f *fakeBareMetalServer) ListVPC2Info(_ context.Context, _ string) ([]govultr.VPC2Info, *http.Response, error) { //nolint:staticcheck
+	return nil, nil, nil
+}
+
+// AttachVPC2 attaches a VPC2 to a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) AttachVPC2(_ context.Context, _ string, _ *govultr.AttachVPC2Req) error { //nolint:staticcheck
+	panic("implement me")
+}
+
+// DetachVPC2 detaches a VPC2 from a bare metal server (not implemented, yet)
+func (f *fakeBareMetalServer) DetachVPC2(_ context.Context, _, _ string) error {
+	panic("implement me")
+}
+
+// fakePlan is a fake plans catalog
+type fakePlan struct{}
+
+// List returns instance plans
+func (f *fakePlan) List(_ context.Context, _ string, _ *govultr.ListOptions) ([]govultr.Plan, *govultr.Meta, *http.Response, error) {
+	return []govultr.Plan{
+			{
+				ID:        "vc2-4c-8gb",
+				VCPUCount: 4,
+				RAM:       8192,
+				Disk:      160,
+				DiskCount: 1,
+				Type:      "vc2",
+			},
+			{
+				ID:        "vcg-a100-1c-6g-4vram",
+				VCPUCount: 1,
+				RAM:       6144,
+				Disk:      70,
+				DiskCount: 1,
+				Type:      "vcg",
+				GPUVRAM:   4,
+				GPUType:   "NVIDIA_A100",
+			},
+		}, &govultr.Meta{
+			Links: &govultr.Links{},
+		}, nil, nil
+}
+
+// ListBareMetal returns bare metal plans
+func (f *fakePlan) ListBareMetal(_ context.Context, _ *govultr.ListOptions) ([]govultr.BareMetalPlan, *govultr.Meta, *http.Response, error) {
+	return []govultr.BareMetalPlan{
+			{
+				ID:         "vbm-24c-256gb-amd",
+				CPUCount:   24,
+				CPUThreads: 48,
+				RAM:        261120,
+				Disk:       1920,
+				DiskCount:  2,
+				Type:       "NVMe",
+			},
+		}, &govultr.Meta{
+			Links: &govultr.Links{},
+		}, nil, nil
+}
+
+// fakeVPC is a fake VPC service, only listing is implemented
+type fakeVPC struct {
+	govultr.VPCService
+}
+
+// List returns VPCs
+func (f *fakeVPC) List(_ context.Context, _ *govultr.ListOptions) ([]govultr.VPC, *govultr.Meta, *http.Response, error) {
+	return []govultr.VPC{
+			{
+				ID:          "9c7f4a36-3e52-4c3e-9d3f-2a0ad7a3bb11",
+				Region:      "ewr",
+				Description: "k8s-frontend",
+			},
+			{
+				ID:          "f2b4a8c1-57c3-4d9a-8e0b-6b1f2d3c4e5a",
+				Region:      "ewr",
+				Description: "k8s-backend",
+			},
+		}, &govultr.Meta{
+			Links: &govultr.Links{},
+		}, nil, nil
+}
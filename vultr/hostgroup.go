@@ -0,0 +1,84 @@
+package vultr
+
+import (
+	"context"
+	"sort"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/klog/v2"
+)
+
+// hostGroupLabel identifies the physical host of a node, nodes with the same value share a host
+const hostGroupLabel = "vultr.com/host-group"
+
+// setNodeLister sets the lister used to keep the host group of new nodes consistent with their neighbors
+func (i *instancesv2) setNodeLister(nodeLister corelisters.NodeLister) {
+	i.nodeLister = nodeLister
+}
+
+// instanceHostGroup returns the host group of an instance. Vultr does not expose host IDs, so the group of a
+// host is named after the lowest ID of the instances on it. A neighbor which already backs a node in a host
+// group takes precedence, so nodes keep sharing a group when instances are added to or removed from the host.
+// Nodes which already have a group keep it without looking up the neighbors again, the label is only applied
+// when the node is initialized. The group is empty when the neighbors can't be looked up.
+func (i *instancesv2) instanceHostGroup(ctx context.Context, node *v1.Node, instance *govultr.Instance) string {
+	if group := node.Labels[hostGroupLabel]; group != "" {
+		return group
+	}
+
+	neighbors, resp, err := i.client.Instance.GetNeighbors(ctx, instance.ID) //nolint:bodyclose
+	if err != nil {
+		klog.Errorf("failed to get neighbors of instance %s, not labeling node %s with a host group: %v",
+			instance.ID, node.Name, newAPIError(resp, err))
+		return ""
+	}
+
+	members := []string{instance.ID}
+	if neighbors != nil {
+		members = append(members, neighbors.Neighbors...)
+	}
+	sort.Strings(members)
+
+	if group := i.neighborHostGroup(instance.ID, members); group != "" {
+		return group
+	}
+
+	return members[0]
+}
+
+// neighborHostGroup returns the lowest host group of the nodes backed by the neighbors of an instance
+func (i *instancesv2) neighborHostGroup(instanceID string, members []string) string {
+	if i.nodeLister == nil || len(members) < 2 {
+		return ""
+	}
+
+	nodes, err := i.nodeLister.List(labels.Everything())
+	if err != nil {
+		return ""
+	}
+
+	isNeighbor := make(map[string]bool, len(members))
+	for _, id := range members {
+		isNeighbor[id] = id != instanceID
+	}
+
+	var groups []string
+	for _, node := range nodes {
+		group, ok := node.Labels[hostGroupLabel]
+		if !ok || node.Spec.ProviderID == "" {
+			continue
+		}
+		if id, err := vultrIDFromProviderID(node.Spec.ProviderID); err == nil && isNeighbor[id] {
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) == 0 {
+		return ""
+	}
+
+	sort.Strings(groups)
+	return groups[0]
+}
@@ -0,0 +1,128 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/vultr/govultr/v3"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInstancesV2_InstanceHostGroup(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+	}
+
+	tests := []struct {
+		name     string
+		nodes    []*v1.Node
+		expected string
+	}{
+		{
+			name:     "lowest member ID",
+			expected: "0c51cc3d-529e-4e03-ad86-fd0af47467ba",
+		},
+		{
+			name: "group of neighbor node",
+			nodes: []*v1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   "ccm-neighbor",
+						Labels: map[string]string{hostGroupLabel: "ca9a74cb-2d9f-4786-9bb0-094398c593a2"},
+					},
+					Spec: v1.NodeSpec{ProviderID: "vultr://0c51cc3d-529e-4e03-ad86-fd0af47467ba"},
+				},
+			},
+			expected: "ca9a74cb-2d9f-4786-9bb0-094398c593a2",
+		},
+		{
+			name: "node on another host",
+			nodes: []*v1.Node{
+				{
+					ObjectMeta: metav1.ObjectMeta{
+						Name:   "ccm-other",
+						Labels: map[string]string{hostGroupLabel: "00000000-0000-0000-0000-000000000000"},
+					},
+					Spec: v1.NodeSpec{ProviderID: "vultr://ca9a74cb-2d9f-4786-9bb0-094398c593a2"},
+				},
+			},
+			expected: "0c51cc3d-529e-4e03-ad86-fd0af47467ba",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil).(*instancesv2)
+
+			informerFactory := informers.NewSharedInformerFactory(fake.NewClientset(), 0)
+			nodeInformer := informerFactory.Core().V1().Nodes()
+			for _, n := range test.nodes {
+				if err := nodeInformer.Informer().GetStore().Add(n); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			instances.setNodeLister(nodeInformer.Lister())
+
+			actual, err := instances.InstanceMetadata(context.TODO(), node)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if actual.AdditionalLabels[hostGroupLabel] != test.expected {
+				t.Errorf("expcted %+v got %+v", test.expected, actual.AdditionalLabels[hostGroupLabel])
+			}
+		})
+	}
+}
+
+// fakeNeighborsErrorInstance is a FakeInstance whose neighbors can not be looked up
+type fakeNeighborsErrorInstance struct {
+	FakeInstance
+	calls int
+}
+
+// GetNeighbors returns a server error
+func (f *fakeNeighborsErrorInstance) GetNeighbors(_ context.Context, _ string) (*govultr.Neighbors, *http.Response, error) {
+	f.calls++
+	return nil, nil, errors.New(`{"error":"internal error","status":500}`)
+}
+
+func TestInstancesV2_InstanceHostGroup_BestEffort(t *testing.T) {
+	fakeInstance := &fakeNeighborsErrorInstance{}
+	client := newFakeClient()
+	client.Instance = fakeInstance
+	instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil).(*instancesv2)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+	}
+	actual, err := instances.InstanceMetadata(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if group, ok := actual.AdditionalLabels[hostGroupLabel]; ok {
+		t.Errorf("expcted no host group got %+v", group)
+	}
+
+	// nodes which already have a group keep it without looking up the neighbors
+	node.Labels = map[string]string{hostGroupLabel: "ca9a74cb-2d9f-4786-9bb0-094398c593a2"}
+	actual, err = instances.InstanceMetadata(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if actual.AdditionalLabels[hostGroupLabel] != "ca9a74cb-2d9f-4786-9bb0-094398c593a2" {
+		t.Errorf("expcted %+v got %+v", "ca9a74cb-2d9f-4786-9bb0-094398c593a2", actual.AdditionalLabels[hostGroupLabel])
+	}
+	if fakeInstance.calls != 1 {
+		t.Errorf("expcted 1 neighbors lookup got %d", fakeInstance.calls)
+	}
+}
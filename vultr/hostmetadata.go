@@ -0,0 +1,69 @@
+package vultr
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/vultr/metadata"
+)
+
+// hostMeta is the metadata of the instance the CCM runs on, shared by every part of the provider
+var hostMeta = &hostMetadata{fetch: metadata.NewClient().Metadata}
+
+// hostMetadata resolves settings from the Vultr metadata service of the instance the CCM runs on.
+// It is only used for settings which are not configured, the metadata is requested once and
+// cached after it was retrieved successfully.
+type hostMetadata struct {
+	fetch func() (*metadata.MetaData, error)
+
+	mu   sync.Mutex
+	meta *metadata.MetaData
+}
+
+func (h *hostMetadata) get() (*metadata.MetaData, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.meta != nil {
+		return h.meta, nil
+	}
+
+	meta, err := h.fetch()
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve metadata: %v", err)
+	}
+
+	h.meta = meta
+	return meta, nil
+}
+
+// region returns the region code of the host
+func (h *hostMetadata) region() (string, error) {
+	meta, err := h.get()
+	if err != nil {
+		return "", err
+	}
+
+	if meta.Region.RegionCode == "" {
+		return "", fmt.Errorf("metadata did not include a region")
+	}
+
+	return strings.ToLower(meta.Region.RegionCode), nil
+}
+
+// vpcID returns the ID of the first VPC the host is attached to, empty if it is not attached to one
+func (h *hostMetadata) vpcID() (string, error) {
+	meta, err := h.get()
+	if err != nil {
+		return "", err
+	}
+
+	for _, v := range meta.Interfaces { //nolint
+		if v.NetworkV2ID != "" {
+			return v.NetworkV2ID, nil
+		}
+	}
+
+	return "", nil
+}
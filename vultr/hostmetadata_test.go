@@ -0,0 +1,41 @@
+package vultr
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vultr/metadata"
+)
+
+func TestHostMetadata_CachesSuccess(t *testing.T) {
+	calls := 0
+	fail := true
+	h := &hostMetadata{fetch: func() (*metadata.MetaData, error) {
+		calls++
+		if fail {
+			return nil, errors.New("metadata service unreachable")
+		}
+		meta := &metadata.MetaData{}
+		meta.Region.RegionCode = "EWR"
+		return meta, nil
+	}}
+
+	if _, err := h.region(); err == nil {
+		t.Fatal("expected error got nil")
+	}
+
+	fail = false
+	for range 2 {
+		region, err := h.region()
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if region != "ewr" {
+			t.Errorf("expcted %+v got %+v", "ewr", region)
+		}
+	}
+
+	if calls != 2 {
+		t.Errorf("expected failed lookup to be retried and success to be cached got %d calls", calls)
+	}
+}
@@ -175,7 +175,7 @@ func (i *instances) nodeAddresses(instance *govultr.Instance) ([]v1.NodeAddress,
 	return addresses, nil
 }
 
-// vultrIDFromProviderID returns a vultr instance ID from providerID.
+// vultrIDFromProviderID returns a vultr instance or bare metal ID from providerID.
 func vultrIDFromProviderID(providerID string) (string, error) {
 	if providerID == "" {
 		return "", fmt.Errorf("providerID cannot be an empty string")
@@ -189,7 +189,7 @@ func vultrIDFromProviderID(providerID string) (string, error) {
 	if split[0] != ProviderName {
 		return "", fmt.Errorf("provider scheme from providerID %q should be 'vultr://'", providerID)
 	}
-	return split[1], nil
+	return strings.TrimPrefix(split[1], bareMetalProviderIDPrefix), nil
 }
 
 // vultrByID returns a vultr instance for the given id.
@@ -6,18 +6,31 @@ import (
 	"fmt"
 	"log"
 	"reflect"
-	"strings"
 
 	"github.com/vultr/govultr/v3"
 	v1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/types"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/record"
 	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
 )
 
 var _ cloudprovider.InstancesV2 = &instancesv2{}
 
 type instancesv2 struct {
-	client *govultr.Client
+	client    *govultr.Client
+	inventory *inventory
+	kinds     *serverKindCache
+
+	addressCfg NodeAddressConfig
+	matchCfg   NodeMatchingConfig
+	// dnsTemplate is set when reverse DNS is enabled
+	dnsTemplate *reverseDNSTemplate
+	dnsNames    reverseDNSNames
+
+	// recorder and nodeLister are set once the cloud provider is initialized
+	recorder   record.EventRecorder
+	nodeLister corelisters.NodeLister
 }
 
 const (
@@ -26,53 +39,41 @@ const (
 	RESIZING = "resizing" //nolint
 )
 
-func newInstancesV2(client *govultr.Client) cloudprovider.InstancesV2 {
-	return &instancesv2{client}
+func newInstancesV2(client *govultr.Client, inv *inventory, addressCfg NodeAddressConfig, matchCfg NodeMatchingConfig, dnsTemplate *reverseDNSTemplate) cloudprovider.InstancesV2 {
+	return &instancesv2{
+		client:      client,
+		inventory:   inv,
+		kinds:       newServerKindCache(),
+		addressCfg:  addressCfg,
+		matchCfg:    matchCfg,
+		dnsTemplate: dnsTemplate,
+	}
+}
+
+// setEventRecorder sets the recorder used for node events
+func (i *instancesv2) setEventRecorder(recorder record.EventRecorder) {
+	i.recorder = recorder
 }
 
 // InstanceExists return bool whether the instance exists
 func (i *instancesv2) InstanceExists(ctx context.Context, node *v1.Node) (bool, error) {
-	bm := false
-
-	if label, ok := node.Labels["vultr.com/baremetal"]; ok {
-		if label == "true" {
-			bm = true
+	server, err := i.getVultrServer(ctx, node)
+	if err != nil {
+		log.Printf("node(%s) exists check failed: %e", node.Spec.ProviderID, err) //nolint
+		if isServerNotFound(err) {
+			return false, nil
 		}
+		return false, err
 	}
 
-	if bm {
-		newNode, err := i.getVultrBareMetal(ctx, node)
-		if err != nil {
-			log.Printf("baremetal(%s) exists check failed: %e", node.Spec.ProviderID, err) //nolint
-			if strings.Contains(err.Error(), "invalid baremetal ID") {
-				return false, nil
-			}
-			if strings.Contains(err.Error(), "baremetal not found") {
-				return false, nil
-			}
-			if strings.Contains(err.Error(), "Invalid server") {
-				return false, nil
-			}
-			return false, err
-		}
-		if newNode.Status == ACTIVE || newNode.Status == PENDING {
-			log.Printf("baremetal(%s) status is: %s", newNode.Label, newNode.Status) //nolint
+	if server.bareMetal != nil {
+		if server.bareMetal.Status == ACTIVE || server.bareMetal.Status == PENDING {
+			log.Printf("baremetal(%s) status is: %s", server.bareMetal.Label, server.bareMetal.Status) //nolint
 			return true, nil
 		}
 	} else {
-		newNode, err := i.getVultrInstance(ctx, node)
-		if err != nil {
-			log.Printf("instance(%s) exists check failed: %e", node.Spec.ProviderID, err) //nolint
-			if strings.Contains(err.Error(), "invalid instance ID") {
-				return false, nil
-			}
-			if strings.Contains(err.Error(), "instance not found") {
-				return false, nil
-			}
-			return false, err
-		}
-		if newNode.Status == ACTIVE || newNode.Status == PENDING || newNode.Status == RESIZING {
-			log.Printf("instance(%s) status is: %s", newNode.Label, newNode.Status) //nolint
+		if server.instance.Status == ACTIVE || server.instance.Status == PENDING || server.instance.Status == RESIZING {
+			log.Printf("instance(%s) status is: %s", server.instance.Label, server.instance.Status) //nolint
 			return true, nil
 		}
 	}
@@ -80,34 +81,52 @@ func (i *instancesv2) InstanceExists(ctx context.Context, node *v1.Node) (bool,
 	return false, nil
 }
 
-// InstanceShutdown returns bool whether the instance is running or powered off
+// InstanceShutdown returns bool whether the instance is running or powered off, or whether the bare metal server
+// is powered off. Bare metal servers which are being created, reinstalled or are locked are not reported as shut down.
 func (i *instancesv2) InstanceShutdown(ctx context.Context, node *v1.Node) (bool, error) {
-	bm := false
-
-	if label, ok := node.Labels["vultr.com/baremetal"]; ok {
-		if label == "true" {
-			bm = true
-		}
-	}
-
-	if bm {
-		newNode, err := i.getVultrBareMetal(ctx, node)
-		if err != nil {
-			log.Printf("baremetal(%s) shutdown check failed: %e", node.Spec.ProviderID, err) //nolint
-			return false, err
-		}
-		if newNode.Status == ACTIVE || newNode.Status == PENDING { //nolint
-			return false, nil
-		}
-	} else {
-		newNode, err := i.getVultrInstance(ctx, node)
+	// the power fields of a bare metal server are read with the server itself, so a known one is not looked up first
+	if i.nodeKind(node) == serverKindBareMetal && node.Spec.ProviderID != "" {
+		id, err := vultrIDFromProviderID(node.Spec.ProviderID)
 		if err != nil {
-			log.Printf("instance(%s) shutdown check failed: %e", node.Spec.ProviderID, err) //nolint
 			return false, err
 		}
-		if newNode.PowerStatus != "running" {
-			return true, nil
+		return i.bareMetalShutdown(ctx, node, id)
+	}
+
+	server, err := i.getVultrServer(ctx, node)
+	if err != nil {
+		log.Printf("node(%s) shutdown check failed: %e", node.Spec.ProviderID, err) //nolint
+		return false, err
+	}
+
+	if server.bareMetal != nil {
+		return i.bareMetalShutdown(ctx, node, server.bareMetal.ID)
+	}
+
+	return server.instance.PowerStatus != powerStatusRunning, nil
+}
+
+// bareMetalShutdown returns whether the bare metal server with the given ID is powered off
+func (i *instancesv2) bareMetalShutdown(ctx context.Context, node *v1.Node, id string) (bool, error) {
+	power, err := i.getBareMetalPowerInfo(ctx, id)
+	if err != nil {
+		if isServerNotFound(err) {
+			i.kinds.forget(id)
 		}
+		log.Printf("baremetal(%s) power state check failed: %e", id, err) //nolint
+		return false, err
+	}
+
+	status, powerStatus, serverStatus := power.Status, power.PowerStatus, power.ServerStatus
+	switch serverPowerState(status, powerStatus, serverStatus) {
+	case powerStateStopped:
+		return true, nil
+	case powerStateTransitioning:
+		klog.Infof("node %s is transitioning (status %q, power status %q, server status %q), not reporting it as shut down",
+			node.Name, status, powerStatus, serverStatus)
+	case powerStateUnknown:
+		klog.V(logLevelDebug).Infof("power state of node %s is unknown (status %q, power status %q, server status %q)",
+			node.Name, status, powerStatus, serverStatus)
 	}
 
 	return false, nil
@@ -115,50 +134,60 @@ func (i *instancesv2) InstanceShutdown(ctx context.Context, node *v1.Node) (bool
 
 // InstanceMetadata returns a struct of type InstanceMetadata containing the node information
 func (i *instancesv2) InstanceMetadata(ctx context.Context, node *v1.Node) (*cloudprovider.InstanceMetadata, error) {
-	bm := false
-
-	if label, ok := node.Labels["vultr.com/baremetal"]; ok {
-		if label == "true" {
-			bm = true
-		}
+	server, err := i.getVultrServer(ctx, node)
+	if err != nil {
+		log.Printf("node(%s) metadata check failed: %e", node.Spec.ProviderID, err) //nolint
+		return nil, err
 	}
 
-	if bm {
-		newNode, err := i.getVultrBareMetal(ctx, node)
-		if err != nil {
-			log.Printf("baremetal(%s) metadata check failed: %e", node.Spec.ProviderID, err) //nolint
-			return nil, err
-		}
-		nodeAddress, err := i.nodeBareMetalAddresses(newNode)
+	if server.bareMetal != nil {
+		newNode := server.bareMetal
+		nodeAddress, err := i.nodeBareMetalAddresses(ctx, node, newNode)
 		if err != nil {
 			return nil, err
 		}
 
+		labels := i.planLabels(ctx, serverKindBareMetal, newNode.Plan)
+		labels[bareMetalLabel] = "true"
+		// a bare metal server is a host of its own
+		labels[hostGroupLabel] = newNode.ID
+
+		zone := zoneForRegion(newNode.Region)
 		vultrNode := cloudprovider.InstanceMetadata{
-			InstanceType:  newNode.Plan,
-			ProviderID:    fmt.Sprintf("vultr://%s", newNode.ID),
-			Region:        newNode.Region,
-			NodeAddresses: nodeAddress,
+			InstanceType:     newNode.Plan,
+			ProviderID:       fmt.Sprintf("vultr://%s", newNode.ID),
+			Region:           zone.Region,
+			Zone:             zone.FailureDomain,
+			NodeAddresses:    nodeAddress,
+			AdditionalLabels: labels,
 		}
 
 		log.Printf("returned node metadata: %v", vultrNode) //nolint
 		return &vultrNode, nil
 	}
-	newNode, err := i.getVultrInstance(ctx, node)
+
+	newNode := server.instance
+	nodeAddress, err := i.nodeInstanceAddresses(ctx, node, newNode)
 	if err != nil {
-		log.Printf("instance(%s) metadata check failed: %e", node.Spec.ProviderID, err) //nolint
 		return nil, err
 	}
-	nodeAddress, err := i.nodeInstanceAddresses(newNode)
-	if err != nil {
-		return nil, err
+	nodeAddress = append(nodeAddress, i.reverseDNSAddresses(node)...)
+
+	labels := i.planLabels(ctx, serverKindInstance, newNode.Plan)
+	labels[bareMetalLabel] = "false"
+
+	if hostGroup := i.instanceHostGroup(ctx, node, newNode); hostGroup != "" {
+		labels[hostGroupLabel] = hostGroup
 	}
 
+	zone := zoneForRegion(newNode.Region)
 	vultrNode := cloudprovider.InstanceMetadata{
-		InstanceType:  newNode.Plan,
-		ProviderID:    fmt.Sprintf("vultr://%s", newNode.ID),
-		Region:        newNode.Region,
-		NodeAddresses: nodeAddress,
+		InstanceType:     newNode.Plan,
+		ProviderID:       fmt.Sprintf("vultr://%s", newNode.ID),
+		Region:           zone.Region,
+		Zone:             zone.FailureDomain,
+		NodeAddresses:    nodeAddress,
+		AdditionalLabels: labels,
 	}
 
 	log.Printf("returned node metadata: %v", vultrNode) //nolint
@@ -166,20 +195,53 @@ func (i *instancesv2) InstanceMetadata(ctx context.Context, node *v1.Node) (*clo
 }
 
 // nodeInstanceAddresses gathers public/private IP addresses and returns a []v1.NodeAddress .
-func (i *instancesv2) nodeInstanceAddresses(instance *govultr.Instance) ([]v1.NodeAddress, error) {
+// When the address policy of the node names a VPC its address is used as the InternalIP instead of the internal IP,
+// the addresses are ordered by the IP family policy of the node.
+func (i *instancesv2) nodeInstanceAddresses(ctx context.Context, node *v1.Node, instance *govultr.Instance) ([]v1.NodeAddress, error) {
 	var addresses []v1.NodeAddress
 
 	if reflect.DeepEqual(instance, *&govultr.Instance{}) { //nolint
 		return nil, fmt.Errorf("instance is empty %v", instance)
 	}
 
+	policy, err := i.addressPolicy(node)
+	if err != nil {
+		return nil, err
+	}
+
 	addresses = append(addresses, v1.NodeAddress{
 		Type:    v1.NodeHostName,
 		Address: instance.Label,
 	})
 
-	// Check conditions for internal and main IP
-	if instance.InternalIP == "" && instance.MainIP == "" {
+	if policy.internalVPC != "" {
+		vpcs, err := i.instanceVPCAddresses(ctx, instance.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		internal, err := i.vpcInternalAddresses(ctx, policy, vpcs)
+		if err != nil {
+			return nil, fmt.Errorf("instance %s: %w", instance.Label, err)
+		}
+		addresses = append(addresses, internal...)
+
+		// without a public IP the VPC address is reported as external IP like the internal IP below
+		externalIP := instance.MainIP
+		if externalIP == "" {
+			externalIP = internal[0].Address
+		}
+		addresses = append(addresses, v1.NodeAddress{Type: v1.NodeExternalIP, Address: externalIP})
+
+		if instance.V6MainIP != "" {
+			addresses = append(addresses, v1.NodeAddress{Type: v1.NodeExternalIP, Address: instance.V6MainIP}) // IPv6
+		}
+
+		return applyIPFamilyPolicy(addresses, policy.ipFamilyPolicy)
+	}
+
+	// Check conditions for internal and main IP, IPv6 only nodes don't need either
+	if instance.InternalIP == "" && instance.MainIP == "" && policy.ipFamilyPolicy != ipFamilyIPv6 {
 		return nil, fmt.Errorf("require at least one of internal or public IP")
 	}
 
@@ -207,7 +269,7 @@ func (i *instancesv2) nodeInstanceAddresses(instance *govultr.Instance) ([]v1.No
 		addresses = append(addresses, v1.NodeAddress{Type: v1.NodeExternalIP, Address: instance.V6MainIP}) // IPv6
 	}
 
-	return addresses, nil
+	return applyIPFamilyPolicy(addresses, policy.ipFamilyPolicy)
 }
 
 // getVultrInstance attempts to obtain Vultr Instance from Vultr API
@@ -225,16 +287,16 @@ func (i *instancesv2) getVultrInstance(ctx context.Context, node *v1.Node) (*gov
 			return nil, err
 		}
 
-		newNode, err := vultrByInstanceID(ctx, i.client, id)
+		newNode, err := i.inventory.instanceByID(ctx, id)
 		if err != nil {
 			log.Printf("instance(%s) by ID failed: %e", node.Spec.ProviderID, err) //nolint
 			return nil, err
 		}
 		return newNode, nil
 	}
-	newNode, err := vultrByInstanceName(ctx, i.client, types.NodeName(node.Name))
+	newNode, err := i.instanceForNode(ctx, node)
 	if err != nil {
-		log.Printf("instance(%s) by name failed: %e", node.Name, err) //nolint
+		log.Printf("instance(%s) match failed: %e", node.Name, err) //nolint
 		return nil, err
 	}
 	return newNode, nil
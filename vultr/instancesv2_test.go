@@ -0,0 +1,137 @@
+package vultr
+
+import (
+	"context"
+	"testing"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInstancesV2_InstanceMetadata(t *testing.T) {
+	client := newFakeClient()
+	instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+	}
+
+	actual, err := instances.InstanceMetadata(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actual.Region != "ewr" || actual.Zone != "ewr" {
+		t.Errorf("expected region and zone ewr got region %q zone %q", actual.Region, actual.Zone)
+	}
+	if actual.InstanceType != "vc2-4c-8gb" {
+		t.Errorf("expected instance type vc2-4c-8gb got %s", actual.InstanceType)
+	}
+}
+
+func TestInstancesV2_InstanceMetadata_BareMetal(t *testing.T) {
+	client := newFakeClient()
+	instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "ccm-test-bm",
+			Labels: map[string]string{"vultr.com/baremetal": "true"},
+		},
+		Spec: v1.NodeSpec{ProviderID: "vultr://cb676a46-66fd-4dfb-b839-443f2e6c0b60"},
+	}
+
+	actual, err := instances.InstanceMetadata(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actual.Region != "sjc" || actual.Zone != "sjc" {
+		t.Errorf("expected region and zone sjc got region %q zone %q", actual.Region, actual.Zone)
+	}
+	if actual.ProviderID != "vultr://cb676a46-66fd-4dfb-b839-443f2e6c0b60" {
+		t.Errorf("unexpected providerID %s", actual.ProviderID)
+	}
+}
+
+func TestInstancesV2_InstanceExists_NotFound(t *testing.T) {
+	client := &govultr.Client{
+		Instance:        &fakeMissingInstance{},
+		BareMetalServer: &fakeMissingBareMetalServer{},
+	}
+	instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+	}
+
+	exists, err := instances.InstanceExists(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exists {
+		t.Error("expected instance not to exist")
+	}
+}
+
+func TestInstancesV2_InstanceMetadata_DetectsBareMetal(t *testing.T) {
+	client := &govultr.Client{
+		Instance:        &fakeMissingInstance{},
+		BareMetalServer: &fakeBareMetalServer{},
+		Plan:            &fakePlan{},
+	}
+	instances := &instancesv2{client: client, inventory: newInventory(client, CacheConfig{}), kinds: newServerKindCache()}
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ccm-test-bm"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://cb676a46-66fd-4dfb-b839-443f2e6c0b60"},
+	}
+
+	actual, err := instances.InstanceMetadata(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actual.Region != "sjc" {
+		t.Errorf("expected region sjc got %q", actual.Region)
+	}
+	if actual.AdditionalLabels[bareMetalLabel] != "true" {
+		t.Errorf("expected label %s=true got %v", bareMetalLabel, actual.AdditionalLabels)
+	}
+	if kind := instances.kinds.get("cb676a46-66fd-4dfb-b839-443f2e6c0b60"); kind != serverKindBareMetal {
+		t.Errorf("expected bare metal kind to be cached got %d", kind)
+	}
+
+	// the server was deleted
+	client.BareMetalServer = &fakeMissingBareMetalServer{}
+	if _, err := instances.getVultrServer(context.TODO(), node); !isServerNotFound(err) {
+		t.Fatalf("expected server not found got %v", err)
+	}
+	if kind := instances.kinds.get("cb676a46-66fd-4dfb-b839-443f2e6c0b60"); kind != serverKindUnknown {
+		t.Errorf("expected the kind of the deleted server to be removed got %d", kind)
+	}
+}
+
+func TestInstancesV2_InstanceExists_BareMetalProviderID(t *testing.T) {
+	client := &govultr.Client{
+		Instance:        &fakeMissingInstance{},
+		BareMetalServer: &fakeBareMetalServer{},
+	}
+	instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ccm-test-bm"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://bm/cb676a46-66fd-4dfb-b839-443f2e6c0b60"},
+	}
+
+	exists, err := instances.InstanceExists(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !exists {
+		t.Error("expected bare metal server to exist")
+	}
+}
@@ -0,0 +1,603 @@
+package vultr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vultr/govultr/v3"
+	"golang.org/x/sync/singleflight"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// inventoryMissRefreshInterval is the minimum time between full listings caused by
+	// looking up a label which is not in the inventory
+	inventoryMissRefreshInterval = 15 * time.Second
+
+	inventoryPageSize = 300
+)
+
+// inventory is an in-memory copy of the instances, bare metal servers and load balancers in the account,
+// indexed by ID and label, and of the plans catalog. Kinds which have been looked up are listed again in the
+// background every TTL and single entries are refetched after the CCM changed them, so node and load balancer
+// lookups don't page through the whole account.
+type inventory struct {
+	instances     *inventoryStore[govultr.Instance]
+	bareMetals    *inventoryStore[govultr.BareMetalServer]
+	loadBalancers *inventoryStore[govultr.LoadBalancer]
+
+	// plans are indexed by ID as their label so a missing plan lists the catalog again
+	plans          *inventoryStore[govultr.Plan]
+	bareMetalPlans *inventoryStore[govultr.BareMetalPlan]
+
+	// vpcs are indexed by description as their label
+	vpcs *inventoryStore[govultr.VPC]
+}
+
+func newInventory(client *govultr.Client, cfg CacheConfig) *inventory {
+	return &inventory{
+		instances: &inventoryStore[govultr.Instance]{
+			kind: "instance",
+			ttl:  cfg.Instances,
+			list: func(ctx context.Context) ([]govultr.Instance, error) {
+				return listAll(ctx, func(ctx context.Context, opts *govultr.ListOptions) ([]govultr.Instance, *govultr.Meta, error) {
+					instances, meta, resp, err := client.Instance.List(ctx, opts) //nolint:bodyclose
+					return instances, meta, newAPIError(resp, err)
+				})
+			},
+			get: func(ctx context.Context, id string) (*govultr.Instance, error) {
+				instance, resp, err := client.Instance.Get(ctx, id) //nolint:bodyclose
+				return instance, newAPIError(resp, err)
+			},
+			keys: func(i *govultr.Instance) (string, string) {
+				return i.ID, i.Label
+			},
+			settled: func(i *govultr.Instance) bool {
+				return i.Status == ACTIVE
+			},
+		},
+		bareMetals: &inventoryStore[govultr.BareMetalServer]{
+			kind: "baremetal",
+			ttl:  cfg.BareMetal,
+			list: func(ctx context.Context) ([]govultr.BareMetalServer, error) {
+				return listAll(ctx, func(ctx context.Context, opts *govultr.ListOptions) ([]govultr.BareMetalServer, *govultr.Meta, error) {
+					bms, meta, resp, err := client.BareMetalServer.List(ctx, opts) //nolint:bodyclose
+					return bms, meta, newAPIError(resp, err)
+				})
+			},
+			get: func(ctx context.Context, id string) (*govultr.BareMetalServer, error) {
+				bm, resp, err := client.BareMetalServer.Get(ctx, id) //nolint:bodyclose
+				return bm, newAPIError(resp, err)
+			},
+			keys: func(bm *govultr.BareMetalServer) (string, string) {
+				return bm.ID, bm.Label
+			},
+			settled: func(bm *govultr.BareMetalServer) bool {
+				return bm.Status == ACTIVE
+			},
+		},
+		loadBalancers: &inventoryStore[govultr.LoadBalancer]{
+			kind: "load balancer",
+			ttl:  cfg.LoadBalancers,
+			list: func(ctx context.Context) ([]govultr.LoadBalancer, error) {
+				return listAll(ctx, func(ctx context.Context, opts *govultr.ListOptions) ([]govultr.LoadBalancer, *govultr.Meta, error) {
+					lbs, meta, resp, err := client.LoadBalancer.List(ctx, opts) //nolint:bodyclose
+					return lbs, meta, newAPIError(resp, err)
+				})
+			},
+			get: func(ctx context.Context, id string) (*govultr.LoadBalancer, error) {
+				lb, resp, err := client.LoadBalancer.Get(ctx, id) //nolint:bodyclose
+				return lb, newAPIError(resp, err)
+			},
+			keys: func(lb *govultr.LoadBalancer) (string, string) {
+				return lb.ID, lb.Label
+			},
+			settled: func(lb *govultr.LoadBalancer) bool {
+				return lb.Status == lbStatusActive
+			},
+		},
+		plans: &inventoryStore[govultr.Plan]{
+			kind: "plan",
+			ttl:  cfg.Plans,
+			list: func(ctx context.Context) ([]govultr.Plan, error) {
+				return listAll(ctx, func(ctx context.Context, opts *govultr.ListOptions) ([]govultr.Plan, *govultr.Meta, error) {
+					plans, meta, resp, err := client.Plan.List(ctx, "all", opts) //nolint:bodyclose
+					return plans, meta, newAPIError(resp, err)
+				})
+			},
+			keys: func(p *govultr.Plan) (string, string) {
+				return p.ID, p.ID
+			},
+			settled: func(_ *govultr.Plan) bool {
+				return true
+			},
+		},
+		bareMetalPlans: &inventoryStore[govultr.BareMetalPlan]{
+			kind: "baremetal plan",
+			ttl:  cfg.Plans,
+			list: func(ctx context.Context) ([]govultr.BareMetalPlan, error) {
+				return listAll(ctx, func(ctx context.Context, opts *govultr.ListOptions) ([]govultr.BareMetalPlan, *govultr.Meta, error) {
+					plans, meta, resp, err := client.Plan.ListBareMetal(ctx, opts) //nolint:bodyclose
+					return plans, meta, newAPIError(resp, err)
+				})
+			},
+			keys: func(p *govultr.BareMetalPlan) (string, string) {
+				return p.ID, p.ID
+			},
+			settled: func(_ *govultr.BareMetalPlan) bool {
+				return true
+			},
+		},
+		vpcs: &inventoryStore[govultr.VPC]{
+			kind: "vpc",
+			ttl:  cfg.VPCs,
+			list: func(ctx context.Context) ([]govultr.VPC, error) {
+				return listAll(ctx, func(ctx context.Context, opts *govultr.ListOptions) ([]govultr.VPC, *govultr.Meta, error) {
+					vpcs, meta, resp, err := client.VPC.List(ctx, opts) //nolint:bodyclose
+					return vpcs, meta, newAPIError(resp, err)
+				})
+			},
+			keys: func(vpc *govultr.VPC) (string, string) {
+				return vpc.ID, vpc.Description
+			},
+			settled: func(_ *govultr.VPC) bool {
+				return true
+			},
+		},
+	}
+}
+
+// run refreshes every kind which has been looked up once its TTL expired, until the context is done
+func (inv *inventory) run(ctx context.Context) {
+	for _, refresher := range []interface {
+		run(ctx context.Context)
+	}{inv.instances, inv.bareMetals, inv.loadBalancers, inv.plans, inv.bareMetalPlans, inv.vpcs} {
+		go refresher.run(ctx)
+	}
+	<-ctx.Done()
+}
+
+// instanceByID returns the instance with the given ID
+func (inv *inventory) instanceByID(ctx context.Context, id string) (*govultr.Instance, error) {
+	return inv.instances.byID(ctx, id)
+}
+
+// instanceByName returns the instance labeled with the node name.
+// Note that if multiple instances with the same name exist an error will be returned.
+func (inv *inventory) instanceByName(ctx context.Context, nodeName types.NodeName) (*govultr.Instance, error) {
+	instances, err := inv.instances.byLabel(ctx, string(nodeName))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(instances) == 0 {
+		return nil, cloudprovider.InstanceNotFound
+	} else if len(instances) > 1 {
+		return nil, fmt.Errorf("multiple instances found with name %v", nodeName)
+	}
+
+	return instances[0], nil
+}
+
+// instanceChanged makes the next lookup of the instance fetch it from the API
+func (inv *inventory) instanceChanged(id string) {
+	inv.instances.invalidate(id)
+}
+
+// bareMetalByID returns the bare metal server with the given ID
+func (inv *inventory) bareMetalByID(ctx context.Context, id string) (*govultr.BareMetalServer, error) {
+	return inv.bareMetals.byID(ctx, id)
+}
+
+// bareMetalByName returns the bare metal server labeled with the node name.
+// Note that if multiple bare metal servers with the same name exist an error will be returned.
+func (inv *inventory) bareMetalByName(ctx context.Context, nodeName types.NodeName) (*govultr.BareMetalServer, error) {
+	bms, err := inv.bareMetals.byLabel(ctx, string(nodeName))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(bms) == 0 {
+		return nil, cloudprovider.InstanceNotFound
+	} else if len(bms) > 1 {
+		return nil, fmt.Errorf("multiple baremetals found with name %v", nodeName)
+	}
+
+	return bms[0], nil
+}
+
+// instancesMatching returns every instance the match func accepts
+func (inv *inventory) instancesMatching(ctx context.Context, match func(instance *govultr.Instance) bool) ([]*govultr.Instance, error) {
+	return inv.instances.matching(ctx, match)
+}
+
+// bareMetalsMatching returns every bare metal server the match func accepts
+func (inv *inventory) bareMetalsMatching(ctx context.Context, match func(bm *govultr.BareMetalServer) bool) ([]*govultr.BareMetalServer, error) {
+	return inv.bareMetals.matching(ctx, match)
+}
+
+// lbByID returns the load balancer with the given ID
+func (inv *inventory) lbByID(ctx context.Context, id string) (*govultr.LoadBalancer, error) {
+	return inv.loadBalancers.byID(ctx, id)
+}
+
+// lbsByLabel returns every load balancer with the given label
+func (inv *inventory) lbsByLabel(ctx context.Context, label string) ([]*govultr.LoadBalancer, error) {
+	return inv.loadBalancers.byLabel(ctx, label)
+}
+
+// lbsMatching returns every load balancer the match func accepts
+func (inv *inventory) lbsMatching(ctx context.Context, match func(lb *govultr.LoadBalancer) bool) ([]*govultr.LoadBalancer, error) {
+	return inv.loadBalancers.matching(ctx, match)
+}
+
+// lbCreated adds a load balancer created by the CCM
+func (inv *inventory) lbCreated(lb *govultr.LoadBalancer) {
+	inv.loadBalancers.put(lb)
+}
+
+// lbChanged makes the next lookup of the load balancer fetch it from the API
+func (inv *inventory) lbChanged(id string) {
+	inv.loadBalancers.invalidate(id)
+}
+
+// lbDeleted removes a load balancer deleted by the CCM
+func (inv *inventory) lbDeleted(id string) {
+	inv.loadBalancers.remove(id)
+}
+
+// plan returns the instance plan with the given ID, nil if it is not in the catalog
+func (inv *inventory) plan(ctx context.Context, id string) (*govultr.Plan, error) {
+	plans, err := inv.plans.byLabel(ctx, id)
+	if err != nil || len(plans) == 0 {
+		return nil, err
+	}
+	return plans[0], nil
+}
+
+// bareMetalPlan returns the bare metal plan with the given ID, nil if it is not in the catalog
+func (inv *inventory) bareMetalPlan(ctx context.Context, id string) (*govultr.BareMetalPlan, error) {
+	plans, err := inv.bareMetalPlans.byLabel(ctx, id)
+	if err != nil || len(plans) == 0 {
+		return nil, err
+	}
+	return plans[0], nil
+}
+
+// vpcsByDescription returns every VPC with the given description
+func (inv *inventory) vpcsByDescription(ctx context.Context, description string) ([]*govultr.VPC, error) {
+	return inv.vpcs.byLabel(ctx, description)
+}
+
+// inventoryStore caches the items of a single kind
+type inventoryStore[T any] struct {
+	kind string
+	ttl  time.Duration
+
+	list func(ctx context.Context) ([]T, error)
+	// get fetches a single item, it may be nil for kinds which are never invalidated and always settled
+	get  func(ctx context.Context, id string) (*T, error)
+	keys func(item *T) (id, label string)
+	// settled reports whether an item is in a steady state, items which are not are always fetched again
+	settled func(item *T) bool
+
+	// refreshes lists the items at most once at a time, lookups waiting for a listing share its result
+	refreshes singleflight.Group
+
+	mu          sync.Mutex
+	items       map[string]*T
+	labels      map[string]map[string]struct{}
+	stale       map[string]struct{}
+	refreshedAt time.Time
+	// touched are the IDs changed while a listing is in flight, their state is kept when it completes
+	touched map[string]struct{}
+}
+
+// byID returns a copy of the item with the given ID, fetching it from the API if it is
+// missing, stale, not settled or the inventory expired
+func (s *inventoryStore[T]) byID(ctx context.Context, id string) (*T, error) {
+	s.mu.Lock()
+	item, ok := s.cachedLocked(id)
+	expired := s.expiredLocked()
+	s.mu.Unlock()
+
+	if ok && !expired {
+		return item, nil
+	}
+
+	return s.fetch(ctx, id)
+}
+
+// byLabel returns copies of every item with the given label, sorted by ID
+func (s *inventoryStore[T]) byLabel(ctx context.Context, label string) ([]*T, error) {
+	s.mu.Lock()
+	missing := len(s.labels[label]) == 0 && time.Since(s.refreshedAt) >= inventoryMissRefreshInterval
+	expired := s.expiredLocked()
+	s.mu.Unlock()
+
+	if expired || missing {
+		if err := s.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	ids := make([]string, 0, len(s.labels[label]))
+	for id := range s.labels[label] {
+		ids = append(ids, id)
+	}
+
+	return s.collectUnlock(ctx, ids, func(item *T) bool {
+		_, itemLabel := s.keys(item)
+		return itemLabel == label
+	})
+}
+
+// matching returns copies of every item the match func accepts, sorted by ID. Like byLabel the items
+// are listed again if none matches, at most once every inventoryMissRefreshInterval.
+func (s *inventoryStore[T]) matching(ctx context.Context, match func(item *T) bool) ([]*T, error) {
+	s.mu.Lock()
+	expired := s.expiredLocked()
+	s.mu.Unlock()
+
+	if expired {
+		if err := s.refresh(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	ids := s.matchingLocked(match)
+	if len(ids) == 0 && time.Since(s.refreshedAt) >= inventoryMissRefreshInterval {
+		s.mu.Unlock()
+		if err := s.refresh(ctx); err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		ids = s.matchingLocked(match)
+	}
+
+	return s.collectUnlock(ctx, ids, match)
+}
+
+func (s *inventoryStore[T]) matchingLocked(match func(item *T) bool) []string {
+	var ids []string
+	for id, item := range s.items {
+		if match(item) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// collectUnlock returns copies of the items with the given IDs sorted by ID and releases the lock.
+// Items which can not be served from the store are fetched again and kept if they still match.
+func (s *inventoryStore[T]) collectUnlock(ctx context.Context, ids []string, match func(item *T) bool) ([]*T, error) {
+	sort.Strings(ids)
+
+	var items []*T
+	var refetch []string
+	for _, id := range ids {
+		if item, ok := s.cachedLocked(id); ok {
+			items = append(items, item)
+		} else {
+			refetch = append(refetch, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, id := range refetch {
+		item, err := s.fetch(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if match(item) {
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// put adds or replaces an item
+func (s *inventoryStore[T]) put(item *T) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.putLocked(item)
+}
+
+// invalidate marks an item so the next lookup fetches it from the API
+func (s *inventoryStore[T]) invalidate(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[id]; ok {
+		s.stale[id] = struct{}{}
+		s.touchLocked(id)
+	}
+}
+
+// remove drops an item
+func (s *inventoryStore[T]) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeLocked(id)
+}
+
+// fetch gets a single item from the API and updates the store with the result
+func (s *inventoryStore[T]) fetch(ctx context.Context, id string) (*T, error) {
+	item, err := s.get(ctx, id)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.removeLocked(id)
+		return nil, err
+	}
+
+	s.putLocked(item)
+	copied := *item
+	return &copied, nil
+}
+
+func (s *inventoryStore[T]) expiredLocked() bool {
+	return s.items == nil || time.Since(s.refreshedAt) >= s.ttl
+}
+
+// cachedLocked returns a copy of the item if it can be served from the store
+func (s *inventoryStore[T]) cachedLocked(id string) (*T, bool) {
+	item, ok := s.items[id]
+	if !ok {
+		return nil, false
+	}
+
+	if _, stale := s.stale[id]; stale || !s.settled(item) {
+		return nil, false
+	}
+
+	copied := *item
+	return &copied, true
+}
+
+// run lists the items again every TTL once they have been looked up, so lookups rarely wait for a listing
+func (s *inventoryStore[T]) run(ctx context.Context) {
+	if s.ttl <= 0 {
+		return
+	}
+
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		s.mu.Lock()
+		used := s.items != nil
+		s.mu.Unlock()
+		if !used {
+			return
+		}
+
+		if err := s.refresh(ctx); err != nil {
+			klog.Errorf("failed to refresh %s inventory: %v", s.kind, err)
+		}
+	}, s.ttl)
+}
+
+// refresh lists the items without holding the lock, concurrent callers wait for the same listing
+func (s *inventoryStore[T]) refresh(ctx context.Context) error {
+	_, err, _ := s.refreshes.Do(s.kind, func() (interface{}, error) {
+		s.mu.Lock()
+		s.touched = make(map[string]struct{})
+		s.mu.Unlock()
+
+		items, err := s.list(ctx)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		touched := s.touched
+		s.touched = nil
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %ss: %w", s.kind, err)
+		}
+
+		// items changed while listing are newer than the listing
+		kept := make(map[string]*T, len(touched))
+		keptStale := make(map[string]struct{})
+		for id := range touched {
+			if item, ok := s.items[id]; ok {
+				kept[id] = item
+			}
+			if _, ok := s.stale[id]; ok {
+				keptStale[id] = struct{}{}
+			}
+		}
+
+		s.items = make(map[string]*T, len(items))
+		s.labels = make(map[string]map[string]struct{}, len(items))
+		s.stale = make(map[string]struct{})
+		for i := range items {
+			id, _ := s.keys(&items[i])
+			if _, ok := touched[id]; !ok {
+				s.putLocked(&items[i])
+			}
+		}
+		for _, item := range kept {
+			s.putLocked(item)
+		}
+		s.stale = keptStale
+		s.refreshedAt = time.Now()
+
+		klog.V(logLevelTrace).Infof("refreshed %s inventory with %d items", s.kind, len(items))
+		return nil, nil
+	})
+	return err
+}
+
+// touchLocked records a change of the item while a listing is in flight
+func (s *inventoryStore[T]) touchLocked(id string) {
+	if s.touched != nil {
+		s.touched[id] = struct{}{}
+	}
+}
+
+func (s *inventoryStore[T]) putLocked(item *T) {
+	if s.items == nil {
+		s.items = make(map[string]*T)
+		s.labels = make(map[string]map[string]struct{})
+		s.stale = make(map[string]struct{})
+	}
+
+	id, label := s.keys(item)
+	s.removeLocked(id)
+	s.touchLocked(id)
+
+	s.items[id] = item
+	if s.labels[label] == nil {
+		s.labels[label] = make(map[string]struct{})
+	}
+	s.labels[label][id] = struct{}{}
+}
+
+func (s *inventoryStore[T]) removeLocked(id string) {
+	item, ok := s.items[id]
+	if !ok {
+		return
+	}
+
+	s.touchLocked(id)
+	_, label := s.keys(item)
+	delete(s.labels[label], id)
+	if len(s.labels[label]) == 0 {
+		delete(s.labels, label)
+	}
+	delete(s.items, id)
+	delete(s.stale, id)
+}
+
+// listAll pages through a Vultr list endpoint
+func listAll[T any](ctx context.Context, list func(ctx context.Context, opts *govultr.ListOptions) ([]T, *govultr.Meta, error)) ([]T, error) {
+	listOptions := &govultr.ListOptions{PerPage: inventoryPageSize}
+
+	var all []T
+	for {
+		items, meta, err := list(ctx, listOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		all = append(all, items...)
+
+		if meta == nil || meta.Links == nil || meta.Links.Next == "" {
+			break
+		}
+		listOptions.Cursor = meta.Links.Next
+	}
+
+	return all, nil
+}
@@ -0,0 +1,175 @@
+package vultr
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/vultr/govultr/v3"
+)
+
+type countingInstance struct {
+	FakeInstance
+	lists int
+}
+
+func (c *countingInstance) List(ctx context.Context, options *govultr.ListOptions) ([]govultr.Instance, *govultr.Meta, *http.Response, error) {
+	c.lists++
+	return c.FakeInstance.List(ctx, options)
+}
+
+type countingLB struct {
+	fakeLB
+	lists int
+	gets  int
+}
+
+func (c *countingLB) List(ctx context.Context, options *govultr.ListOptions) ([]govultr.LoadBalancer, *govultr.Meta, *http.Response, error) {
+	c.lists++
+	return c.fakeLB.List(ctx, options)
+}
+
+func (c *countingLB) Get(ctx context.Context, lbID string) (*govultr.LoadBalancer, *http.Response, error) {
+	c.gets++
+	return c.fakeLB.Get(ctx, lbID)
+}
+
+func TestInventory_InstanceByName(t *testing.T) {
+	for name, test := range map[string]struct {
+		ttl           time.Duration
+		expectedLists int
+	}{
+		"cached":  {ttl: time.Minute, expectedLists: 1},
+		"expired": {ttl: 0, expectedLists: 3},
+	} {
+		t.Run(name, func(t *testing.T) {
+			instances := &countingInstance{}
+			inv := newInventory(&govultr.Client{Instance: instances}, CacheConfig{Instances: test.ttl})
+
+			for range 3 {
+				instance, err := inv.instanceByName(context.Background(), "ccm-test")
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if instance.ID != "75b95d83-47e2-4c0f-b273-cc9ce2b456f8" {
+					t.Errorf("expcted %+v got %+v", "75b95d83-47e2-4c0f-b273-cc9ce2b456f8", instance.ID)
+				}
+			}
+
+			if instances.lists != test.expectedLists {
+				t.Errorf("expcted %+v lists got %+v", test.expectedLists, instances.lists)
+			}
+		})
+	}
+}
+
+func TestInventory_LoadBalancerInvalidation(t *testing.T) {
+	lbs := &countingLB{fakeLB: fakeLB{loadBalancers: []govultr.LoadBalancer{
+		{ID: "lb-1", Label: "albname", Status: lbStatusActive},
+		{ID: "lb-2", Label: "other", Status: lbStatusActive},
+	}}}
+	inv := newInventory(&govultr.Client{LoadBalancer: lbs}, CacheConfig{LoadBalancers: time.Minute})
+	ctx := context.Background()
+
+	if _, err := inv.lbsByLabel(ctx, "albname"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := inv.lbByID(ctx, "lb-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lbs.lists != 1 || lbs.gets != 0 {
+		t.Errorf("expected lookup to be served from a single listing got %d lists and %d gets", lbs.lists, lbs.gets)
+	}
+
+	inv.lbChanged("lb-1")
+	if _, err := inv.lbByID(ctx, "lb-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lbs.lists != 1 || lbs.gets != 1 {
+		t.Errorf("expected changed load balancer to be fetched by ID got %d lists and %d gets", lbs.lists, lbs.gets)
+	}
+
+	inv.lbDeleted("lb-2")
+	matches, err := inv.lbsByLabel(ctx, "other")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 0 {
+		t.Errorf("expected deleted load balancer to be removed got %+v", matches)
+	}
+
+	inv.lbCreated(&govultr.LoadBalancer{ID: "lb-3", Label: "created", Status: lbStatusActive})
+	matches, err = inv.lbsByLabel(ctx, "created")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(matches) != 1 || matches[0].ID != "lb-3" {
+		t.Errorf("expected created load balancer got %+v", matches)
+	}
+	if lbs.lists != 1 {
+		t.Errorf("expcted %+v lists got %+v", 1, lbs.lists)
+	}
+}
+
+func TestInventory_ByIDMissFetchesDirectly(t *testing.T) {
+	lbs := &countingLB{}
+	inv := newInventory(&govultr.Client{LoadBalancer: lbs}, CacheConfig{LoadBalancers: 0})
+
+	for range 2 {
+		if _, err := inv.lbByID(context.Background(), "6334f227-6d96-4cbd-9bcb-5be0759354fa"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if lbs.lists != 0 || lbs.gets != 2 {
+		t.Errorf("expected lookups by ID to be fetched directly got %d lists and %d gets", lbs.lists, lbs.gets)
+	}
+}
+
+// blockingInstance is a FakeInstance whose listings wait until released
+type blockingInstance struct {
+	countingInstance
+	listing chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingInstance) List(ctx context.Context, options *govultr.ListOptions) ([]govultr.Instance, *govultr.Meta, *http.Response, error) {
+	b.listing <- struct{}{}
+	<-b.release
+	return b.countingInstance.List(ctx, options)
+}
+
+func TestInventory_RefreshOutsideLock(t *testing.T) {
+	instances := &blockingInstance{listing: make(chan struct{}, 1), release: make(chan struct{})}
+	inv := newInventory(&govultr.Client{Instance: instances}, CacheConfig{Instances: time.Minute})
+	ctx := context.Background()
+
+	results := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := inv.instanceByName(ctx, "ccm-test")
+			results <- err
+		}()
+	}
+	<-instances.listing
+
+	// lookups by ID don't wait for the listing and changes made meanwhile are kept
+	inv.instances.put(&govultr.Instance{ID: "created", Label: "created", Status: ACTIVE})
+	if _, err := inv.instanceByID(ctx, "75b95d83-47e2-4c0f-b273-cc9ce2b456f8"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	close(instances.release)
+	for range 2 {
+		if err := <-results; err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if instances.lists != 1 {
+		t.Errorf("expcted %+v lists got %+v", 1, instances.lists)
+	}
+	if _, err := inv.instanceByName(ctx, "created"); err != nil {
+		t.Errorf("expected instance created during the listing to be kept got %v", err)
+	}
+}
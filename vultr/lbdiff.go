@@ -0,0 +1,322 @@
+package vultr
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/vultr/govultr/v3"
+	"k8s.io/klog/v2"
+)
+
+const (
+	lbFieldForwardingRules = "forwarding rules"
+	lbFieldSSLCertificate  = "ssl certificate"
+)
+
+// lbModel is the state of a load balancer normalized so the load balancer returned by the API and the
+// request built for a service compare equal when an update would not change anything. Fields the request
+// leaves unset are left as they are by the API, so they are unset in the model of the request and skipped.
+type lbModel struct {
+	label           string
+	instances       []string
+	nodes           int
+	healthCheck     *govultr.HealthCheck
+	forwardingRules []string
+	firewallRules   []string
+	algorithm       string
+	timeout         int
+	stickySession   *string
+	sslRedirect     *bool
+	proxyProtocol   *bool
+	http2           *bool
+	http3           *bool
+	vpc             *string
+	ssl             *bool
+	autoSSL         *string
+}
+
+// lbFieldChange is a field of a load balancer which differs between the actual and desired state
+type lbFieldChange struct {
+	field string
+	from  string
+	to    string
+}
+
+// lbDiff are the fields a request changes on a load balancer
+type lbDiff []lbFieldChange
+
+func (d lbDiff) fields() []string {
+	fields := make([]string, 0, len(d))
+	for _, change := range d {
+		fields = append(fields, change.field)
+	}
+	return fields
+}
+
+// onlyForwardingRules returns whether the forwarding rules are the only change, they can be synced without
+// an update of the whole load balancer
+func (d lbDiff) onlyForwardingRules() bool {
+	return len(d) == 1 && d[0].field == lbFieldForwardingRules
+}
+
+func (d lbDiff) String() string {
+	changes := make([]string, 0, len(d))
+	for _, change := range d {
+		if change.from == "" && change.to == "" {
+			changes = append(changes, change.field)
+			continue
+		}
+		changes = append(changes, fmt.Sprintf("%s: %s -> %s", change.field, change.from, change.to))
+	}
+	return strings.Join(changes, ", ")
+}
+
+// actualLBModel normalizes a load balancer returned by the API
+func actualLBModel(lb *govultr.LoadBalancer) *lbModel {
+	info := lb.GenericInfo
+	if info == nil {
+		info = &govultr.GenericInfo{}
+	}
+
+	m := &lbModel{
+		label:           lb.Label,
+		instances:       sortedStrings(lb.Instances),
+		nodes:           lb.Nodes,
+		healthCheck:     normalizeHealthCheck(lb.HealthCheck),
+		forwardingRules: forwardingRuleKeys(lb.ForwardingRules),
+		firewallRules:   firewallRuleKeys(lb.FirewallRules),
+		algorithm:       info.BalancingAlgorithm,
+		timeout:         info.Timeout,
+		stickySession:   govultr.StringToStringPtr(""),
+		sslRedirect:     govultr.BoolToBoolPtr(boolValue(info.SSLRedirect)),
+		proxyProtocol:   govultr.BoolToBoolPtr(boolValue(info.ProxyProtocol)),
+		http2:           govultr.BoolToBoolPtr(boolValue(lb.HTTP2)),
+		http3:           govultr.BoolToBoolPtr(boolValue(lb.HTTP3)),
+		vpc:             govultr.StringToStringPtr(info.VPC),
+		ssl:             govultr.BoolToBoolPtr(boolValue(lb.SSLInfo)),
+	}
+	if info.StickySessions != nil {
+		m.stickySession = govultr.StringToStringPtr(info.StickySessions.CookieName)
+	}
+	if lb.AutoSSL != nil {
+		m.autoSSL = govultr.StringToStringPtr(autoSSLDomain(lb.AutoSSL))
+	}
+	return m
+}
+
+// desiredLBModel normalizes a load balancer request
+func desiredLBModel(req *govultr.LoadBalancerReq) *lbModel {
+	m := &lbModel{
+		label:         req.Label,
+		nodes:         req.Nodes,
+		healthCheck:   normalizeHealthCheck(req.HealthCheck),
+		algorithm:     req.BalancingAlgorithm,
+		timeout:       req.Timeout,
+		sslRedirect:   req.SSLRedirect,
+		proxyProtocol: req.ProxyProtocol,
+		http2:         req.HTTP2,
+		http3:         req.HTTP3,
+		vpc:           req.VPC,
+	}
+	// an empty instance list is omitted from the request, the API keeps the attached instances
+	if len(req.Instances) > 0 {
+		m.instances = sortedStrings(req.Instances)
+	}
+	if req.ForwardingRules != nil {
+		m.forwardingRules = forwardingRuleKeys(req.ForwardingRules)
+	}
+	if req.FirewallRules != nil {
+		m.firewallRules = firewallRuleKeys(req.FirewallRules)
+	}
+	if req.StickySessions != nil {
+		m.stickySession = govultr.StringToStringPtr(req.StickySessions.CookieName)
+	}
+	// the API only reports whether there is a certificate, replacing it is tracked by the sslTracker
+	if req.SSL != nil {
+		m.ssl = govultr.BoolToBoolPtr(true)
+	}
+	if req.AutoSSL != nil {
+		m.autoSSL = govultr.StringToStringPtr(autoSSLDomain(req.AutoSSL))
+	}
+	return m
+}
+
+// diffLoadBalancer returns the fields of the load balancer the request changes
+func diffLoadBalancer(lb *govultr.LoadBalancer, req *govultr.LoadBalancerReq) lbDiff {
+	actual, desired := actualLBModel(lb), desiredLBModel(req)
+
+	var diff lbDiff
+	add := func(field string, differs bool, from, to interface{}) {
+		if differs {
+			diff = append(diff, lbFieldChange{field: field, from: formatLBValue(from), to: formatLBValue(to)})
+		}
+	}
+
+	add("label", desired.label != "" && desired.label != actual.label, actual.label, desired.label)
+	add("instances", desired.instances != nil && !equalStrings(actual.instances, desired.instances), actual.instances, desired.instances)
+	add("nodes", desired.nodes != 0 && desired.nodes != actual.nodes, actual.nodes, desired.nodes)
+	add("health check", desired.healthCheck != nil && (actual.healthCheck == nil || *actual.healthCheck != *desired.healthCheck),
+		actual.healthCheck, desired.healthCheck)
+	add(lbFieldForwardingRules, desired.forwardingRules != nil && !equalStrings(actual.forwardingRules, desired.forwardingRules),
+		actual.forwardingRules, desired.forwardingRules)
+	add("firewall rules", desired.firewallRules != nil && !equalStrings(actual.firewallRules, desired.firewallRules),
+		actual.firewallRules, desired.firewallRules)
+	add("algorithm", desired.algorithm != "" && desired.algorithm != actual.algorithm, actual.algorithm, desired.algorithm)
+	add("timeout", desired.timeout != 0 && desired.timeout != actual.timeout, actual.timeout, desired.timeout)
+	add("sticky sessions", changedString(actual.stickySession, desired.stickySession), actual.stickySession, desired.stickySession)
+	add("ssl redirect", changedBool(actual.sslRedirect, desired.sslRedirect), actual.sslRedirect, desired.sslRedirect)
+	add("proxy protocol", changedBool(actual.proxyProtocol, desired.proxyProtocol), actual.proxyProtocol, desired.proxyProtocol)
+	add("http2", changedBool(actual.http2, desired.http2), actual.http2, desired.http2)
+	add("http3", changedBool(actual.http3, desired.http3), actual.http3, desired.http3)
+	add("vpc", changedString(actual.vpc, desired.vpc), actual.vpc, desired.vpc)
+	add("ssl", changedBool(actual.ssl, desired.ssl), actual.ssl, desired.ssl)
+	add("auto ssl", changedString(actual.autoSSL, desired.autoSSL), actual.autoSSL, desired.autoSSL)
+
+	return diff
+}
+
+// syncForwardingRules deletes the forwarding rules of the load balancer which are not desired and creates the
+// missing ones, rules which are the same on both sides are left alone
+func (l *loadbalancers) syncForwardingRules(ctx context.Context, lb *govultr.LoadBalancer, desired []govultr.ForwardingRule) error {
+	defer l.inventory.lbChanged(lb.ID)
+
+	wanted := make(map[string]bool, len(desired))
+	for _, key := range forwardingRuleKeys(desired) {
+		wanted[key] = true
+	}
+
+	existing := make(map[string]bool, len(lb.ForwardingRules))
+	for _, rule := range lb.ForwardingRules {
+		key := forwardingRuleKey(rule)
+		if wanted[key] {
+			existing[key] = true
+			continue
+		}
+		// deleted first so a rule replacing it on the same frontend port can be created
+		if err := l.client.LoadBalancer.DeleteForwardingRule(ctx, lb.ID, rule.RuleID); err != nil {
+			return fmt.Errorf("failed to delete forwarding rule %s: %w", key, err)
+		}
+	}
+
+	for _, rule := range desired {
+		if existing[forwardingRuleKey(rule)] {
+			continue
+		}
+		if _, _, err := l.client.LoadBalancer.CreateForwardingRule(ctx, lb.ID, &rule); err != nil { //nolint:bodyclose
+			return fmt.Errorf("failed to create forwarding rule %s: %w", forwardingRuleKey(rule), err)
+		}
+	}
+
+	return nil
+}
+
+// logLBDiff logs the changes of an update
+func logLBDiff(lbID string, diff lbDiff) {
+	if len(diff) == 0 {
+		klog.V(logLevelDebug).Infof("load balancer %s is up to date, skipping update", lbID)
+		return
+	}
+	klog.Infof("updating load balancer %s: %s", lbID, diff)
+}
+
+// normalizeHealthCheck lowercases the protocol and drops the path of health checks which don't use it
+func normalizeHealthCheck(healthCheck *govultr.HealthCheck) *govultr.HealthCheck {
+	if healthCheck == nil {
+		return nil
+	}
+	hc := *healthCheck
+	hc.Protocol = strings.ToLower(hc.Protocol)
+	if hc.Protocol != protocolHTTP && hc.Protocol != protocolHTTPS {
+		hc.Path = ""
+	} else if hc.Path == "" {
+		hc.Path = "/"
+	}
+	return &hc
+}
+
+func forwardingRuleKey(rule govultr.ForwardingRule) string {
+	return fmt.Sprintf("%s->%s/%d", forwardingRuleFrontendKey(rule), strings.ToLower(rule.BackendProtocol), rule.BackendPort)
+}
+
+func forwardingRuleKeys(rules []govultr.ForwardingRule) []string {
+	keys := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		keys = append(keys, forwardingRuleKey(rule))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func firewallRuleKeys(rules []govultr.LBFirewallRule) []string {
+	keys := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		keys = append(keys, fmt.Sprintf("%s:%d/%s", rule.Source, rule.Port, rule.IPType))
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func autoSSLDomain(autoSSL *govultr.AutoSSL) string {
+	return strings.TrimPrefix(autoSSL.DomainSub+"."+autoSSL.DomainZone, ".")
+}
+
+func sortedStrings(s []string) []string {
+	sorted := append([]string{}, s...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// changedBool returns whether the desired value is set and differs, unset desired values are not changed
+func changedBool(actual, desired *bool) bool {
+	return desired != nil && boolValue(actual) != *desired
+}
+
+// changedString returns whether the desired value is set and differs, unset desired values are not changed
+func changedString(actual, desired *string) bool {
+	if desired == nil {
+		return false
+	}
+	return actual == nil || *actual != *desired
+}
+
+func boolValue(b *bool) bool {
+	return b != nil && *b
+}
+
+func formatLBValue(value interface{}) string {
+	switch v := value.(type) {
+	case []string:
+		return "[" + strings.Join(v, " ") + "]"
+	case *string:
+		if v == nil {
+			return "<unset>"
+		}
+		return strconv.Quote(*v)
+	case *bool:
+		if v == nil {
+			return "<unset>"
+		}
+		return strconv.FormatBool(*v)
+	case *govultr.HealthCheck:
+		if v == nil {
+			return "<unset>"
+		}
+		return fmt.Sprintf("%+v", *v)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,142 @@
+package vultr
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDiffLoadBalancer(t *testing.T) {
+	lb := &govultr.LoadBalancer{
+		Label:     "lb-name",
+		Instances: []string{"b", "a"},
+		Nodes:     1,
+		HealthCheck: &govultr.HealthCheck{
+			Protocol: "TCP", Port: 30080, CheckInterval: 15, ResponseTimeout: 5, UnhealthyThreshold: 5, HealthyThreshold: 5,
+		},
+		ForwardingRules: []govultr.ForwardingRule{
+			{RuleID: "1", FrontendProtocol: "tcp", FrontendPort: 80, BackendProtocol: "tcp", BackendPort: 30080},
+		},
+		GenericInfo: &govultr.GenericInfo{BalancingAlgorithm: algorithmRoundRobin, Timeout: 600},
+	}
+
+	req := &govultr.LoadBalancerReq{
+		Label:     "lb-name",
+		Instances: []string{"a", "b"},
+		Nodes:     1,
+		HealthCheck: &govultr.HealthCheck{
+			Protocol: "tcp", Port: 30080, CheckInterval: 15, ResponseTimeout: 5, UnhealthyThreshold: 5, HealthyThreshold: 5,
+		},
+		ForwardingRules: []govultr.ForwardingRule{
+			{FrontendProtocol: "tcp", FrontendPort: 80, BackendProtocol: "tcp", BackendPort: 30080},
+		},
+		FirewallRules:      []govultr.LBFirewallRule{},
+		StickySessions:     &govultr.StickySessions{},
+		BalancingAlgorithm: algorithmRoundRobin,
+		Timeout:            600,
+		SSLRedirect:        govultr.BoolToBoolPtr(false),
+		ProxyProtocol:      govultr.BoolToBoolPtr(false),
+		HTTP2:              govultr.BoolToBoolPtr(false),
+		HTTP3:              govultr.BoolToBoolPtr(false),
+		VPC:                govultr.StringToStringPtr(""),
+	}
+
+	if changed := diffLoadBalancer(lb, req).fields(); len(changed) != 0 {
+		t.Errorf("expcted no changes got %+v", changed)
+	}
+
+	req.Instances = []string{"a"}
+	req.BalancingAlgorithm = algorithmLeastConnections
+	req.ProxyProtocol = govultr.BoolToBoolPtr(true)
+	req.ForwardingRules[0].BackendPort = 30081
+
+	expected := []string{"instances", "forwarding rules", "algorithm", "proxy protocol"}
+	if changed := diffLoadBalancer(lb, req).fields(); !reflect.DeepEqual(changed, expected) {
+		t.Errorf("expcted %+v got %+v", expected, changed)
+	}
+}
+
+func TestLoadbalancers_UpdateLoadBalancer_SkipsNoop(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "lb-name",
+			Namespace:   v1.NamespaceDefault,
+			UID:         "lb-name",
+			Annotations: map[string]string{annoVultrLoadBalancerID: "6334f227-6d96-4cbd-9bcb-5be0759354fa"},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "test", Protocol: "TCP", Port: 80, NodePort: 8080}},
+		},
+	}
+	nodes := []*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://123"},
+	}}
+
+	tests := []struct {
+		name            string
+		forwardingRules []govultr.ForwardingRule
+		expectUpdate    bool
+		expectCreated   int
+		expectDeleted   []string
+	}{
+		{
+			name:            "unchanged",
+			forwardingRules: []govultr.ForwardingRule{{RuleID: "rule-80", FrontendProtocol: "tcp", FrontendPort: 80, BackendProtocol: "tcp", BackendPort: 8080}},
+		},
+		{
+			name:            "forwarding rules changed",
+			forwardingRules: []govultr.ForwardingRule{{RuleID: "rule-80", FrontendProtocol: "tcp", FrontendPort: 80, BackendProtocol: "tcp", BackendPort: 30080}},
+			expectCreated:   1,
+			expectDeleted:   []string{"rule-80"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{}).(*loadbalancers)
+			setFakeKubeClient(t, lb, svc)
+
+			req, err := lb.buildLoadBalancerRequest(context.Background(), svc, nodes)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			fakeLoadBalancer := client.LoadBalancer.(*fakeLB)
+			fakeLoadBalancer.loadBalancers = []govultr.LoadBalancer{{
+				ID:              "6334f227-6d96-4cbd-9bcb-5be0759354fa",
+				Label:           req.Label,
+				Status:          lbStatusActive,
+				Instances:       req.Instances,
+				Nodes:           req.Nodes,
+				HealthCheck:     req.HealthCheck,
+				ForwardingRules: test.forwardingRules,
+				FirewallRules:   req.FirewallRules,
+				GenericInfo: &govultr.GenericInfo{
+					BalancingAlgorithm: req.BalancingAlgorithm,
+					Timeout:            req.Timeout,
+					StickySessions:     req.StickySessions,
+				},
+			}}
+
+			if err := lb.UpdateLoadBalancer(context.Background(), "cluster-name", svc, nodes); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if (fakeLoadBalancer.updatedReq != nil) != test.expectUpdate {
+				t.Errorf("expcted update %v got %+v", test.expectUpdate, fakeLoadBalancer.updatedReq)
+			}
+			if len(fakeLoadBalancer.createdRules) != test.expectCreated {
+				t.Errorf("expcted %d created rules got %+v", test.expectCreated, fakeLoadBalancer.createdRules)
+			}
+			if !reflect.DeepEqual(fakeLoadBalancer.deletedRules, test.expectDeleted) {
+				t.Errorf("expcted deleted rules %+v got %+v", test.expectDeleted, fakeLoadBalancer.deletedRules)
+			}
+		})
+	}
+}
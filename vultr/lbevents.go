@@ -0,0 +1,110 @@
+package vultr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"sync"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+)
+
+// reasons of the load balancer lifecycle events recorded on services
+const (
+	eventReasonLBCreated         = "LoadBalancerCreated"
+	eventReasonLBActivating      = "LoadBalancerActivating"
+	eventReasonLBUpdated         = "LoadBalancerUpdated"
+	eventReasonLBRetryStarted    = "LoadBalancerRetryStarted"
+	eventReasonLBRetrySucceeded  = "LoadBalancerRetrySucceeded"
+	eventReasonLBRetryFailed     = "LoadBalancerRetryFailed"
+	eventReasonLBSSLApplied      = "SSLApplied"
+	eventReasonLBDeletionBlocked = "LoadBalancerDeletionBlocked"
+	eventReasonLBDeleted         = "LoadBalancerDeleted"
+	eventReasonLBNoBackendNodes  = "LoadBalancerNoBackendNodes"
+	eventReasonLBAdoptionBlocked = "LoadBalancerAdoptionBlocked"
+)
+
+// event records an event on the service, it is a no-op until the cloud provider is initialized
+func (l *loadbalancers) event(service *v1.Service, eventType, reason, messageFmt string, args ...interface{}) {
+	if l.recorder == nil {
+		return
+	}
+	l.recorder.Eventf(service, eventType, reason, messageFmt, args...)
+}
+
+// sslTracker keeps a fingerprint of the certificate last applied to each load balancer, so SSLApplied is only
+// recorded when a certificate is added or rotated rather than on every update. After a restart it is
+// recorded once more for every load balancer with SSL.
+type sslTracker struct {
+	mu           sync.Mutex
+	fingerprints map[string]string
+}
+
+// changed returns whether the SSL of the request differs from the SSL last applied to the load balancer
+func (t *sslTracker) changed(lbID string, req *govultr.LoadBalancerReq) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fingerprint := sslFingerprint(req)
+	return fingerprint != "" && t.fingerprints[lbID] != fingerprint
+}
+
+// applied stores the fingerprint of the SSL of the request and returns whether it differs from the last one
+func (t *sslTracker) applied(lbID string, req *govultr.LoadBalancerReq) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	fingerprint := sslFingerprint(req)
+	if fingerprint == "" {
+		delete(t.fingerprints, lbID)
+		return false
+	}
+
+	if t.fingerprints == nil {
+		t.fingerprints = make(map[string]string)
+	}
+	if t.fingerprints[lbID] == fingerprint {
+		return false
+	}
+	t.fingerprints[lbID] = fingerprint
+	return true
+}
+
+// sslFingerprint returns a hash of the certificate and auto SSL domain of the request, empty without SSL
+func sslFingerprint(req *govultr.LoadBalancerReq) string {
+	if req.SSL == nil && req.AutoSSL == nil {
+		return ""
+	}
+
+	hash := sha256.New()
+	if req.SSL != nil {
+		hash.Write([]byte(req.SSL.Certificate))
+	}
+	if req.AutoSSL != nil {
+		hash.Write([]byte(req.AutoSSL.DomainZone + "\x00" + req.AutoSSL.DomainSub))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (t *sslTracker) forget(lbID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.fingerprints, lbID)
+}
+
+// recordSSLApplied records an event when the request adds or rotates the SSL of the load balancer
+func (l *loadbalancers) recordSSLApplied(service *v1.Service, lbID string, req *govultr.LoadBalancerReq) {
+	if !l.sslCerts.applied(lbID, req) {
+		return
+	}
+
+	if req.AutoSSL != nil {
+		l.event(service, v1.EventTypeNormal, eventReasonLBSSLApplied, "Applied auto SSL for %s to load balancer %s",
+			strings.TrimPrefix(req.AutoSSL.DomainSub+"."+req.AutoSSL.DomainZone, "."), lbID)
+		return
+	}
+	l.event(service, v1.EventTypeNormal, eventReasonLBSSLApplied, "Applied the certificate of secret %s to load balancer %s",
+		service.Annotations[annoVultrLBSSL], lbID)
+}
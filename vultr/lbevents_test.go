@@ -0,0 +1,61 @@
+package vultr
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestLoadbalancers_LifecycleEvents(t *testing.T) {
+	client := newFakeClient()
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{}).(*loadbalancers)
+	recorder := record.NewFakeRecorder(10)
+	lb.setEventRecorder(recorder)
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "lb-name",
+			Namespace:   v1.NamespaceDefault,
+			UID:         "lb-name",
+			Annotations: map[string]string{annoVultrLoadBalancerID: "6334f227-6d96-4cbd-9bcb-5be0759354fa"},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{{Name: "test", Protocol: "TCP", Port: 80, NodePort: 8080}},
+		},
+	}
+	setFakeKubeClient(t, lb, svc)
+
+	nodes := []*v1.Node{{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://123"},
+	}}
+
+	if _, err := lb.EnsureLoadBalancer(context.Background(), "cluster-name", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := lb.EnsureLoadBalancerDeleted(context.Background(), "cluster-name", svc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var events []string
+	for len(recorder.Events) > 0 {
+		events = append(events, <-recorder.Events)
+	}
+
+	expected := []string{
+		"Normal " + eventReasonLBUpdated + " Updated load balancer 6334f227-6d96-4cbd-9bcb-5be0759354fa: changed instances,",
+		"Normal " + eventReasonLBDeleted + " Deleted load balancer 6334f227-6d96-4cbd-9bcb-5be0759354fa",
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expcted %+v got %+v", expected, events)
+	}
+	for i := range expected {
+		if !strings.HasPrefix(events[i], expected[i]) {
+			t.Errorf("expcted %q got %q", expected[i], events[i])
+		}
+	}
+}
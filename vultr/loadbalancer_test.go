@@ -2,20 +2,27 @@ package vultr
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/vultr/govultr/v3"
+	"github.com/vultr/metadata"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
 )
 
 func TestLoadbalancers_GetLoadBalancer(t *testing.T) {
 	client := newFakeClient()
 
-	lb := newLoadbalancers(client, "ewr")
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "ewr", &CloudConfig{})
 
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -63,7 +70,7 @@ func TestLoadbalancers_GetLoadBalancer(t *testing.T) {
 func TestLoadbalancers_GetLoadBalancerName(t *testing.T) {
 	client := newFakeClient()
 
-	lb := newLoadbalancers(client, "1")
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{})
 
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -95,9 +102,7 @@ func TestLoadbalancers_GetLoadBalancerName(t *testing.T) {
 
 func TestLoadbalancers_EnsureLoadBalancer(t *testing.T) {
 	client := newFakeClient()
-	lb := newLoadbalancers(client, "1")
-
-	lb.(*loadbalancers).kubeClient = &fake.Clientset{}
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{})
 
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -121,6 +126,8 @@ func TestLoadbalancers_EnsureLoadBalancer(t *testing.T) {
 			},
 		},
 	}
+	setFakeKubeClient(t, lb.(*loadbalancers), svc)
+
 	expected := &v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{
 		{
 			IP:       "192.168.0.1",
@@ -161,7 +168,7 @@ func TestLoadbalancers_EnsureLoadBalancer(t *testing.T) {
 
 func TestLoadbalancers_UpdateLoadBalancer(t *testing.T) {
 	client := newFakeClient()
-	lb := newLoadbalancers(client, "1")
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{})
 
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -210,19 +217,21 @@ func TestLoadbalancers_UpdateLoadBalancer(t *testing.T) {
 }
 
 func TestLoadbalancers_BuildLoadBalancerRequest_FirewallRulesConfigMap(t *testing.T) {
+	client := &govultr.Client{LoadBalancer: &fakeLB{}}
 	lb := &loadbalancers{
-		client: &govultr.Client{LoadBalancer: &fakeLB{}},
-		zone:   "ewr",
-		kubeClient: fake.NewClientset(&v1.ConfigMap{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      "lb-firewall-rules",
-				Namespace: v1.NamespaceDefault,
-			},
-			Data: map[string]string{
-				firewallRulesCMKey: "v4:\n- source: 192.168.1.1/16\n  port: 80\nv6:\n- source: cloudflare\n  port: 443\n",
-			},
-		}),
+		client:    client,
+		inventory: newInventory(client, CacheConfig{}),
+		zone:      "ewr",
 	}
+	setFakeKubeClient(t, lb, &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lb-firewall-rules",
+			Namespace: v1.NamespaceDefault,
+		},
+		Data: map[string]string{
+			firewallRulesCMKey: "v4:\n- source: 192.168.1.1/16\n  port: 80\nv6:\n- source: cloudflare\n  port: 443\n",
+		},
+	})
 
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -268,7 +277,7 @@ func TestLoadbalancers_BuildLoadBalancerRequest_FirewallRulesConfigMap(t *testin
 
 func TestLoadbalancers_EnsureLoadBalancerDeleted(t *testing.T) {
 	client := newFakeClient()
-	lb := newLoadbalancers(client, "1")
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{})
 
 	svc := &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -378,9 +387,11 @@ func testSharedLabelMergeForwardingRules(t *testing.T, annotations map[string]st
 	fakeLoadBalancer := &fakeLB{
 		forwardingRules: []govultr.ForwardingRule{existingRule},
 	}
+	client := &govultr.Client{LoadBalancer: fakeLoadBalancer}
 	lb := &loadbalancers{
-		client: &govultr.Client{LoadBalancer: fakeLoadBalancer},
-		zone:   "ewr",
+		client:    client,
+		inventory: newInventory(client, CacheConfig{}),
+		zone:      "ewr",
 	}
 	svcAnnotations := map[string]string{
 		annoVultrLoadBalancerID:    "6334f227-6d96-4cbd-9bcb-5be0759354fa",
@@ -451,11 +462,13 @@ func TestLoadbalancers_EnsureLoadBalancerDeleted_SharedLabelRemovesOnlyServiceRu
 			},
 		},
 	}
+	client := &govultr.Client{LoadBalancer: fakeLoadBalancer}
 	lb := &loadbalancers{
-		client:     &govultr.Client{LoadBalancer: fakeLoadBalancer},
-		zone:       "ewr",
-		kubeClient: fake.NewClientset(sharedLabelService("shared-service-b", "shared-service-b", 50002, 30002)),
+		client:    client,
+		inventory: newInventory(client, CacheConfig{}),
+		zone:      "ewr",
 	}
+	setFakeKubeClient(t, lb, sharedLabelService("shared-service-b", "shared-service-b", 50002, 30002))
 
 	deletingService := sharedLabelService("shared-service-a", "shared-service-a", 50001, 30001)
 	err := lb.EnsureLoadBalancerDeleted(context.Background(), "cluster-name", deletingService)
@@ -473,11 +486,13 @@ func TestLoadbalancers_EnsureLoadBalancerDeleted_SharedLabelRemovesOnlyServiceRu
 
 func TestLoadbalancers_EnsureLoadBalancerDeleted_SharedLabelDeletesLBWhenLastReference(t *testing.T) {
 	fakeLoadBalancer := &fakeLB{}
+	client := &govultr.Client{LoadBalancer: fakeLoadBalancer}
 	lb := &loadbalancers{
-		client:     &govultr.Client{LoadBalancer: fakeLoadBalancer},
-		zone:       "ewr",
-		kubeClient: fake.NewClientset(),
+		client:    client,
+		inventory: newInventory(client, CacheConfig{}),
+		zone:      "ewr",
 	}
+	setFakeKubeClient(t, lb)
 
 	deletingService := sharedLabelService("shared-service-a", "shared-service-a", 50001, 30001)
 	err := lb.EnsureLoadBalancerDeleted(context.Background(), "cluster-name", deletingService)
@@ -493,6 +508,20 @@ func TestLoadbalancers_EnsureLoadBalancerDeleted_SharedLabelDeletesLBWhenLastRef
 	}
 }
 
+// setFakeKubeClient wires a fake kube client holding objects into the load balancers and waits for the informers to sync
+func setFakeKubeClient(t *testing.T, l *loadbalancers, objects ...runtime.Object) {
+	t.Helper()
+
+	kubeClient := fake.NewClientset(objects...)
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+	l.setKubeClient(kubeClient, informerFactory)
+
+	stop := make(chan struct{})
+	t.Cleanup(func() { close(stop) })
+	informerFactory.Start(stop)
+	informerFactory.WaitForCacheSync(stop)
+}
+
 func sharedLabelService(name, uid string, port, nodePort int32) *v1.Service {
 	return &v1.Service{
 		ObjectMeta: metav1.ObjectMeta{
@@ -521,3 +550,260 @@ func sharedLabelService(name, uid string, port, nodePort int32) *v1.Service {
 func typesUID(uid string) types.UID {
 	return types.UID(uid)
 }
+
+func TestLoadbalancers_BuildLoadBalancerRequest_DefaultAnnotations(t *testing.T) {
+	client := &govultr.Client{LoadBalancer: &fakeLB{}}
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "ewr", &CloudConfig{
+		LoadBalancer: LoadBalancerConfig{
+			DefaultAnnotations: map[string]string{
+				annoVultrAlgorithm: "least_connections",
+				annoVultrLBTimeout: "120",
+			},
+		},
+	}).(*loadbalancers)
+
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lb-name",
+			Namespace: v1.NamespaceDefault,
+			UID:       "lb-name",
+			Annotations: map[string]string{
+				annoVultrLBTimeout: "300",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Ports: []v1.ServicePort{
+				{
+					Name:     "test",
+					Protocol: "TCP",
+					Port:     int32(80),
+					NodePort: int32(30080),
+				},
+			},
+		},
+	}
+
+	req, err := lb.buildLoadBalancerRequest(context.Background(), lb.withDefaultAnnotations(svc), nil)
+	if err != nil {
+		t.Fatalf("expected nil got %s", err.Error())
+	}
+
+	if req.BalancingAlgorithm != "leastconn" {
+		t.Errorf("expected default algorithm leastconn got %s", req.BalancingAlgorithm)
+	}
+	if req.Timeout != 300 {
+		t.Errorf("expected service timeout annotation to win over default got %d", req.Timeout)
+	}
+	if _, ok := svc.Annotations[annoVultrAlgorithm]; ok {
+		t.Error("expected default annotations to not modify the original service")
+	}
+}
+
+func TestLoadbalancers_ClusterIDOwnership(t *testing.T) {
+	fakeLoadBalancer := &fakeLB{
+		loadBalancers: []govultr.LoadBalancer{
+			{ID: "legacy", Label: "albname", Status: lbStatusActive},
+			{ID: "owned", Label: "albname.prod", Status: lbStatusActive},
+			{ID: "foreign", Label: "albname.staging", Status: lbStatusActive},
+		},
+	}
+	client := &govultr.Client{LoadBalancer: fakeLoadBalancer}
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "ewr", &CloudConfig{ClusterID: "prod"}).(*loadbalancers)
+
+	svc := func(id string) *v1.Service {
+		annotations := map[string]string{}
+		if id != "" {
+			annotations[annoVultrLoadBalancerID] = id
+		}
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "lb-name",
+				Namespace:   v1.NamespaceDefault,
+				UID:         "lb-name",
+				Annotations: annotations,
+			},
+			Spec: v1.ServiceSpec{
+				Ports: []v1.ServicePort{{Name: "test", Protocol: "TCP", Port: 80, NodePort: 30080}},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name       string
+		id         string
+		expectedID string
+		expected   error
+	}{
+		{name: "by name only matches owned label", expectedID: "owned"},
+		{name: "by id owned", id: "owned", expectedID: "owned"},
+		{name: "by id adopts legacy label", id: "legacy", expectedID: "legacy"},
+		{name: "by id rejects other cluster", id: "foreign", expected: errLbNotOwned},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := lb.getVultrLB(context.Background(), svc(tc.id))
+			if err != tc.expected {
+				t.Fatalf("expected error %v got %v", tc.expected, err)
+			}
+			if tc.expected == nil && actual.ID != tc.expectedID {
+				t.Errorf("expected load balancer %s got %s", tc.expectedID, actual.ID)
+			}
+		})
+	}
+
+	req, err := lb.buildLoadBalancerRequest(context.Background(), svc(""), nil)
+	if err != nil {
+		t.Fatalf("expected nil got %s", err.Error())
+	}
+	if req.Label != "albname.prod" {
+		t.Errorf("expected label to be scoped to the cluster got %s", req.Label)
+	}
+
+	if err := lb.EnsureLoadBalancerDeleted(context.Background(), "cluster-name", svc("foreign")); err != nil {
+		t.Fatalf("expected nil got %s", err.Error())
+	}
+	if fakeLoadBalancer.deletedLB {
+		t.Error("expected load balancer owned by another cluster to not be deleted")
+	}
+}
+
+// fakeCreateCountingLB counts the load balancers created
+type fakeCreateCountingLB struct {
+	*fakeLB
+	creates int
+}
+
+func (f *fakeCreateCountingLB) Create(ctx context.Context, req *govultr.LoadBalancerReq) (*govultr.LoadBalancer, *http.Response, error) {
+	f.creates++
+	return f.fakeLB.Create(ctx, req)
+}
+
+func TestLoadbalancers_ClusterIDLegacyAdoption(t *testing.T) {
+	svc := func(label string) *v1.Service {
+		annotations := map[string]string{}
+		if label != "" {
+			annotations[annoVultrLoadBalancerLabel] = label
+		}
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "lb-name",
+				Namespace:   v1.NamespaceDefault,
+				UID:         "lb-name",
+				Annotations: annotations,
+			},
+			Spec: v1.ServiceSpec{
+				Type:  v1.ServiceTypeLoadBalancer,
+				Ports: []v1.ServicePort{{Name: "test", Protocol: "TCP", Port: 80, NodePort: 30080}},
+			},
+		}
+	}
+
+	t.Run("named after the service UID", func(t *testing.T) {
+		client := &govultr.Client{LoadBalancer: &fakeLB{
+			loadBalancers: []govultr.LoadBalancer{{ID: "legacy", Label: "albname", Status: lbStatusActive}},
+		}}
+		lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "ewr", &CloudConfig{ClusterID: "prod"}).(*loadbalancers)
+
+		actual, err := lb.getVultrLB(context.Background(), svc(""))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if actual.ID != "legacy" {
+			t.Errorf("expected load balancer legacy to be adopted got %s", actual.ID)
+		}
+	})
+
+	t.Run("label from annotations", func(t *testing.T) {
+		fakeLoadBalancer := &fakeCreateCountingLB{fakeLB: &fakeLB{
+			loadBalancers: []govultr.LoadBalancer{{ID: "legacy", Label: "web", Status: lbStatusActive}},
+		}}
+		client := &govultr.Client{LoadBalancer: fakeLoadBalancer}
+		lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "ewr", &CloudConfig{ClusterID: "prod"}).(*loadbalancers)
+		recorder := record.NewFakeRecorder(10)
+		lb.setEventRecorder(recorder)
+
+		service := svc("web")
+		if _, err := lb.EnsureLoadBalancer(context.Background(), "cluster-name", service, nil); !isLegacyLB(err) {
+			t.Fatalf("expected the legacy load balancer to be refused got %v", err)
+		}
+		if fakeLoadBalancer.creates != 0 {
+			t.Errorf("expected no duplicate load balancer to be created got %d", fakeLoadBalancer.creates)
+		}
+
+		select {
+		case event := <-recorder.Events:
+			if !strings.HasPrefix(event, v1.EventTypeWarning+" "+eventReasonLBAdoptionBlocked+" ") {
+				t.Errorf("expected %s warning got %q", eventReasonLBAdoptionBlocked, event)
+			}
+		default:
+			t.Errorf("expected %s warning got none", eventReasonLBAdoptionBlocked)
+		}
+	})
+}
+
+func TestLoadbalancers_ManagedLBIDs(t *testing.T) {
+	client := &govultr.Client{LoadBalancer: &fakeLB{
+		loadBalancers: []govultr.LoadBalancer{
+			{ID: "owned", Label: "albname.prod", Status: lbStatusActive},
+			{ID: "foreign", Label: "albname.staging", Status: lbStatusActive},
+			{ID: "unreferenced", Label: "other.prod", Status: lbStatusActive},
+		},
+	}}
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "ewr", &CloudConfig{ClusterID: "prod"}).(*loadbalancers)
+
+	service := func(name, id string, serviceType v1.ServiceType) *v1.Service {
+		return &v1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   v1.NamespaceDefault,
+				Annotations: map[string]string{annoVultrLoadBalancerID: id},
+			},
+			Spec: v1.ServiceSpec{Type: serviceType},
+		}
+	}
+	setFakeKubeClient(t, lb,
+		service("owned", "owned", v1.ServiceTypeLoadBalancer),
+		service("foreign", "foreign", v1.ServiceTypeLoadBalancer),
+		service("deleted", "deleted", v1.ServiceTypeLoadBalancer),
+		service("cluster-ip", "unreferenced", v1.ServiceTypeClusterIP),
+	)
+
+	actual, err := lb.managedLBIDs(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []string{"owned"}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expcted %+v got %+v", expected, actual)
+	}
+}
+
+func TestLoadbalancers_GetVPC(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lb-name",
+			Namespace: v1.NamespaceDefault,
+			Annotations: map[string]string{
+				annoVultrVPC: "true",
+			},
+		},
+	}
+
+	unreachable := &hostMetadata{fetch: func() (*metadata.MetaData, error) {
+		return nil, errors.New("metadata service unreachable")
+	}}
+
+	configured := &loadbalancers{vpcID: "9c7f4a36-3e52-4c3e-9d3f-2a0ad7a3bb11", metadata: unreachable}
+	vpc, err := configured.getVPC(svc)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if vpc != "9c7f4a36-3e52-4c3e-9d3f-2a0ad7a3bb11" {
+		t.Errorf("expcted %+v got %+v", "9c7f4a36-3e52-4c3e-9d3f-2a0ad7a3bb11", vpc)
+	}
+
+	unconfigured := &loadbalancers{metadata: unreachable}
+	if _, err := unconfigured.getVPC(svc); err == nil {
+		t.Error("expected error when no VPC is configured and metadata is unreachable got nil")
+	}
+}
@@ -7,20 +7,24 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/asaskevich/govalidator"
 	"github.com/vultr/govultr/v3"
-	"github.com/vultr/metadata"
 	"go.yaml.in/yaml/v3"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	discoverylisters "k8s.io/client-go/listers/discovery/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 	cloudprovider "k8s.io/cloud-provider"
 	"k8s.io/klog/v2"
 )
@@ -94,6 +98,21 @@ const (
 	// annoVultrLBSSLLastUpdatedTime is used to keep track of when a SVC is updated due to the SSL secret being updated
 	annoVultrLBSSLLastUpdatedTime = "service.beta.kubernetes.io/vultr-loadbalancer-ssl-last-updated"
 
+	// annoVultrLBEndpointNodesOnly only attaches nodes hosting ready endpoints to services with externalTrafficPolicy Local
+	annoVultrLBEndpointNodesOnly = "service.beta.kubernetes.io/vultr-loadbalancer-endpoint-nodes-only"
+
+	// annoVultrLBEndpointsLastUpdatedTime is used to keep track of when a SVC is updated due to the nodes hosting its endpoints changing
+	annoVultrLBEndpointsLastUpdatedTime = "service.beta.kubernetes.io/vultr-loadbalancer-endpoints-last-updated"
+
+	// annoVultrLBNodeSelector is a label selector restricting the nodes attached to the load balancer
+	annoVultrLBNodeSelector = "service.beta.kubernetes.io/vultr-loadbalancer-node-selector"
+
+	// annoVultrLBAllowEmptyBackends allows the node selector to match no node, which leaves the load balancer without backends
+	annoVultrLBAllowEmptyBackends = "service.beta.kubernetes.io/vultr-loadbalancer-allow-empty-backends"
+
+	// annoVultrLBNodesLastUpdatedTime is used to keep track of when a SVC is updated due to node labels matching its node selector changing
+	annoVultrLBNodesLastUpdatedTime = "service.beta.kubernetes.io/vultr-loadbalancer-nodes-last-updated"
+
 	// Supported Protocols
 	protocolHTTP  = "http"
 	protocolHTTPS = "https"
@@ -110,6 +129,9 @@ const (
 	syncTimeout = 10
 
 	lbStatusActive = "active"
+
+	// clusterIDSeparator separates the load balancer name from the owning cluster ID in the Vultr label
+	clusterIDSeparator = "."
 )
 
 const (
@@ -119,13 +141,57 @@ const (
 )
 
 var errLbNotFound = fmt.Errorf("loadbalancer not found")
+var errLbNotOwned = fmt.Errorf("loadbalancer is not owned by this cluster")
+var errKubeClientNotInitialized = fmt.Errorf("kube client has not been initialized")
 var _ cloudprovider.LoadBalancer = &loadbalancers{}
 
-type loadbalancers struct {
-	client *govultr.Client
-	zone   string
+// legacyLBError is returned when a load balancer created before a cluster ID was configured carries a label
+// chosen through annotations, it could belong to any cluster in the account so it is not adopted
+type legacyLBError struct {
+	id    string
+	label string
+}
+
+func (e *legacyLBError) Error() string {
+	return fmt.Sprintf("load balancer %s with label %q has no cluster ID and may belong to another cluster, "+
+		"set the %s annotation to its ID to adopt it", e.id, e.label, annoVultrLoadBalancerID)
+}
 
-	kubeClient kubernetes.Interface
+// isLegacyLB returns whether the lookup found a load balancer without a cluster ID which was not adopted
+func isLegacyLB(err error) bool {
+	var legacyErr *legacyLBError
+	return errors.As(err, &legacyErr)
+}
+
+type loadbalancers struct {
+	client    *govultr.Client
+	inventory *inventory
+	zone      string
+
+	// defaultAnnotations are set on services which do not define the annotation themselves
+	defaultAnnotations map[string]string
+	// vpcID is used instead of the metadata VPC when a service requests a VPC
+	vpcID string
+	// metadata is only used to look up the VPC when no vpcID is configured
+	metadata    *hostMetadata
+	syncTimeout time.Duration
+	// clusterID is appended to the label of every load balancer created by this cluster
+	clusterID string
+
+	kubeClient          kubernetes.Interface
+	serviceLister       corelisters.ServiceLister
+	secretLister        corelisters.SecretLister
+	configMapLister     corelisters.ConfigMapLister
+	endpointSliceLister discoverylisters.EndpointSliceLister
+	// recorder reports annotation problems and the lifecycle of load balancers as service events,
+	// it is set once the cloud provider is initialized
+	recorder         record.EventRecorder
+	sslCerts         sslTracker
+	endpointNodeSets endpointNodeTracker
+	// endpointQueue holds the keys of services whose endpoint slices changed
+	endpointQueue workqueue.TypedRateLimitingInterface[string]
+	// nodeSelectorQueue holds the keys of services whose node selector matches a relabeled node differently
+	nodeSelectorQueue workqueue.TypedRateLimitingInterface[string]
 }
 
 // LBIDValidationError represents an error that occurs during load balancer ID validation
@@ -139,14 +205,45 @@ func (e *LBIDValidationError) Error() string {
 	return e.Message
 }
 
-func newLoadbalancers(client *govultr.Client, zone string) cloudprovider.LoadBalancer {
-	return &loadbalancers{client: client, zone: zone}
+func newLoadbalancers(client *govultr.Client, inv *inventory, zone string, cfg *CloudConfig) cloudprovider.LoadBalancer {
+	return &loadbalancers{
+		client:             client,
+		inventory:          inv,
+		zone:               zone,
+		defaultAnnotations: cfg.LoadBalancer.DefaultAnnotations,
+		vpcID:              cfg.VPCID,
+		metadata:           hostMeta,
+		syncTimeout:        cfg.Timeouts.LoadBalancerSync,
+		clusterID:          cfg.ClusterID,
+	}
+}
+
+// withDefaultAnnotations returns a copy of the service with the configured default annotations
+// applied to any annotation which the service does not set itself
+func (l *loadbalancers) withDefaultAnnotations(service *v1.Service) *v1.Service {
+	if len(l.defaultAnnotations) == 0 {
+		return service
+	}
+
+	svc := service.DeepCopy()
+	if svc.Annotations == nil {
+		svc.Annotations = map[string]string{}
+	}
+
+	for key, value := range l.defaultAnnotations {
+		if _, ok := svc.Annotations[key]; !ok {
+			svc.Annotations[key] = value
+		}
+	}
+
+	return svc
 }
 
 func (l *loadbalancers) GetLoadBalancer(ctx context.Context, _ string, service *v1.Service) (status *v1.LoadBalancerStatus, exists bool, err error) {
+	service = l.withDefaultAnnotations(service)
 	lb, err := l.getVultrLB(ctx, service)
 	if err != nil {
-		if err == errLbNotFound {
+		if err == errLbNotFound || err == errLbNotOwned || isLegacyLB(err) {
 			return nil, false, nil
 		}
 		return nil, false, err
@@ -182,6 +279,7 @@ func (l *loadbalancers) GetLoadBalancer(ctx context.Context, _ string, service *
 }
 
 func (l *loadbalancers) GetLoadBalancerName(_ context.Context, _ string, service *v1.Service) string {
+	service = l.withDefaultAnnotations(service)
 	if label, ok := service.Annotations[annoVultrLoadBalancerLabel]; ok {
 		return label
 	}
@@ -193,11 +291,16 @@ func getDefaultLBName(service *v1.Service) string {
 }
 
 func (l *loadbalancers) EnsureLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
+	service = l.withDefaultAnnotations(service)
+
+	annotations, problems := parseLBAnnotations(service)
 	// Check if creation is disabled
-	if create, ok := service.Annotations[annoVultrLoadBalancerCreate]; ok {
-		if strings.EqualFold(create, "false") {
-			return nil, cloudprovider.ImplementedElsewhere
-		}
+	if !annotations.create {
+		return nil, cloudprovider.ImplementedElsewhere
+	}
+	problems.record(l.recorder, service)
+	if err := problems.err(); err != nil {
+		return nil, err
 	}
 
 	lb, err := l.getVultrLB(ctx, service)
@@ -206,6 +309,14 @@ func (l *loadbalancers) EnsureLoadBalancer(ctx context.Context, clusterName stri
 			// LoadBalancer has ID but cannot be found
 			return nil, fmt.Errorf("load balancer ID %q for service '%s/%s' not found", id, service.Namespace, service.Name)
 		}
+		if err == errLbNotOwned {
+			return nil, fmt.Errorf("load balancer ID %q for service '%s/%s' is not owned by cluster %q",
+				service.Annotations[annoVultrLoadBalancerID], service.Namespace, service.Name, l.clusterID)
+		}
+		if isLegacyLB(err) {
+			l.event(service, v1.EventTypeWarning, eventReasonLBAdoptionBlocked, "Not creating a load balancer: %s", err)
+			return nil, err
+		}
 		if err == errLbNotFound {
 			// Load balancer doesn't exist, create new one
 			return l.createNewLoadBalancer(ctx, clusterName, service, nodes)
@@ -216,6 +327,7 @@ func (l *loadbalancers) EnsureLoadBalancer(ctx context.Context, clusterName stri
 	// Load balancer exists
 	klog.Infof("Load balancer exists for cluster %q", clusterName)
 	klog.Infof("Found load balancer: %q", lb.Label)
+	managedLBs.add(lb.ID)
 
 	// Set and validate the Vultr VLB ID annotation
 	if setErr := l.setAndValidateLBIDAnnotation(ctx, service, lb.ID); setErr != nil {
@@ -223,6 +335,7 @@ func (l *loadbalancers) EnsureLoadBalancer(ctx context.Context, clusterName stri
 	}
 
 	if lb.Status != lbStatusActive {
+		l.event(service, v1.EventTypeNormal, eventReasonLBActivating, "Waiting for load balancer %s to become active, current status: %s", lb.ID, lb.Status)
 		return nil, fmt.Errorf("load-balancer is not yet active - current status: %s", lb.Status)
 	}
 
@@ -246,6 +359,13 @@ func (l *loadbalancers) EnsureLoadBalancer(ctx context.Context, clusterName stri
 
 func (l *loadbalancers) UpdateLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) error {
 	klog.V(3).Info("Called UpdateLoadBalancers")
+	service = l.withDefaultAnnotations(service)
+
+	_, problems := parseLBAnnotations(service)
+	problems.record(l.recorder, service)
+	if err := problems.err(); err != nil {
+		return err
+	}
 
 	// Single call to get the load balancer
 	lb, err := l.getVultrLB(ctx, service)
@@ -257,9 +377,10 @@ func (l *loadbalancers) UpdateLoadBalancer(ctx context.Context, clusterName stri
 }
 
 func (l *loadbalancers) updateLoadBalancerWithLB(ctx context.Context, _ string, service *v1.Service, nodes []*v1.Node, lb *govultr.LoadBalancer) error {
+	key := service.Namespace + "/" + service.Name
 	// Set the Vultr VLB ID annotation if not present
 	if _, ok := service.Annotations[annoVultrLoadBalancerID]; !ok {
-		if err := l.GetKubeClient(); err != nil {
+		if err := l.kubeClientReady(); err != nil {
 			return fmt.Errorf("failed to get kubeclient to update service: %s", err)
 		}
 
@@ -286,6 +407,7 @@ func (l *loadbalancers) updateLoadBalancerWithLB(ctx context.Context, _ string,
 
 	lbReq, err := l.buildLoadBalancerRequest(ctx, service, nodes)
 	if err != nil {
+		l.endpointNodeSets.failed(key)
 		return fmt.Errorf("failed to create load balancer request: %s", err)
 	}
 	sharedLB := hasSharedLoadBalancerLabel(service)
@@ -293,9 +415,33 @@ func (l *loadbalancers) updateLoadBalancerWithLB(ctx context.Context, _ string,
 		lbReq.ForwardingRules = nil
 	}
 
-	if err := l.client.LoadBalancer.Update(ctx, lb.ID, lbReq); err != nil {
-		return fmt.Errorf("failed to update LB: %s", err)
+	// only send an update when the load balancer differs, every update can briefly disturb it
+	diff := diffLoadBalancer(lb, lbReq)
+	if l.sslCerts.changed(lb.ID, lbReq) {
+		diff = append(diff, lbFieldChange{field: lbFieldSSLCertificate})
 	}
+	logLBDiff(lb.ID, diff)
+
+	switch {
+	case len(diff) == 0:
+	case diff.onlyForwardingRules():
+		if err := l.syncForwardingRules(ctx, lb, lbReq.ForwardingRules); err != nil {
+			l.endpointNodeSets.failed(key)
+			return fmt.Errorf("failed to update LB forwarding rules: %w", err)
+		}
+	default:
+		err = l.client.LoadBalancer.Update(ctx, lb.ID, lbReq)
+		l.inventory.lbChanged(lb.ID)
+		if err != nil {
+			l.endpointNodeSets.failed(key)
+			return fmt.Errorf("failed to update LB: %w", err)
+		}
+	}
+	l.endpointNodeSets.attached(key)
+	if len(diff) > 0 {
+		l.event(service, v1.EventTypeNormal, eventReasonLBUpdated, "Updated load balancer %s: changed %s", lb.ID, strings.Join(diff.fields(), ", "))
+	}
+	l.recordSSLApplied(service, lb.ID, lbReq)
 
 	if sharedLB {
 		if err := l.reconcileSharedForwardingRules(ctx, lb.ID, service); err != nil {
@@ -307,11 +453,22 @@ func (l *loadbalancers) updateLoadBalancerWithLB(ctx context.Context, _ string,
 }
 
 func (l *loadbalancers) EnsureLoadBalancerDeleted(ctx context.Context, _ string, service *v1.Service) error {
+	service = l.withDefaultAnnotations(service)
 	lb, err := l.getVultrLB(ctx, service)
 	if err != nil {
 		if err == errLbNotFound {
 			return nil // Already deleted or doesn't exist
 		}
+		if err == errLbNotOwned {
+			klog.Warningf("Not deleting load balancer for service %s/%s: %s", service.Namespace, service.Name, err)
+			l.event(service, v1.EventTypeWarning, eventReasonLBDeletionBlocked, "Not deleting load balancer %s: %s", service.Annotations[annoVultrLoadBalancerID], err)
+			return nil
+		}
+		if isLegacyLB(err) {
+			klog.Warningf("Not deleting load balancer for service %s/%s: %s", service.Namespace, service.Name, err)
+			l.event(service, v1.EventTypeWarning, eventReasonLBDeletionBlocked, "Not deleting load balancer: %s", err)
+			return nil
+		}
 		return err
 	}
 
@@ -322,7 +479,13 @@ func (l *loadbalancers) EnsureLoadBalancerDeleted(ctx context.Context, _ string,
 		}
 
 		if referenced {
-			return l.deleteServiceForwardingRules(ctx, lb.ID, service)
+			if err := l.deleteServiceForwardingRules(ctx, lb.ID, service); err != nil {
+				return err
+			}
+			l.event(service, v1.EventTypeNormal, eventReasonLBDeletionBlocked,
+				"Load balancer %s is still used by other services with label %q, removed the forwarding rules of this service only",
+				lb.ID, service.Annotations[annoVultrLoadBalancerLabel])
+			return nil
 		}
 	}
 
@@ -330,6 +493,10 @@ func (l *loadbalancers) EnsureLoadBalancerDeleted(ctx context.Context, _ string,
 	if err != nil {
 		return err
 	}
+	l.inventory.lbDeleted(lb.ID)
+	managedLBs.remove(lb.ID)
+	l.sslCerts.forget(lb.ID)
+	l.event(service, v1.EventTypeNormal, eventReasonLBDeleted, "Deleted load balancer %s", lb.ID)
 
 	return nil
 }
@@ -340,6 +507,8 @@ func hasSharedLoadBalancerLabel(service *v1.Service) bool {
 }
 
 func (l *loadbalancers) reconcileSharedForwardingRules(ctx context.Context, lbID string, service *v1.Service) error {
+	defer l.inventory.lbChanged(lbID)
+
 	desiredRules, err := buildForwardingRules(service)
 	if err != nil {
 		return err
@@ -380,6 +549,8 @@ func (l *loadbalancers) reconcileSharedForwardingRules(ctx context.Context, lbID
 }
 
 func (l *loadbalancers) deleteServiceForwardingRules(ctx context.Context, lbID string, service *v1.Service) error {
+	defer l.inventory.lbChanged(lbID)
+
 	desiredRules, err := buildForwardingRules(service)
 	if err != nil {
 		return err
@@ -446,17 +617,16 @@ func forwardingRulesEqual(a, b govultr.ForwardingRule) bool {
 
 func (l *loadbalancers) sharedLoadBalancerStillReferenced(ctx context.Context, service *v1.Service, lbID string) (bool, error) {
 	label := service.Annotations[annoVultrLoadBalancerLabel]
-	if err := l.GetKubeClient(); err != nil {
+	if err := l.kubeClientReady(); err != nil {
 		return false, fmt.Errorf("failed to get kubeclient: %s", err)
 	}
 
-	services, err := l.kubeClient.CoreV1().Services(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	services, err := l.serviceLister.List(labels.Everything())
 	if err != nil {
 		return false, fmt.Errorf("failed to list services referencing shared load balancer label %q: %s", label, err)
 	}
 
-	for i := range services.Items {
-		candidate := &services.Items[i]
+	for _, candidate := range services {
 		if sameService(candidate, service) {
 			continue
 		}
@@ -483,21 +653,30 @@ func sameService(a, b *v1.Service) bool {
 
 func (l *loadbalancers) createNewLoadBalancer(ctx context.Context, clusterName string, service *v1.Service, nodes []*v1.Node) (*v1.LoadBalancerStatus, error) {
 	klog.Infof("Load balancer for cluster %q doesn't exist, creating", clusterName)
+	key := service.Namespace + "/" + service.Name
 	lbReq, err := l.buildLoadBalancerRequest(ctx, service, nodes)
 	if err != nil {
+		l.endpointNodeSets.failed(key)
 		return nil, err
 	}
 	lbReq.Region = l.zone
 	lb, _, err := l.client.LoadBalancer.Create(ctx, lbReq) //nolint:bodyclose
 	if err != nil {
+		l.endpointNodeSets.failed(key)
 		return nil, fmt.Errorf("failed to create load-balancer: %s", err)
 	}
+	l.endpointNodeSets.attached(key)
 	klog.Infof("Created load balancer %q", lb.ID)
+	l.inventory.lbCreated(lb)
+	managedLBs.add(lb.ID)
+	l.event(service, v1.EventTypeNormal, eventReasonLBCreated, "Created load balancer %s in %s", lb.ID, l.zone)
+	l.recordSSLApplied(service, lb.ID, lbReq)
 	// Set and validate the Vultr VLB ID annotation
 	if err := l.setAndValidateLBIDAnnotation(ctx, service, lb.ID); err != nil {
 		return nil, err
 	}
 	if lb.Status != lbStatusActive {
+		l.event(service, v1.EventTypeNormal, eventReasonLBActivating, "Waiting for load balancer %s to become active, current status: %s", lb.ID, lb.Status)
 		return nil, fmt.Errorf("load-balancer is not yet active - current status: %s", lb.Status)
 	}
 
@@ -535,14 +714,17 @@ func (l *loadbalancers) buildLoadBalancerIngress(service *v1.Service, lb *govult
 func (l *loadbalancers) validateLBIDConsistency(ctx context.Context, service *v1.Service, annotatedID string) error {
 	// Check if the annotated ID corresponds to a valid load balancer
 	annotatedLB, err := l.lbByID(ctx, annotatedID)
-	if err != nil {
+	if err == errLbNotFound {
 		// ID in annotation doesn't exist in API - clear annotation and signal re-creation needed
 		return l.clearInvalidLBIDAnnotation(ctx, service, annotatedID)
 	}
+	if err != nil {
+		return err
+	}
 
 	// Load balancer exists - verify it matches the service
 	serviceLBName := l.GetLoadBalancerName(ctx, "", service)
-	if annotatedLB.Label != serviceLBName {
+	if annotatedLB.Label != l.lbLabel(serviceLBName) && annotatedLB.Label != serviceLBName {
 		return fmt.Errorf("load balancer %s (label: %s) does not match expected service name %s for service %s/%s",
 			annotatedID, annotatedLB.Label, serviceLBName, service.Namespace, service.Name)
 	}
@@ -555,7 +737,7 @@ func (l *loadbalancers) clearInvalidLBIDAnnotation(ctx context.Context, service
 	klog.Infof("Load balancer ID %s not found in API, clearing annotation for service %s/%s",
 		invalidID, service.Namespace, service.Name)
 
-	if err := l.GetKubeClient(); err != nil {
+	if err := l.kubeClientReady(); err != nil {
 		return fmt.Errorf("failed to get kubeclient: %s", err)
 	}
 
@@ -596,12 +778,12 @@ func (e *LBRecreationNeededError) Error() string {
 }
 
 func (l *loadbalancers) setAndValidateLBIDAnnotation(ctx context.Context, service *v1.Service, expectedLBID string) error {
-	if err := l.GetKubeClient(); err != nil {
+	if err := l.kubeClientReady(); err != nil {
 		return fmt.Errorf("failed to get kubeclient to update service: %s", err)
 	}
 
 	// Get current service to check existing annotation
-	currentService, err := l.kubeClient.CoreV1().Services(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+	currentService, err := l.serviceLister.Services(service.Namespace).Get(service.Name)
 	if err != nil {
 		return fmt.Errorf("failed to get service: %s", err)
 	}
@@ -652,35 +834,87 @@ func (l *loadbalancers) setAndValidateLBIDAnnotation(ctx context.Context, servic
 	return nil
 }
 
-func (l *loadbalancers) lbByName(ctx context.Context, lbName string) (*govultr.LoadBalancer, error) {
-	listOptions := &govultr.ListOptions{
-		PerPage: 25,
+// managedLBIDs returns the IDs of the existing load balancers owned by this cluster which LoadBalancer services
+// reference through their ID annotation
+func (l *loadbalancers) managedLBIDs(ctx context.Context) ([]string, error) {
+	if l.serviceLister == nil {
+		return nil, errKubeClientNotInitialized
 	}
 
-	var matches []*govultr.LoadBalancer
+	services, err := l.serviceLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
 
-	for {
-		lbs, meta, resp, err := l.client.LoadBalancer.List(ctx, listOptions)
-		if resp != nil {
-			err = resp.Body.Close()
-			if err != nil {
-				return nil, err
-			}
-		}
-		if err != nil {
-			return nil, err
+	referenced := make(map[string]bool)
+	for _, service := range services {
+		if id := service.Annotations[annoVultrLoadBalancerID]; id != "" && service.Spec.Type == v1.ServiceTypeLoadBalancer {
+			referenced[id] = true
 		}
+	}
+	if len(referenced) == 0 {
+		return nil, nil
+	}
 
-		for i := range lbs { // Use index to avoid copying
-			if lbs[i].Label == lbName {
-				matches = append(matches, &lbs[i])
-			}
-		}
+	lbs, err := l.inventory.lbsMatching(ctx, func(lb *govultr.LoadBalancer) bool {
+		return referenced[lb.ID] && l.ownsLB(lb)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		if meta.Links.Next == "" {
-			break
-		}
-		listOptions.Cursor = meta.Links.Next
+	ids := make([]string, 0, len(lbs))
+	for _, lb := range lbs {
+		ids = append(ids, lb.ID)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// seedManagedLBs adds the load balancers of the services to the managed load balancers gauge, so it is right
+// after a restart before the service controller ensured every service
+func (l *loadbalancers) seedManagedLBs(ctx context.Context) {
+	ids, err := l.managedLBIDs(ctx)
+	if err != nil {
+		klog.Errorf("failed to seed managed load balancers: %v", err)
+		return
+	}
+
+	for _, id := range ids {
+		managedLBs.add(id)
+	}
+	klog.V(logLevelDebug).Infof("seeded %d managed load balancers", len(ids))
+}
+
+// lbLabel returns the Vultr label for a load balancer name. When a cluster ID is configured it is
+// appended to the name so load balancers of different clusters in one account never share a label.
+func (l *loadbalancers) lbLabel(lbName string) string {
+	if l.clusterID == "" {
+		return lbName
+	}
+
+	return lbName + clusterIDSeparator + l.clusterID
+}
+
+// ownsLB returns whether the load balancer was created by this cluster
+func (l *loadbalancers) ownsLB(lb *govultr.LoadBalancer) bool {
+	if l.clusterID == "" {
+		return true
+	}
+
+	return strings.HasSuffix(lb.Label, clusterIDSeparator+l.clusterID)
+}
+
+// lbByName returns the load balancer owned by this cluster for the given name
+func (l *loadbalancers) lbByName(ctx context.Context, lbName string) (*govultr.LoadBalancer, error) {
+	return l.lbByLabel(ctx, l.lbLabel(lbName))
+}
+
+// lbByLabel returns the only load balancer with the given label
+func (l *loadbalancers) lbByLabel(ctx context.Context, label string) (*govultr.LoadBalancer, error) {
+	matches, err := l.inventory.lbsByLabel(ctx, label)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(matches) == 0 {
@@ -692,16 +926,19 @@ func (l *loadbalancers) lbByName(ctx context.Context, lbName string) (*govultr.L
 		for i := range matches { // Use index to avoid copying
 			ids = append(ids, matches[i].ID)
 		}
-		return nil, fmt.Errorf("multiple load balancers found with label %q: IDs %v - unique label required", lbName, ids)
+		return nil, fmt.Errorf("multiple load balancers found with label %q: IDs %v - unique label required", label, ids)
 	}
 
 	return matches[0], nil
 }
 
 func (l *loadbalancers) lbByID(ctx context.Context, lbID string) (*govultr.LoadBalancer, error) {
-	vlb, _, err := l.client.LoadBalancer.Get(ctx, lbID) //nolint:bodyclose
+	vlb, err := l.inventory.lbByID(ctx, lbID)
 	if err != nil {
-		return nil, errLbNotFound
+		if isAPINotFound(err) {
+			return nil, errLbNotFound
+		}
+		return nil, err
 	}
 
 	return vlb, nil
@@ -709,7 +946,22 @@ func (l *loadbalancers) lbByID(ctx context.Context, lbID string) (*govultr.LoadB
 
 func (l *loadbalancers) getVultrLB(ctx context.Context, service *v1.Service) (*govultr.LoadBalancer, error) {
 	if id, ok := service.Annotations[annoVultrLoadBalancerID]; ok {
-		return l.lbByID(ctx, id)
+		lb, err := l.lbByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+
+		if !l.ownsLB(lb) {
+			// Load balancers created before a cluster ID was configured carry the plain service
+			// LB name. The ID annotation on the service proves they belong to us so they are
+			// adopted and relabeled on the next update.
+			if lb.Label != l.GetLoadBalancerName(ctx, "", service) {
+				return nil, errLbNotOwned
+			}
+			klog.Infof("Adopting load balancer %q (label: %s) into cluster %q", lb.ID, lb.Label, l.clusterID)
+		}
+
+		return lb, nil
 	}
 
 	return l.findLoadBalancerByName(ctx, service)
@@ -722,30 +974,48 @@ func (l *loadbalancers) findLoadBalancerByName(ctx context.Context, service *v1.
 	}
 
 	lbName := l.GetLoadBalancerName(ctx, "", service)
-	return l.lbByName(ctx, lbName)
+	lb, err := l.lbByName(ctx, lbName)
+	if err != errLbNotFound || l.clusterID == "" {
+		return lb, err
+	}
+
+	return l.findLegacyLoadBalancer(ctx, service, defaultLBName, lbName)
 }
-func (l *loadbalancers) buildLoadBalancerRequest(ctx context.Context, service *v1.Service, nodes []*v1.Node) (*govultr.LoadBalancerReq, error) {
-	stickySession, err := buildStickySession(service)
-	if err != nil {
+
+// findLegacyLoadBalancer looks up a load balancer created for the service before a cluster ID was configured,
+// which carries the plain name. One named after the UID of the service can only belong to it and is adopted and
+// relabeled on the next update. One with a label chosen through annotations is not adopted since a service of
+// another cluster could use the same label, a legacyLBError is returned instead of creating a duplicate.
+func (l *loadbalancers) findLegacyLoadBalancer(ctx context.Context, service *v1.Service, defaultLBName, lbName string) (*govultr.LoadBalancer, error) {
+	lb, err := l.lbByLabel(ctx, defaultLBName)
+	if err == nil {
+		klog.Infof("Adopting load balancer %q (label: %s) of service %s/%s into cluster %q", lb.ID, lb.Label, service.Namespace, service.Name, l.clusterID)
+		return lb, nil
+	}
+	if err != errLbNotFound || lbName == defaultLBName {
 		return nil, err
 	}
 
-	healthCheck, err := buildHealthChecks(service)
+	lb, err = l.lbByLabel(ctx, lbName)
 	if err != nil {
 		return nil, err
 	}
-
-	rules, err := buildForwardingRules(service)
-	if err != nil {
+	return nil, &legacyLBError{id: lb.ID, label: lb.Label}
+}
+func (l *loadbalancers) buildLoadBalancerRequest(ctx context.Context, service *v1.Service, nodes []*v1.Node) (*govultr.LoadBalancerReq, error) {
+	annotations, problems := parseLBAnnotations(service)
+	if err := problems.err(); err != nil {
 		return nil, err
 	}
 
-	instances, err := buildInstanceList(nodes)
+	nodes, err := l.selectBackendNodes(service, annotations, nodes)
 	if err != nil {
 		return nil, err
 	}
-
-	timeout, err := getTimeout(service)
+	if annotations.endpointNodesOnly {
+		nodes = l.endpointNodes(service, nodes)
+	}
+	instances, err := buildInstanceList(nodes)
 	if err != nil {
 		return nil, err
 	}
@@ -776,270 +1046,50 @@ func (l *loadbalancers) buildLoadBalancerRequest(ctx context.Context, service *v
 	if err != nil {
 		return nil, err
 	}
-	vpc, err := getVPC(service)
+	vpc, err := l.getVPC(service)
 	if err != nil {
 		return nil, err
 	}
 
-	nodeC := 1
-
-	if count, ok := service.Annotations[annoVultrNodeCount]; ok {
-		nodeC, err = strconv.Atoi(count)
-		if err != nil {
-			return nil, err
-		}
-
-		if nodeC&1 == 0 {
-			return nil, fmt.Errorf("%s must be odd", annoVultrNodeCount)
-		}
-	}
-
 	name := l.GetLoadBalancerName(context.Background(), "", service)
+	healthCheck := annotations.healthCheck
 
 	return &govultr.LoadBalancerReq{
-		Label:              name,                                             // will always be set
-		Instances:          instances,                                        // will always be set
-		HealthCheck:        healthCheck,                                      // will always be set
-		StickySessions:     stickySession,                                    // need to check
-		ForwardingRules:    rules,                                            // all always be set
-		SSL:                ssl,                                              // will always be set
-		AutoSSL:            autoSSL,                                          // need to check
-		SSLRedirect:        govultr.BoolToBoolPtr(getSSLRedirect(service)),   // need to check
-		HTTP2:              govultr.BoolToBoolPtr(getHTTP2(service)),         // need to check
-		HTTP3:              govultr.BoolToBoolPtr(getHTTP3(service)),         // need to check
-		ProxyProtocol:      govultr.BoolToBoolPtr(getProxyProtocol(service)), // need to check
-		BalancingAlgorithm: getAlgorithm(service),                            // will always be set
-		FirewallRules:      firewallRules,                                    // need to check
-		Timeout:            timeout,                                          // need to check
-		VPC:                govultr.StringToStringPtr(vpc),                   // need to check
-		Nodes:              nodeC,                                            // need to check
+		Label:              l.lbLabel(name),                                                      // will always be set
+		Instances:          instances,                                                            // will always be set
+		HealthCheck:        &healthCheck,                                                         // will always be set
+		StickySessions:     &govultr.StickySessions{CookieName: annotations.stickySessionCookie}, // need to check
+		ForwardingRules:    annotations.forwardingRules,                                          // all always be set
+		SSL:                ssl,                                                                  // will always be set
+		AutoSSL:            autoSSL,                                                              // need to check
+		SSLRedirect:        govultr.BoolToBoolPtr(annotations.sslRedirect),                       // need to check
+		HTTP2:              govultr.BoolToBoolPtr(annotations.http2),                             // need to check
+		HTTP3:              govultr.BoolToBoolPtr(annotations.http3),                             // need to check
+		ProxyProtocol:      govultr.BoolToBoolPtr(annotations.proxyProtocol),                     // need to check
+		BalancingAlgorithm: annotations.algorithm,                                                // will always be set
+		FirewallRules:      firewallRules,                                                        // need to check
+		Timeout:            annotations.timeout,                                                  // need to check
+		VPC:                govultr.StringToStringPtr(vpc),                                       // need to check
+		Nodes:              annotations.nodeCount,                                                // need to check
 	}, nil
 }
 
-// getAlgorithm returns the algorithm to be used for load balancer service
-// defaults to round_robin if no algorithm is provided.
-func getAlgorithm(service *v1.Service) string {
-	algo := service.Annotations[annoVultrAlgorithm]
-	if algo == "least_connections" {
-		return "leastconn"
-	}
-
-	return "roundrobin"
-}
-
-// getSSLRedirect returns if traffic should be redirected to https
-// default to false if not specified
-func getSSLRedirect(service *v1.Service) bool {
-	redirect, ok := service.Annotations[annoVultrSSLRedirect]
-	if !ok {
-		return false
-	}
-
-	redirectBool, err := strconv.ParseBool(redirect)
-	if err != nil {
-		return false
-	}
-
-	return redirectBool
-}
-
-func buildStickySession(service *v1.Service) (*govultr.StickySessions, error) {
-	enabled := getStickySessionEnabled(service)
-
-	if enabled == "off" {
-		return &govultr.StickySessions{
-			CookieName: "",
-		}, nil
-	}
-
-	cookieName, err := getCookieName(service)
-	if err != nil {
-		return nil, err
-	}
-
-	return &govultr.StickySessions{
-		CookieName: cookieName,
-	}, nil
-}
-
-// getStickySessionEnabled returns whether or not sticky sessions should be enabled
-// default is off
-func getStickySessionEnabled(service *v1.Service) string {
-	enabled, ok := service.Annotations[annoVultrStickySessionEnabled]
-	if !ok {
-		return "off"
-	}
-
-	switch enabled {
-	case "on":
-		return "on"
-	default:
-		return "off"
-	}
-}
-
-// getCookieName returns the cookie name for loadbalancer sticky sessions
-func getCookieName(service *v1.Service) (string, error) {
-	name, ok := service.Annotations[annoVultrStickySessionCookieName]
-	if !ok || name == "" {
-		return "", fmt.Errorf("sticky session cookie name name not supplied but is required")
-	}
-
-	return name, nil
-}
-
+// buildHealthChecks returns the health check of the load balancer of a service
 func buildHealthChecks(service *v1.Service) (*govultr.HealthCheck, error) {
-	healthCheckProtocol, err := getHealthCheckProtocol(service)
-	if err != nil {
-		return nil, err
-	}
-
-	port, err := getHealthCheckPort(service)
-	if err != nil {
-		return nil, err
-	}
-
-	path := getHealthCheckPath(service)
-
-	interval, err := getHealthCheckInterval(service)
-	if err != nil {
-		return nil, err
-	}
-
-	response, err := getHealthCheckResponse(service)
-	if err != nil {
-		return nil, err
-	}
-
-	unhealthy, err := getHealthCheckUnhealthy(service)
-	if err != nil {
+	annotations, problems := parseLBAnnotations(service)
+	if err := problems.err(); err != nil {
 		return nil, err
 	}
-
-	healthy, err := getHealthCheckHealthy(service)
-	if err != nil {
-		return nil, err
-	}
-
-	return &govultr.HealthCheck{
-		Protocol:           healthCheckProtocol,
-		Port:               port,
-		Path:               path,
-		CheckInterval:      interval,
-		ResponseTimeout:    response,
-		UnhealthyThreshold: unhealthy,
-		HealthyThreshold:   healthy,
-	}, nil
-}
-
-// getHealthCheckProtocol returns the protocol for a health check
-// default is TCP
-func getHealthCheckProtocol(service *v1.Service) (string, error) {
-	protocol := service.Annotations[annoVultrHealthCheckProtocol]
-
-	// add in https
-	protocol = strings.ToLower(protocol)
-	if protocol == "" {
-		if getHealthCheckPath(service) != "" {
-			return protocolHTTP, nil
-		}
-		return protocolTCP, nil
-	}
-
-	if protocol != protocolHTTP && protocol != protocolTCP && protocol != protocolUDP {
-		return "", fmt.Errorf("invalid protocol : %s given in the annotation : %s", protocol, annoVultrHealthCheckProtocol)
-	}
-
-	return protocol, nil
-}
-
-// getHealthCheckPath returns the path for a health check
-func getHealthCheckPath(service *v1.Service) string {
-	path, ok := service.Annotations[annoVultrHealthCheckPath]
-	if !ok {
-		return ""
-	}
-
-	return path
-}
-
-func getHealthCheckPort(service *v1.Service) (int, error) {
-	port, ok := service.Annotations[annoVultrHealthCheckPort]
-	if !ok {
-		return int(service.Spec.Ports[0].NodePort), nil
-	}
-
-	portInt, err := strconv.Atoi(port)
-	if err != nil {
-		return 0, err
-	}
-
-	for _, v := range service.Spec.Ports {
-		if int(v.Port) == portInt {
-			return int(v.Port), nil
-		}
-		// The provided port does not exist
-		return 0, fmt.Errorf("provided health check port %d does not exist for service %s/%s", portInt, service.Namespace, service.Name) //nolint
-	}
-
-	// need to default a return here
-	return 0, nil
+	return &annotations.healthCheck, nil
 }
 
-func getHealthCheckInterval(service *v1.Service) (int, error) {
-	interval, ok := service.Annotations[annoVultrHealthCheckInterval]
-	if !ok {
-		return healthCheckInterval, nil
-	}
-
-	intervalInt, err := strconv.Atoi(interval)
-	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve health check interval %s - %s", annoVultrHealthCheckInterval, err)
-	}
-
-	return intervalInt, err
-}
-
-func getHealthCheckResponse(service *v1.Service) (int, error) {
-	response, ok := service.Annotations[annoVultrHealthCheckResponseTimeout]
-	if !ok {
-		return healthCheckResponse, nil
-	}
-
-	responseInt, err := strconv.Atoi(response)
-	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve health check response timeout %s - %s", annoVultrHealthCheckResponseTimeout, err)
-	}
-
-	return responseInt, err
-}
-
-func getHealthCheckUnhealthy(service *v1.Service) (int, error) {
-	unhealthy, ok := service.Annotations[annoVultrHealthCheckUnhealthyThreshold]
-	if !ok {
-		return healthCheckUnhealthy, nil
-	}
-
-	unhealthyInt, err := strconv.Atoi(unhealthy)
-	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve health check unhealthy treshold %s - %s", annoVultrHealthCheckUnhealthyThreshold, err)
-	}
-
-	return unhealthyInt, err
-}
-
-func getHealthCheckHealthy(service *v1.Service) (int, error) {
-	healthy, ok := service.Annotations[annoVultrHealthCheckHealthyThreshold]
-	if !ok {
-		return healthCheckHealthy, nil
-	}
-
-	healthyInt, err := strconv.Atoi(healthy)
-	if err != nil {
-		return 0, fmt.Errorf("failed to retrieve health check healthy treshold %s - %s", annoVultrHealthCheckHealthyThreshold, err)
+// buildForwardingRules returns a forwarding rule for each port of a service
+func buildForwardingRules(service *v1.Service) ([]govultr.ForwardingRule, error) {
+	annotations, problems := parseLBAnnotations(service)
+	if err := problems.err(); err != nil {
+		return nil, err
 	}
-
-	return healthyInt, err
+	return annotations.forwardingRules, nil
 }
 
 // buildInstanceList create list of nodes to be attached to a load balancer
@@ -1058,113 +1108,12 @@ func buildInstanceList(nodes []*v1.Node) ([]string, error) {
 	return list, nil
 }
 
-func buildForwardingRules(service *v1.Service) ([]govultr.ForwardingRule, error) {
-	var rules []govultr.ForwardingRule
-
-	defaultProtocol := getLBProtocol(service)
-
-	httpsPorts, err := getHTTPSPorts(service)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, port := range service.Spec.Ports {
-		// default the port
-		frontendProtocol := defaultProtocol
-		backendProtocol := getBackendProtocol(service)
-
-		if httpsPorts[port.Port] {
-			if getSSLPassthrough(service) {
-				frontendProtocol = protocolTCP
-			} else {
-				frontendProtocol = protocolHTTPS
-			}
-		}
-
-		switch frontendProtocol {
-		case protocolUDP:
-			if backendProtocol != protocolUDP {
-				klog.Infof("When frontend proto is udp, backend default is udp, %q is out of supported range, setting backend to udp", backendProtocol)
-				backendProtocol = protocolUDP
-			}
-		case protocolTCP:
-			if backendProtocol != protocolTCP {
-				klog.Infof("When frontend proto is tcp, backend default is tcp, %q is out of supported range, setting backend to tcp", backendProtocol)
-				backendProtocol = protocolTCP
-			}
-		case protocolHTTP:
-			if backendProtocol != protocolHTTP && backendProtocol != protocolHTTPS {
-				klog.Infof("When frontend proto is http, backend default is http, %q is out of supported range, setting backend to http", backendProtocol)
-				backendProtocol = protocolHTTP // http is default
-			}
-		case protocolHTTPS:
-			if backendProtocol != protocolHTTP && backendProtocol != protocolHTTPS {
-				klog.Infof("When frontend proto is https, backend default is https, %q is out of supported range, setting backend to https", backendProtocol)
-				backendProtocol = protocolHTTPS // https is default
-			}
-		}
-
-		// unset backend should be same as frontend
-		if backendProtocol == "" {
-			backendProtocol = frontendProtocol
-		}
-		klog.Infof("Frontend: %q, Backend: %q", frontendProtocol, backendProtocol)
-
-		rule := buildForwardingRule(&port, frontendProtocol, backendProtocol)
-		rules = append(rules, *rule)
-	}
-
-	return rules, nil
-}
-
-func buildForwardingRule(port *v1.ServicePort, protocol, backendProtocol string) *govultr.ForwardingRule {
-	var rule govultr.ForwardingRule
-
-	rule.FrontendProtocol = protocol
-	rule.BackendProtocol = backendProtocol
-
-	klog.V(logLevel).Infof("Rule: %+v\n", rule) //nolint
-
-	rule.FrontendPort = int(port.Port)
-	rule.BackendPort = int(port.NodePort)
-
-	return &rule
-}
-
-func getLBProtocol(service *v1.Service) string {
-	protocol, ok := service.Annotations[annoVultrLBProtocol]
-	if !ok {
-		return protocolTCP
-	}
-
-	return protocol
-}
-
-func getHTTPSPorts(service *v1.Service) (map[int32]bool, error) {
-	ports, ok := service.Annotations[annoVultrLBHTTPSPorts]
-	if !ok {
-		return nil, nil
-	}
-
-	portStrings := strings.Split(ports, ",")
-	portInt := map[int32]bool{}
-
-	for _, port := range portStrings {
-		p, err := strconv.Atoi(port)
-		if err != nil {
-			return nil, err
-		}
-		portInt[int32(p)] = true //nolint could cause integer overflow if p > 32-bits
-	}
-	return portInt, nil
-}
-
 func (l *loadbalancers) GetSSL(service *v1.Service, secretName string) (*govultr.SSL, error) {
-	if err := l.GetKubeClient(); err != nil {
+	if err := l.kubeClientReady(); err != nil {
 		return nil, err
 	}
 
-	secret, err := l.kubeClient.CoreV1().Secrets(service.Namespace).Get(context.Background(), secretName, metav1.GetOptions{})
+	secret, err := l.secretLister.Secrets(service.Namespace).Get(secretName)
 	if err != nil {
 		return nil, err
 	}
@@ -1183,11 +1132,11 @@ func (l *loadbalancers) GetSSL(service *v1.Service, secretName string) (*govultr
 }
 
 func (l *loadbalancers) GetAutoSSL(service *v1.Service, secretName string) (*govultr.AutoSSL, error) {
-	if err := l.GetKubeClient(); err != nil {
+	if err := l.kubeClientReady(); err != nil {
 		return nil, err
 	}
 
-	secret, err := l.kubeClient.CoreV1().Secrets(service.Namespace).Get(context.Background(), secretName, metav1.GetOptions{})
+	secret, err := l.secretLister.Secrets(service.Namespace).Get(secretName)
 	if err != nil {
 		return nil, err
 	}
@@ -1205,104 +1154,50 @@ func (l *loadbalancers) GetAutoSSL(service *v1.Service, secretName string) (*gov
 	return &autoSSL, nil
 }
 
-func (l *loadbalancers) GetKubeClient() error {
-	if l.kubeClient != nil {
-		return nil
-	}
-
-	var (
-		kubeConfig *rest.Config
-		err        error
-		config     string
-	)
-
-	// If no kubeconfig was passed in or set then we want to default to an empty string
-	// This will have `clientcmd.BuildConfigFromFlags` default to `restclient.InClusterConfig()` which was existing behavior
-	if Options.KubeconfigFlag == nil || Options.KubeconfigFlag.Value.String() == "" {
-		config = ""
-	} else {
-		config = Options.KubeconfigFlag.Value.String()
-	}
-
-	kubeConfig, err = clientcmd.BuildConfigFromFlags("", config)
-	if err != nil {
-		return err
-	}
-
-	l.kubeClient, err = kubernetes.NewForConfig(kubeConfig)
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func getSSLPassthrough(service *v1.Service) bool {
-	passThrough, ok := service.Annotations[annoVultrLBSSLPassthrough]
-	if !ok {
-		return false
-	}
-
-	pass, err := strconv.ParseBool(passThrough)
-	if err != nil {
-		return false
-	}
-	return pass
-}
-
-func getProxyProtocol(service *v1.Service) bool {
-	proxy, ok := service.Annotations[annoVultrProxyProtocol]
-	if !ok {
-		return false
-	}
-
-	pass, err := strconv.ParseBool(proxy)
-	if err != nil {
-		return false
-	}
-
-	return pass
+// setKubeClient wires the shared kube client and informer backed listers into the load balancers.
+// It has to be called before the informer factory is started so the informers are registered.
+func (l *loadbalancers) setKubeClient(kubeClient kubernetes.Interface, informerFactory informers.SharedInformerFactory) {
+	l.kubeClient = kubeClient
+	l.serviceLister = informerFactory.Core().V1().Services().Lister()
+	l.secretLister = informerFactory.Core().V1().Secrets().Lister()
+	l.configMapLister = informerFactory.Core().V1().ConfigMaps().Lister()
+	l.endpointSliceLister = informerFactory.Discovery().V1().EndpointSlices().Lister()
 }
 
-func getHTTP2(service *v1.Service) bool {
-	http2, ok := service.Annotations[annoVultrLBHTTP2]
-	if !ok {
-		return false
+// touchService sets the annotation of the service to the current time. The service controller does not watch
+// everything load balancers depend on, annotating the service like for SSL secret changes makes it update the
+// load balancer.
+func (l *loadbalancers) touchService(ctx context.Context, namespace, name, annotation string) error {
+	if err := l.kubeClientReady(); err != nil {
+		return err
 	}
 
-	protocolHTTP2, err := strconv.ParseBool(http2)
+	patchBytes, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				annotation: time.Now().String(),
+			},
+		},
+	})
 	if err != nil {
-		return false
+		return fmt.Errorf("failed to marshal patch: %w", err)
 	}
 
-	return protocolHTTP2
+	_, err = l.kubeClient.CoreV1().Services(namespace).Patch(ctx, name, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
+	return err
 }
 
-func getHTTP3(service *v1.Service) bool {
-	http3, ok := service.Annotations[annoVultrLBHTTP3]
-	if !ok {
-		return false
-	}
-
-	protocolHTTP3, err := strconv.ParseBool(http3)
-	if err != nil {
-		return false
-	}
-
-	return protocolHTTP3
+// setEventRecorder sets the recorder used for service events
+func (l *loadbalancers) setEventRecorder(recorder record.EventRecorder) {
+	l.recorder = recorder
 }
 
-func getTimeout(service *v1.Service) (int, error) {
-	lbtimeout, ok := service.Annotations[annoVultrLBTimeout]
-	if !ok {
-		return defaultLBTimeout, nil
-	}
-
-	timeout, err := strconv.Atoi(lbtimeout)
-	if err != nil {
-		return 0, fmt.Errorf("invalid timeout value: %v", err)
+// kubeClientReady returns an error if the cloud provider has not been initialized with a kube client yet
+func (l *loadbalancers) kubeClientReady() error {
+	if l.kubeClient == nil || l.serviceLister == nil || l.secretLister == nil || l.configMapLister == nil {
+		return errKubeClientNotInitialized
 	}
-	return timeout, nil
+	return nil
 }
 
 func (l *loadbalancers) buildFirewallRules(ctx context.Context, service *v1.Service) ([]govultr.LBFirewallRule, error) {
@@ -1365,11 +1260,11 @@ func (l *loadbalancers) getFirewallRulesFromConfigMap(ctx context.Context, servi
 		return nil, fmt.Errorf("%s annotation must not be empty", annoVultrFirewallRulesCM)
 	}
 
-	if err := l.GetKubeClient(); err != nil {
+	if err := l.kubeClientReady(); err != nil {
 		return nil, err
 	}
 
-	cm, err := l.kubeClient.CoreV1().ConfigMaps(service.Namespace).Get(ctx, cmName, metav1.GetOptions{})
+	cm, err := l.configMapLister.ConfigMaps(service.Namespace).Get(cmName)
 	if err != nil {
 		return nil, err
 	}
@@ -1446,7 +1341,7 @@ func validateFirewallRule(fwRule govultr.LBFirewallRule) error {
 	return nil
 }
 
-func getVPC(service *v1.Service) (string, error) {
+func (l *loadbalancers) getVPC(service *v1.Service) (string, error) {
 	var vpc string
 	pn, pnOk := service.Annotations[annoVultrPrivateNetwork]
 	v, vpcOk := service.Annotations[annoVultrVPC]
@@ -1465,42 +1360,20 @@ func getVPC(service *v1.Service) (string, error) {
 		return "", nil
 	}
 
-	meta := metadata.NewClient()
-	m, err := meta.Metadata()
-	if err != nil {
-		return "", fmt.Errorf("error getting metadata for private_network: %v", err.Error())
+	if l.vpcID != "" {
+		return l.vpcID, nil
 	}
 
-	pnID := ""
-	for _, v := range m.Interfaces { //nolint
-		if v.NetworkV2ID != "" {
-			pnID = v.NetworkV2ID
-			break
-		}
+	if l.metadata == nil {
+		return "", fmt.Errorf("no VPC is configured, set vpcID in the cloud config or --vultr-vpc-id")
 	}
 
-	return pnID, nil
-}
-
-func getBackendProtocol(service *v1.Service) string {
-	proto, ok := service.Annotations[annoVultrLBBackendProtocol]
-	if !ok {
-		return ""
+	pnID, err := l.metadata.vpcID()
+	if err != nil {
+		return "", fmt.Errorf("error getting metadata for private_network, set vpcID in the cloud config or --vultr-vpc-id: %v", err)
 	}
 
-	proto = strings.ToLower(proto)
-	switch proto {
-	case "http":
-		return protocolHTTP
-	case "https":
-		return protocolHTTPS
-	case "tcp":
-		return protocolTCP
-	case "udp":
-		return protocolUDP
-	default:
-		return ""
-	}
+	return pnID, nil
 }
 
 // checkEnabledIPv6 checks whether or not IPv6 is requested on the resource
@@ -1527,17 +1400,21 @@ func isLBActivating(err error) bool {
 	if err == nil {
 		return false
 	}
-	msg := strings.ToLower(err.Error())
-	return strings.Contains(msg, "still activating") ||
-		strings.Contains(msg, "activation in progress") ||
-		strings.Contains(msg, "activating")
+	return apiErrorClassOf(err) == apiErrorActivating
 }
 
 func (l *loadbalancers) retryLBUpdateAsync(ctx context.Context, lbID, clusterName string, service *v1.Service, nodes []*v1.Node) {
-	bgCtx, cancel := context.WithTimeout(ctx, syncTimeout*time.Minute)
+	timeout := l.syncTimeout
+	if timeout == 0 {
+		timeout = syncTimeout * time.Minute
+	}
+	bgCtx, cancel := context.WithTimeout(ctx, timeout)
 
+	backgroundRetriesInFlight.Inc()
+	l.event(service, v1.EventTypeNormal, eventReasonLBRetryStarted, "Nodes of load balancer %s are still activating, retrying the update in the background", lbID)
 	go func() {
 		defer cancel()
+		defer backgroundRetriesInFlight.Dec()
 
 		backoffs := []time.Duration{
 			2 * time.Second,
@@ -1553,6 +1430,7 @@ func (l *loadbalancers) retryLBUpdateAsync(ctx context.Context, lbID, clusterNam
 			select {
 			case <-bgCtx.Done():
 				klog.V(logLevelDebug).Infof("Background LB %s update canceled/expired: %v", lbID, bgCtx.Err())
+				l.event(service, v1.EventTypeWarning, eventReasonLBRetryFailed, "Gave up retrying the update of load balancer %s: %v", lbID, bgCtx.Err())
 				return
 			case <-time.After(d):
 			}
@@ -1564,16 +1442,21 @@ func (l *loadbalancers) retryLBUpdateAsync(ctx context.Context, lbID, clusterNam
 			}
 
 			if err := l.updateLoadBalancerWithLB(bgCtx, clusterName, service, nodes, lb); err != nil {
-				if isLBActivating(err) {
-					klog.V(logLevelTrace).Infof("Background LB %s update still activating, will retry: %v", lbID, err)
+				switch apiErrorClassOf(err) {
+				case apiErrorActivating, apiErrorRateLimited, apiErrorConflict:
+					klog.V(logLevelTrace).Infof("Background LB %s update not accepted yet, will retry: %v", lbID, err)
 					continue
 				}
 				klog.V(logLevelDebug).Infof("Background LB %s update stopped (non-activating error): %v", lbID, err)
+				l.event(service, v1.EventTypeWarning, eventReasonLBRetryFailed, "Background update of load balancer %s failed: %v", lbID, err)
 				return
 			}
 
 			klog.V(logLevelError).Infof("Background LB %s update finalized after activation", lbID)
+			l.event(service, v1.EventTypeNormal, eventReasonLBRetrySucceeded, "Updated load balancer %s after its nodes became active", lbID)
 			return
 		}
+
+		l.event(service, v1.EventTypeWarning, eventReasonLBRetryFailed, "Gave up retrying the update of load balancer %s after %d attempts", lbID, len(backoffs))
 	}()
 }
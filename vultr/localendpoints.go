@@ -0,0 +1,260 @@
+package vultr
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// kubeProxyHealthCheckPath is served by kube-proxy on the health check NodePort of services with
+	// externalTrafficPolicy Local, it only succeeds on nodes with a ready endpoint of the service
+	kubeProxyHealthCheckPath = "/healthz"
+
+	endpointNodeWorkers = 2
+)
+
+// endpointNodeTracker keeps the nodes hosting ready endpoints last attached to the load balancer of each
+// service, so services are only reconciled again when that set changes. Services which were annotated are
+// pending until their load balancer is updated. The nodes of a request being built are only recorded as
+// attached once the load balancer was updated.
+type endpointNodeTracker struct {
+	mu       sync.Mutex
+	nodes    map[string]string
+	building map[string]string
+	pending  map[string]bool
+}
+
+// built records the nodes of the load balancer request being built for the service
+func (t *endpointNodeTracker) built(key string, nodes []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.building == nil {
+		t.building = make(map[string]string)
+	}
+	t.building[key] = strings.Join(nodes, ",")
+}
+
+// attached records the nodes of the last built request as attached once the load balancer was updated
+func (t *endpointNodeTracker) attached(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	nodes, ok := t.building[key]
+	if !ok {
+		return
+	}
+	if t.nodes == nil {
+		t.nodes = make(map[string]string)
+	}
+	t.nodes[key] = nodes
+	delete(t.building, key)
+	delete(t.pending, key)
+}
+
+// failed drops the nodes of the last built request when the load balancer was not updated
+func (t *endpointNodeTracker) failed(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.building, key)
+}
+
+// changed returns whether the nodes differ from the nodes last attached, true if none were attached yet and
+// false while the service is pending
+func (t *endpointNodeTracker) changed(key string, nodes []string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending[key] {
+		return false
+	}
+	last, ok := t.nodes[key]
+	return !ok || last != strings.Join(nodes, ",")
+}
+
+// annotated marks the service as pending until its load balancer is updated
+func (t *endpointNodeTracker) annotated(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.pending == nil {
+		t.pending = make(map[string]bool)
+	}
+	t.pending[key] = true
+}
+
+func (t *endpointNodeTracker) forget(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.nodes, key)
+	delete(t.building, key)
+	delete(t.pending, key)
+}
+
+// usesLocalTrafficPolicy returns whether traffic of the service is only routed to endpoints on the node
+// receiving it
+func usesLocalTrafficPolicy(service *v1.Service) bool {
+	return service.Spec.ExternalTrafficPolicy == v1.ServiceExternalTrafficPolicyLocal
+}
+
+// endpointNodes returns the nodes to attach to the load balancer of a service which only attaches nodes hosting
+// ready endpoints. All nodes are returned when no node hosts a ready endpoint, the health checks mark them down
+// until one does.
+func (l *loadbalancers) endpointNodes(service *v1.Service, nodes []*v1.Node) []*v1.Node {
+	if l.endpointSliceLister == nil {
+		return nodes
+	}
+
+	key := service.Namespace + "/" + service.Name
+	names, err := l.readyEndpointNodes(service)
+	if err != nil {
+		klog.Errorf("failed to list endpoint slices of service %s, attaching all nodes: %v", key, err)
+		l.endpointNodeSets.failed(key)
+		return nodes
+	}
+	l.endpointNodeSets.built(key, names)
+
+	hosting := make(map[string]bool, len(names))
+	for _, name := range names {
+		hosting[name] = true
+	}
+
+	var filtered []*v1.Node
+	for _, node := range nodes {
+		if hosting[node.Name] {
+			filtered = append(filtered, node)
+		}
+	}
+	if len(filtered) == 0 {
+		klog.Warningf("no node hosts a ready endpoint of service %s, attaching all nodes", key)
+		return nodes
+	}
+
+	klog.V(logLevelDebug).Infof("attaching %d of %d nodes hosting ready endpoints of service %s", len(filtered), len(nodes), key)
+	return filtered
+}
+
+// readyEndpointNodes returns the sorted names of the nodes hosting ready endpoints of the service
+func (l *loadbalancers) readyEndpointNodes(service *v1.Service) ([]string, error) {
+	slices, err := l.endpointSliceLister.EndpointSlices(service.Namespace).List(
+		labels.SelectorFromSet(labels.Set{discoveryv1.LabelServiceName: service.Name}))
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	var names []string
+	for _, slice := range slices {
+		for _, endpoint := range slice.Endpoints {
+			// an unknown ready condition is to be interpreted as ready
+			if endpoint.NodeName == nil || seen[*endpoint.NodeName] ||
+				(endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready) {
+				continue
+			}
+			seen[*endpoint.NodeName] = true
+			names = append(names, *endpoint.NodeName)
+		}
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// watchEndpointSlices queues the services of changed endpoint slices, so services which only attach nodes hosting
+// ready endpoints are reconciled when those nodes change, the service controller does not watch endpoints.
+// The queue is synced by runEndpointNodeWorkers.
+func (l *loadbalancers) watchEndpointSlices(informerFactory informers.SharedInformerFactory) error {
+	l.endpointQueue = newKeyQueue("endpoint-nodes")
+
+	onEvent := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = tombstone.Obj
+		}
+		slice, ok := obj.(*discoveryv1.EndpointSlice)
+		if !ok {
+			return
+		}
+		name := slice.Labels[discoveryv1.LabelServiceName]
+		if name == "" {
+			return
+		}
+		l.endpointQueue.Add(slice.Namespace + "/" + name)
+	}
+
+	_, err := informerFactory.Discovery().V1().EndpointSlices().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: onEvent,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSlice, okOld := oldObj.(*discoveryv1.EndpointSlice)
+			newSlice, okNew := newObj.(*discoveryv1.EndpointSlice)
+			// periodic resyncs deliver the same object again, only react to actual changes
+			if okOld && okNew && oldSlice.ResourceVersion == newSlice.ResourceVersion {
+				return
+			}
+			onEvent(newObj)
+		},
+		DeleteFunc: onEvent,
+	})
+	return err
+}
+
+// runEndpointNodeWorkers syncs the services queued by watchEndpointSlices until the context is done
+func (l *loadbalancers) runEndpointNodeWorkers(ctx context.Context) {
+	if l.endpointQueue == nil {
+		return
+	}
+	runKeyWorkers(ctx, l.endpointQueue, endpointNodeWorkers, func(ctx context.Context, key string) error {
+		namespace, name, err := cache.SplitMetaNamespaceKey(key)
+		if err != nil {
+			klog.Errorf("invalid service key %q: %v", key, err)
+			return nil
+		}
+		return l.syncEndpointNodes(ctx, namespace, name)
+	})
+}
+
+// syncEndpointNodes annotates the service when the nodes hosting its ready endpoints differ from the nodes
+// attached to its load balancer
+func (l *loadbalancers) syncEndpointNodes(ctx context.Context, namespace, name string) error {
+	key := namespace + "/" + name
+
+	service, err := l.serviceLister.Services(namespace).Get(name)
+	if err != nil {
+		l.endpointNodeSets.forget(key)
+		return nil
+	}
+	service = l.withDefaultAnnotations(service)
+
+	annotations, _ := parseLBAnnotations(service)
+	if service.Spec.Type != v1.ServiceTypeLoadBalancer || !annotations.endpointNodesOnly {
+		l.endpointNodeSets.forget(key)
+		return nil
+	}
+
+	names, err := l.readyEndpointNodes(service)
+	if err != nil {
+		return err
+	}
+	if !l.endpointNodeSets.changed(key, names) {
+		return nil
+	}
+
+	if err := l.touchService(ctx, namespace, name, annoVultrLBEndpointsLastUpdatedTime); err != nil {
+		return err
+	}
+	// the nodes are stored when the load balancer is updated, until then the service is not patched again
+	l.endpointNodeSets.annotated(key)
+
+	klog.V(logLevelDebug).Infof("nodes hosting ready endpoints of service %s changed to %v, updating its load balancer", key, names)
+	return nil
+}
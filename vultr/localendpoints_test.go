@@ -0,0 +1,216 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func localService(annotations map[string]string) *v1.Service {
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "lb-name",
+			Namespace:   v1.NamespaceDefault,
+			UID:         "lb-name",
+			Annotations: annotations,
+		},
+		Spec: v1.ServiceSpec{
+			Type:                  v1.ServiceTypeLoadBalancer,
+			ExternalTrafficPolicy: v1.ServiceExternalTrafficPolicyLocal,
+			HealthCheckNodePort:   32000,
+			Ports:                 []v1.ServicePort{{Name: "test", Protocol: "TCP", Port: 80, NodePort: 30080}},
+		},
+	}
+}
+
+func endpointSlice(nodes map[string]bool) *discoveryv1.EndpointSlice {
+	slice := &discoveryv1.EndpointSlice{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lb-name-abcde",
+			Namespace: v1.NamespaceDefault,
+			Labels:    map[string]string{discoveryv1.LabelServiceName: "lb-name"},
+		},
+	}
+	for name, ready := range nodes {
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{"10.0.0.1"},
+			NodeName:   &name,
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		})
+	}
+	return slice
+}
+
+func TestParseLBAnnotations_LocalHealthCheck(t *testing.T) {
+	annotations, problems := parseLBAnnotations(localService(nil))
+	if err := problems.err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := govultr.HealthCheck{
+		Protocol:           protocolHTTP,
+		Port:               32000,
+		Path:               kubeProxyHealthCheckPath,
+		CheckInterval:      healthCheckInterval,
+		ResponseTimeout:    healthCheckResponse,
+		UnhealthyThreshold: healthCheckUnhealthy,
+		HealthyThreshold:   healthCheckHealthy,
+	}
+	if !reflect.DeepEqual(annotations.healthCheck, expected) {
+		t.Errorf("expcted %+v got %+v", expected, annotations.healthCheck)
+	}
+
+	annotations, problems = parseLBAnnotations(localService(map[string]string{annoVultrHealthCheckProtocol: "tcp"}))
+	if annotations.healthCheck.Port != 30080 || len(problems.warnings) != 1 {
+		t.Errorf("expcted the first NodePort and a warning got %+v %+v", annotations.healthCheck, problems.warnings)
+	}
+}
+
+func TestLoadbalancers_BuildLoadBalancerRequest_EndpointNodesOnly(t *testing.T) {
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: v1.NodeSpec{ProviderID: "vultr://123"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Spec: v1.NodeSpec{ProviderID: "vultr://124"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node3"}, Spec: v1.NodeSpec{ProviderID: "vultr://125"}},
+	}
+
+	tests := []struct {
+		name     string
+		slice    map[string]bool
+		expected []string
+	}{
+		{
+			name:     "ready endpoint nodes",
+			slice:    map[string]bool{"node1": false, "node2": true, "node3": true},
+			expected: []string{"124", "125"},
+		},
+		{
+			name:     "no ready endpoints",
+			slice:    map[string]bool{"node1": false},
+			expected: []string{"123", "124", "125"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{}).(*loadbalancers)
+			svc := localService(map[string]string{annoVultrLBEndpointNodesOnly: "true"})
+			setFakeKubeClient(t, lb, svc, endpointSlice(test.slice))
+
+			req, err := lb.buildLoadBalancerRequest(context.Background(), svc, nodes)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(req.Instances, test.expected) {
+				t.Errorf("expcted %+v got %+v", test.expected, req.Instances)
+			}
+		})
+	}
+}
+
+func TestLoadbalancers_SyncEndpointNodes(t *testing.T) {
+	client := newFakeClient()
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{}).(*loadbalancers)
+	svc := localService(map[string]string{annoVultrLBEndpointNodesOnly: "true"})
+	setFakeKubeClient(t, lb, svc, endpointSlice(map[string]bool{"node2": true}))
+
+	// the load balancer was last updated while node1 hosted the endpoints
+	lb.endpointNodeSets.built("default/lb-name", []string{"node1"})
+	lb.endpointNodeSets.attached("default/lb-name")
+
+	if err := lb.syncEndpointNodes(context.Background(), v1.NamespaceDefault, "lb-name"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	actual, err := lb.kubeClient.CoreV1().Services(v1.NamespaceDefault).Get(context.Background(), "lb-name", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := actual.Annotations[annoVultrLBEndpointsLastUpdatedTime]; !ok {
+		t.Errorf("expcted %s to be set got %+v", annoVultrLBEndpointsLastUpdatedTime, actual.Annotations)
+	}
+	if lb.endpointNodeSets.changed("default/lb-name", []string{"node3"}) {
+		t.Error("expcted the service not to be annotated again before its load balancer is updated")
+	}
+}
+
+func TestLoadbalancers_SyncEndpointNodes_BeforeAttach(t *testing.T) {
+	client := newFakeClient()
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{}).(*loadbalancers)
+	svc := localService(map[string]string{annoVultrLBEndpointNodesOnly: "true"})
+	setFakeKubeClient(t, lb, svc, endpointSlice(map[string]bool{"node2": true}))
+
+	// the endpoints changed before the load balancer was updated by this process
+	if err := lb.syncEndpointNodes(context.Background(), v1.NamespaceDefault, "lb-name"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	actual, err := lb.kubeClient.CoreV1().Services(v1.NamespaceDefault).Get(context.Background(), "lb-name", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := actual.Annotations[annoVultrLBEndpointsLastUpdatedTime]; !ok {
+		t.Errorf("expcted %s to be set got %+v", annoVultrLBEndpointsLastUpdatedTime, actual.Annotations)
+	}
+
+	lb.endpointNodeSets.built("default/lb-name", []string{"node2"})
+	lb.endpointNodeSets.attached("default/lb-name")
+	if !lb.endpointNodeSets.changed("default/lb-name", []string{"node3"}) {
+		t.Error("expcted a change after the load balancer was updated to be reported")
+	}
+}
+
+// fakeFailingUpdateLB fails load balancer updates while fail is set
+type fakeFailingUpdateLB struct {
+	*fakeLB
+	fail bool
+}
+
+func (f *fakeFailingUpdateLB) Update(ctx context.Context, lbID string, req *govultr.LoadBalancerReq) error {
+	if f.fail {
+		return errors.New(`{"error":"internal error","status":500}`)
+	}
+	return f.fakeLB.Update(ctx, lbID, req)
+}
+
+func TestLoadbalancers_UpdateLoadBalancer_EndpointNodesAfterUpdate(t *testing.T) {
+	fakeLoadBalancer := &fakeFailingUpdateLB{fakeLB: &fakeLB{}, fail: true}
+	client := newFakeClient()
+	client.LoadBalancer = fakeLoadBalancer
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{}).(*loadbalancers)
+	svc := localService(map[string]string{
+		annoVultrLBEndpointNodesOnly: "true",
+		annoVultrLoadBalancerID:      "6334f227-6d96-4cbd-9bcb-5be0759354fa",
+	})
+	setFakeKubeClient(t, lb, svc, endpointSlice(map[string]bool{"node2": true}))
+	nodes := []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: v1.NodeSpec{ProviderID: "vultr://123"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2"}, Spec: v1.NodeSpec{ProviderID: "vultr://124"}},
+	}
+
+	// the load balancer was last updated while node1 hosted the endpoints
+	lb.endpointNodeSets.built("default/lb-name", []string{"node1"})
+	lb.endpointNodeSets.attached("default/lb-name")
+
+	if err := lb.UpdateLoadBalancer(context.Background(), "cluster-name", svc, nodes); err == nil {
+		t.Fatal("expcted the failed update to be returned")
+	}
+	if !lb.endpointNodeSets.changed("default/lb-name", []string{"node2"}) {
+		t.Error("expcted node2 not to be recorded as attached after a failed update")
+	}
+
+	fakeLoadBalancer.fail = false
+	if err := lb.UpdateLoadBalancer(context.Background(), "cluster-name", svc, nodes); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if lb.endpointNodeSets.changed("default/lb-name", []string{"node2"}) {
+		t.Error("expcted node2 to be recorded as attached after the update")
+	}
+}
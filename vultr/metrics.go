@@ -0,0 +1,246 @@
+package vultr
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/legacyregistry"
+)
+
+const (
+	metricsNamespace = "cloudprovider"
+	metricsSubsystem = "vultr"
+
+	// statusClassError is used when no response was received from the API
+	statusClassError = "error"
+)
+
+var _ http.RoundTripper = &metricsTransport{}
+
+var (
+	apiRequestsTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "api_requests_total",
+			Help:           "Number of Vultr API requests by operation and response status class.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation", "status_class"},
+	)
+
+	apiRequestDuration = metrics.NewHistogramVec(
+		&metrics.HistogramOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "api_request_duration_seconds",
+			Help:           "Latency of Vultr API requests, including retries, by operation and response status class.",
+			Buckets:        metrics.ExponentialBuckets(0.05, 2, 10), //nolint:mnd
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation", "status_class"},
+	)
+
+	apiRetriesTotal = metrics.NewCounterVec(
+		&metrics.CounterOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "api_retries_total",
+			Help:           "Number of retried Vultr API requests by operation.",
+			StabilityLevel: metrics.ALPHA,
+		},
+		[]string{"operation"},
+	)
+
+	managedLoadBalancers = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "managed_load_balancers",
+			Help:           "Number of Vultr load balancers managed by the cloud controller manager.",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	backgroundRetriesInFlight = metrics.NewGauge(
+		&metrics.GaugeOpts{
+			Namespace:      metricsNamespace,
+			Subsystem:      metricsSubsystem,
+			Name:           "lb_background_retries_in_flight",
+			Help:           "Number of load balancer updates currently being retried in the background.",
+			StabilityLevel: metrics.ALPHA,
+		},
+	)
+
+	apiKeyAge = &apiKeyAgeCollector{}
+
+	registerMetricsOnce sync.Once
+)
+
+var apiKeyAgeDesc = metrics.NewDesc(
+	metrics.BuildFQName(metricsNamespace, metricsSubsystem, "api_key_age_seconds"),
+	"Seconds the current Vultr API key read from apiKeyFile has been in use.",
+	nil, nil, metrics.ALPHA, "",
+)
+
+// apiKeyAgeCollector reports the age of the API key of a file token source, nothing is reported while
+// the API key is not read from a file
+type apiKeyAgeCollector struct {
+	metrics.BaseStableCollector
+
+	source atomic.Pointer[fileTokenSource]
+}
+
+// setSource sets the token source whose key age is reported
+func (c *apiKeyAgeCollector) setSource(source *fileTokenSource) {
+	c.source.Store(source)
+}
+
+func (c *apiKeyAgeCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- apiKeyAgeDesc
+}
+
+func (c *apiKeyAgeCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	source := c.source.Load()
+	if source == nil {
+		return
+	}
+	ch <- metrics.NewLazyConstMetric(apiKeyAgeDesc, metrics.GaugeValue, source.KeyAge().Seconds())
+}
+
+// registerMetrics registers the provider metrics with the registry served on the CCM metrics endpoint
+func registerMetrics() {
+	registerMetricsOnce.Do(func() {
+		legacyregistry.MustRegister(
+			apiRequestsTotal,
+			apiRequestDuration,
+			apiRetriesTotal,
+			managedLoadBalancers,
+			backgroundRetriesInFlight,
+		)
+		legacyregistry.CustomMustRegister(apiKeyAge)
+	})
+}
+
+// apiResources maps the collections of the Vultr API path to the resource name used in operation labels,
+// every other path segment is an ID
+var apiResources = map[string]string{
+	"account":          "account",
+	"bare-metals":      "baremetal",
+	"firewall-rules":   "lb_firewall_rule",
+	"firewalls":        "firewall_group",
+	"forwarding-rules": "forwarding_rule",
+	"instances":        "instance",
+	"ipv4":             "ipv4",
+	"ipv6":             "ipv6",
+	"load-balancers":   "lb",
+	"neighbors":        "neighbor",
+	"plans":            "plan",
+	"plans-metal":      "baremetal_plan",
+	"reverse":          "reverse_dns",
+	"rules":            "firewall_rule",
+	"ssl":              "lb_ssl",
+	"vpc2":             "vpc2",
+	"vpcs":             "vpc",
+}
+
+// apiOperation returns the operation label for a Vultr API request, for example
+// GET /v2/instances/{id} is instance_get and POST /v2/load-balancers/{id}/forwarding-rules is forwarding_rule_create
+func apiOperation(req *http.Request) string {
+	resource := "unknown"
+	hasID := false
+
+	for _, segment := range strings.Split(strings.Trim(req.URL.Path, "/"), "/") {
+		if segment == "" || segment == "v2" {
+			continue
+		}
+
+		if name, ok := apiResources[segment]; ok {
+			resource = name
+			hasID = false
+		} else {
+			hasID = true
+		}
+	}
+
+	var verb string
+	switch req.Method {
+	case http.MethodGet:
+		verb = "list"
+		if hasID {
+			verb = "get"
+		}
+	case http.MethodPost:
+		verb = "create"
+	case http.MethodPut, http.MethodPatch:
+		verb = "update"
+	case http.MethodDelete:
+		verb = "delete"
+	default:
+		verb = strings.ToLower(req.Method)
+	}
+
+	return resource + "_" + verb
+}
+
+// statusClass returns the status class label for a response, such as 2xx or 4xx
+func statusClass(resp *http.Response, err error) string {
+	if err != nil || resp == nil {
+		return statusClassError
+	}
+
+	return strconv.Itoa(resp.StatusCode/100) + "xx" //nolint:mnd
+}
+
+// metricsTransport records the count and latency of every Vultr API request
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+func newMetricsTransport(base http.RoundTripper) *metricsTransport {
+	return &metricsTransport{base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	operation := apiOperation(req)
+	start := time.Now()
+
+	resp, err := t.base.RoundTrip(req)
+
+	class := statusClass(resp, err)
+	apiRequestsTotal.WithLabelValues(operation, class).Inc()
+	apiRequestDuration.WithLabelValues(operation, class).Observe(time.Since(start).Seconds())
+
+	return resp, err
+}
+
+// lbTracker keeps the IDs of the load balancers managed by the CCM for the managed load balancers gauge.
+// It is seeded from the load balancers of the services on start up, see seedManagedLBs.
+type lbTracker struct {
+	mu  sync.Mutex
+	ids map[string]struct{}
+}
+
+var managedLBs = &lbTracker{ids: make(map[string]struct{})}
+
+func (t *lbTracker) add(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.ids[id] = struct{}{}
+	managedLoadBalancers.Set(float64(len(t.ids)))
+}
+
+func (t *lbTracker) remove(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.ids, id)
+	managedLoadBalancers.Set(float64(len(t.ids)))
+}
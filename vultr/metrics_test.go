@@ -0,0 +1,96 @@
+package vultr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"k8s.io/component-base/metrics/testutil"
+)
+
+func TestAPIOperation(t *testing.T) {
+	tests := []struct {
+		method   string
+		path     string
+		expected string
+	}{
+		{http.MethodGet, "/v2/instances/75b95d83-47e1-4a3f-a5be-3f7b6d4b1f4d", "instance_get"},
+		{http.MethodGet, "/v2/instances", "instance_list"},
+		{http.MethodGet, "/v2/bare-metals/cb676a46-66fd-4dfb-b839-443f2e6c0b60/vpcs", "vpc_list"},
+		{http.MethodGet, "/v2/load-balancers", "lb_list"},
+		{http.MethodPatch, "/v2/load-balancers/abc123", "lb_update"},
+		{http.MethodDelete, "/v2/load-balancers/abc123", "lb_delete"},
+		{http.MethodPost, "/v2/load-balancers/abc123/forwarding-rules", "forwarding_rule_create"},
+		{http.MethodDelete, "/v2/load-balancers/abc123/forwarding-rules/rule-1", "forwarding_rule_delete"},
+		{http.MethodPost, "/v2/instances/abc123/ipv4/reverse", "reverse_dns_create"},
+		{http.MethodGet, "/v2/something-new", "unknown_get"},
+	}
+
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, http.NoBody)
+		if actual := apiOperation(req); actual != test.expected {
+			t.Errorf("expcted %+v got %+v", test.expected, actual)
+		}
+	}
+}
+
+func TestMetricsTransport(t *testing.T) {
+	registerMetrics()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	counter := apiRequestsTotal.WithLabelValues("instance_get", "4xx")
+	before, err := testutil.GetCounterMetricValue(counter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	client := &http.Client{Transport: newMetricsTransport(http.DefaultTransport)}
+	resp, err := client.Get(server.URL + "/v2/instances/abc123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+
+	after, err := testutil.GetCounterMetricValue(counter)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if after-before != 1 {
+		t.Errorf("expcted %+v got %+v", 1, after-before)
+	}
+}
+
+func TestAPIKeyAgeCollector(t *testing.T) {
+	registry := testutil.NewFakeKubeRegistry("1.35.0")
+	collector := &apiKeyAgeCollector{}
+	registry.CustomMustRegister(collector)
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(families) != 0 {
+		t.Errorf("expected no API key age without a key file got %+v", families)
+	}
+
+	source := &fileTokenSource{}
+	source.key.Store(&apiKey{token: "key", loadedAt: time.Now().Add(-time.Hour)})
+	collector.setSource(source)
+
+	families, err = registry.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(families) != 1 || families[0].GetName() != "cloudprovider_vultr_api_key_age_seconds" {
+		t.Fatalf("expected cloudprovider_vultr_api_key_age_seconds got %+v", families)
+	}
+	if age := families[0].GetMetric()[0].GetGauge().GetValue(); age < time.Hour.Seconds() || age > 2*time.Hour.Seconds() {
+		t.Errorf("expected the key to be about an hour old got %f seconds", age)
+	}
+}
@@ -0,0 +1,280 @@
+package vultr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// annoNodeInternalVPC overrides nodeAddresses.internalVPC for a node
+	annoNodeInternalVPC = "vultr.com/internal-vpc"
+
+	// annoNodeOtherVPCAddresses overrides nodeAddresses.otherVPCAddresses for a node
+	annoNodeOtherVPCAddresses = "vultr.com/other-vpc-addresses"
+
+	// annoNodeIPFamilyPolicy overrides nodeAddresses.ipFamilyPolicy for a node
+	annoNodeIPFamilyPolicy = "vultr.com/ip-family-policy"
+
+	otherVPCAddressesInternal = "internal"
+	otherVPCAddressesNone     = "none"
+
+	ipFamilyIPv4               = "ipv4"
+	ipFamilyIPv6               = "ipv6"
+	ipFamilyDualStackPrimaryV4 = "dual-stack-primary-v4"
+	ipFamilyDualStackPrimaryV6 = "dual-stack-primary-v6"
+)
+
+// addressPolicy is the node address config which applies to a single node
+type addressPolicy struct {
+	internalVPC       string
+	otherVPCAddresses string
+	ipFamilyPolicy    string
+}
+
+// vpcAddress is the address of a server in a VPC
+type vpcAddress struct {
+	vpcID   string
+	address string
+}
+
+func validateOtherVPCAddresses(value string) error {
+	switch value {
+	case "", otherVPCAddressesInternal, otherVPCAddressesNone:
+		return nil
+	}
+	return fmt.Errorf("%q is not supported, supported values are [%s %s]", value, otherVPCAddressesInternal, otherVPCAddressesNone)
+}
+
+func validateIPFamilyPolicy(value string) error {
+	switch value {
+	case "", ipFamilyIPv4, ipFamilyIPv6, ipFamilyDualStackPrimaryV4, ipFamilyDualStackPrimaryV6:
+		return nil
+	}
+	return fmt.Errorf("%q is not supported, supported values are [%s %s %s %s]", value,
+		ipFamilyIPv4, ipFamilyIPv6, ipFamilyDualStackPrimaryV4, ipFamilyDualStackPrimaryV6)
+}
+
+// addressPolicy returns the node address config with the annotations of the node applied
+func (i *instancesv2) addressPolicy(node *v1.Node) (addressPolicy, error) {
+	policy := addressPolicy{
+		internalVPC:       i.addressCfg.InternalVPC,
+		otherVPCAddresses: i.addressCfg.OtherVPCAddresses,
+		ipFamilyPolicy:    i.addressCfg.IPFamilyPolicy,
+	}
+
+	if value, ok := node.Annotations[annoNodeInternalVPC]; ok {
+		policy.internalVPC = value
+	}
+
+	if value, ok := node.Annotations[annoNodeOtherVPCAddresses]; ok {
+		if err := validateOtherVPCAddresses(value); err != nil {
+			return addressPolicy{}, fmt.Errorf("annotation %s: %w", annoNodeOtherVPCAddresses, err)
+		}
+		policy.otherVPCAddresses = value
+	}
+
+	if value, ok := node.Annotations[annoNodeIPFamilyPolicy]; ok {
+		if err := validateIPFamilyPolicy(value); err != nil {
+			return addressPolicy{}, fmt.Errorf("annotation %s: %w", annoNodeIPFamilyPolicy, err)
+		}
+		policy.ipFamilyPolicy = value
+	}
+
+	if policy.otherVPCAddresses == "" {
+		policy.otherVPCAddresses = otherVPCAddressesInternal
+	}
+
+	return policy, nil
+}
+
+// vpcInternalAddresses returns the InternalIPs for the VPC addresses of a server. The address in the VPC named
+// by the policy comes first, or the address in the VPC with the lowest ID if none is named, followed by the
+// addresses in the other VPCs sorted by VPC ID if the policy reports them.
+func (i *instancesv2) vpcInternalAddresses(ctx context.Context, policy addressPolicy, vpcs []vpcAddress) ([]v1.NodeAddress, error) {
+	sorted := make([]vpcAddress, 0, len(vpcs))
+	for _, vpc := range vpcs {
+		if vpc.address != "" {
+			sorted = append(sorted, vpc)
+		}
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		if sorted[a].vpcID != sorted[b].vpcID {
+			return sorted[a].vpcID < sorted[b].vpcID
+		}
+		return sorted[a].address < sorted[b].address
+	})
+
+	if len(sorted) == 0 {
+		if policy.internalVPC != "" {
+			return nil, fmt.Errorf("not attached to VPC %q", policy.internalVPC)
+		}
+		return nil, nil
+	}
+
+	primary := 0
+	if policy.internalVPC != "" {
+		var err error
+		primary, err = i.findVPC(ctx, policy.internalVPC, sorted)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	addresses := []v1.NodeAddress{{Type: v1.NodeInternalIP, Address: sorted[primary].address}}
+	if policy.otherVPCAddresses == otherVPCAddressesNone {
+		return addresses, nil
+	}
+
+	seen := map[string]bool{sorted[primary].address: true}
+	for _, vpc := range sorted {
+		if seen[vpc.address] {
+			continue
+		}
+		seen[vpc.address] = true
+		addresses = append(addresses, v1.NodeAddress{Type: v1.NodeInternalIP, Address: vpc.address})
+	}
+
+	return addresses, nil
+}
+
+// findVPC returns the index of the first address in the VPC with the given ID or description
+func (i *instancesv2) findVPC(ctx context.Context, name string, vpcs []vpcAddress) (int, error) {
+	for index, vpc := range vpcs {
+		if vpc.vpcID == name {
+			return index, nil
+		}
+	}
+
+	described, err := i.inventory.vpcsByDescription(ctx, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to look up VPC %q: %w", name, err)
+	}
+
+	ids := make(map[string]bool, len(described))
+	for _, vpc := range described {
+		ids[vpc.ID] = true
+	}
+
+	for index, vpc := range vpcs {
+		if ids[vpc.vpcID] {
+			return index, nil
+		}
+	}
+
+	return 0, fmt.Errorf("not attached to VPC %q", name)
+}
+
+// instanceVPCAddresses returns the addresses of an instance in the VPCs it is attached to
+func (i *instancesv2) instanceVPCAddresses(ctx context.Context, instanceID string) ([]vpcAddress, error) {
+	var addresses []vpcAddress
+
+	vpc1, err := listAll(ctx, func(ctx context.Context, opts *govultr.ListOptions) ([]govultr.VPCInfo, *govultr.Meta, error) {
+		vpcs, meta, resp, err := i.client.Instance.ListVPCInfo(ctx, instanceID, opts) //nolint:bodyclose
+		return vpcs, meta, newAPIError(resp, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting VPC info for instance %s: %w", instanceID, err)
+	}
+
+	for _, vpc := range vpc1 {
+		addresses = append(addresses, vpcAddress{vpcID: vpc.ID, address: vpc.IPAddress})
+	}
+
+	// Deprecated: VPC2 is no longer supported and functionality will cease in a
+	// future release.
+	vpc2, err := listAll(ctx, func(ctx context.Context, opts *govultr.ListOptions) ([]govultr.VPC2Info, *govultr.Meta, error) { //nolint:staticcheck
+		vpcs, meta, resp, err := i.client.Instance.ListVPC2Info(ctx, instanceID, opts) //nolint:bodyclose,staticcheck
+		return vpcs, meta, newAPIError(resp, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error getting VPC2 info for instance %s: %w", instanceID, err)
+	}
+
+	for _, vpc := range vpc2 {
+		addresses = append(addresses, vpcAddress{vpcID: vpc.ID, address: vpc.IPAddress})
+	}
+
+	return addresses, nil
+}
+
+// applyIPFamilyPolicy reorders the addresses of a node for the IP family policy. Without a policy the addresses
+// are returned as they are, with IPv6 only reported as ExternalIP. The policies report the IPv4 and IPv6 addresses
+// of the families they include, the primary family first, and use the public IPv6 address as IPv6 InternalIP
+// since VPC addresses are IPv4 only.
+func applyIPFamilyPolicy(addresses []v1.NodeAddress, policy string) ([]v1.NodeAddress, error) {
+	if policy == "" {
+		return addresses, nil
+	}
+
+	var hostnames, internal4, internal6, external4, external6 []v1.NodeAddress
+	for _, address := range addresses {
+		if address.Type == v1.NodeHostName {
+			hostnames = append(hostnames, address)
+			continue
+		}
+
+		ip := net.ParseIP(address.Address)
+		isV6 := ip != nil && ip.To4() == nil
+
+		switch {
+		case address.Type == v1.NodeInternalIP && isV6:
+			internal6 = append(internal6, address)
+		case address.Type == v1.NodeInternalIP:
+			internal4 = append(internal4, address)
+		case isV6:
+			external6 = append(external6, address)
+		default:
+			external4 = append(external4, address)
+		}
+	}
+
+	if len(internal6) == 0 {
+		for _, address := range external6 {
+			internal6 = append(internal6, v1.NodeAddress{Type: v1.NodeInternalIP, Address: address.Address})
+		}
+	}
+
+	hasV4 := len(internal4)+len(external4) > 0
+	hasV6 := len(external6)+len(internal6) > 0
+
+	result := hostnames
+	switch policy {
+	case ipFamilyIPv4:
+		if !hasV4 {
+			return nil, fmt.Errorf("no IPv4 address for IP family policy %s", policy)
+		}
+		result = concatAddresses(result, internal4, external4)
+	case ipFamilyIPv6:
+		if !hasV6 {
+			return nil, fmt.Errorf("no IPv6 address for IP family policy %s", policy)
+		}
+		result = concatAddresses(result, internal6, external6)
+	case ipFamilyDualStackPrimaryV4:
+		if !hasV4 {
+			return nil, fmt.Errorf("no IPv4 address for IP family policy %s", policy)
+		}
+		result = concatAddresses(result, internal4, internal6, external4, external6)
+	case ipFamilyDualStackPrimaryV6:
+		if !hasV6 {
+			return nil, fmt.Errorf("no IPv6 address for IP family policy %s", policy)
+		}
+		result = concatAddresses(result, internal6, internal4, external6, external4)
+	default:
+		return nil, validateIPFamilyPolicy(policy)
+	}
+
+	return result, nil
+}
+
+func concatAddresses(lists ...[]v1.NodeAddress) []v1.NodeAddress {
+	var result []v1.NodeAddress
+	for _, list := range lists {
+		result = append(result, list...)
+	}
+	return result
+}
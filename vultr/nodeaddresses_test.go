@@ -0,0 +1,270 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInstancesV2_NodeAddresses_VPCPolicy(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         NodeAddressConfig
+		annotations map[string]string
+		expected    []v1.NodeAddress
+		expectErr   bool
+	}{
+		{
+			name: "internal IP without a policy",
+			expected: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "ccm-test"},
+				{Type: v1.NodeInternalIP, Address: "10.1.95.4"},
+				{Type: v1.NodeExternalIP, Address: "149.28.225.110"},
+			},
+		},
+		{
+			name: "vpc by description from config",
+			cfg:  NodeAddressConfig{InternalVPC: "k8s-backend"},
+			expected: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "ccm-test"},
+				{Type: v1.NodeInternalIP, Address: "10.2.96.4"},
+				{Type: v1.NodeInternalIP, Address: "10.1.95.4"},
+				{Type: v1.NodeExternalIP, Address: "149.28.225.110"},
+			},
+		},
+		{
+			name: "vpc by ID from annotation without other addresses",
+			cfg:  NodeAddressConfig{InternalVPC: "k8s-backend"},
+			annotations: map[string]string{
+				annoNodeInternalVPC:       "9c7f4a36-3e52-4c3e-9d3f-2a0ad7a3bb11",
+				annoNodeOtherVPCAddresses: otherVPCAddressesNone,
+			},
+			expected: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "ccm-test"},
+				{Type: v1.NodeInternalIP, Address: "10.1.95.4"},
+				{Type: v1.NodeExternalIP, Address: "149.28.225.110"},
+			},
+		},
+		{
+			name:      "vpc not attached",
+			cfg:       NodeAddressConfig{InternalVPC: "k8s-storage"},
+			expectErr: true,
+		},
+		{
+			name:        "invalid annotation",
+			annotations: map[string]string{annoNodeOtherVPCAddresses: "external"},
+			expectErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			instances := newInstancesV2(client, newInventory(client, CacheConfig{}), test.cfg, NodeMatchingConfig{}, nil)
+
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "ccm-test", Annotations: test.annotations},
+				Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+			}
+
+			actual, err := instances.InstanceMetadata(context.TODO(), node)
+			if test.expectErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(actual.NodeAddresses, test.expected) {
+				t.Errorf("expcted %+v got %+v", test.expected, actual.NodeAddresses)
+			}
+		})
+	}
+}
+
+func TestInstancesV2_VPCInternalAddresses_Deterministic(t *testing.T) {
+	instances := &instancesv2{}
+	policy := addressPolicy{otherVPCAddresses: otherVPCAddressesInternal}
+
+	vpcs := []vpcAddress{
+		{vpcID: "c", address: "10.3.0.1"},
+		{vpcID: "a", address: "10.1.0.1"},
+		{vpcID: "b", address: "10.2.0.1"},
+		{vpcID: "a", address: "10.1.0.1"},
+	}
+
+	expected := []v1.NodeAddress{
+		{Type: v1.NodeInternalIP, Address: "10.1.0.1"},
+		{Type: v1.NodeInternalIP, Address: "10.2.0.1"},
+		{Type: v1.NodeInternalIP, Address: "10.3.0.1"},
+	}
+
+	for n := 0; n < 3; n++ {
+		actual, err := instances.vpcInternalAddresses(context.TODO(), policy, vpcs)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("expcted %+v got %+v", expected, actual)
+		}
+
+		vpcs = append(vpcs[1:], vpcs[0])
+	}
+}
+
+func TestApplyIPFamilyPolicy(t *testing.T) {
+	addresses := []v1.NodeAddress{
+		{Type: v1.NodeHostName, Address: "ccm-test"},
+		{Type: v1.NodeInternalIP, Address: "10.1.95.4"},
+		{Type: v1.NodeExternalIP, Address: "149.28.225.110"},
+		{Type: v1.NodeExternalIP, Address: "2001:19f0:5:1::1"},
+	}
+
+	tests := []struct {
+		policy    string
+		addresses []v1.NodeAddress
+		expected  []v1.NodeAddress
+		expectErr bool
+	}{
+		{
+			policy:    "",
+			addresses: addresses,
+			expected:  addresses,
+		},
+		{
+			policy:    ipFamilyIPv4,
+			addresses: addresses,
+			expected: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "ccm-test"},
+				{Type: v1.NodeInternalIP, Address: "10.1.95.4"},
+				{Type: v1.NodeExternalIP, Address: "149.28.225.110"},
+			},
+		},
+		{
+			policy:    ipFamilyIPv6,
+			addresses: addresses,
+			expected: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "ccm-test"},
+				{Type: v1.NodeInternalIP, Address: "2001:19f0:5:1::1"},
+				{Type: v1.NodeExternalIP, Address: "2001:19f0:5:1::1"},
+			},
+		},
+		{
+			policy:    ipFamilyDualStackPrimaryV4,
+			addresses: addresses,
+			expected: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "ccm-test"},
+				{Type: v1.NodeInternalIP, Address: "10.1.95.4"},
+				{Type: v1.NodeInternalIP, Address: "2001:19f0:5:1::1"},
+				{Type: v1.NodeExternalIP, Address: "149.28.225.110"},
+				{Type: v1.NodeExternalIP, Address: "2001:19f0:5:1::1"},
+			},
+		},
+		{
+			policy:    ipFamilyDualStackPrimaryV6,
+			addresses: addresses,
+			expected: []v1.NodeAddress{
+				{Type: v1.NodeHostName, Address: "ccm-test"},
+				{Type: v1.NodeInternalIP, Address: "2001:19f0:5:1::1"},
+				{Type: v1.NodeInternalIP, Address: "10.1.95.4"},
+				{Type: v1.NodeExternalIP, Address: "2001:19f0:5:1::1"},
+				{Type: v1.NodeExternalIP, Address: "149.28.225.110"},
+			},
+		},
+		{
+			policy:    ipFamilyIPv6,
+			addresses: addresses[:3],
+			expectErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.policy, func(t *testing.T) {
+			actual, err := applyIPFamilyPolicy(test.addresses, test.policy)
+			if test.expectErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expcted %+v got %+v", test.expected, actual)
+			}
+		})
+	}
+}
+
+// fakeVPCBareMetal returns a bare metal server attached to a VPC2 and a VPC
+type fakeVPCBareMetal struct {
+	fakeBareMetalServer
+	err error
+}
+
+func (f *fakeVPCBareMetal) ListVPCInfo(_ context.Context, _ string) ([]govultr.VPCInfo, *http.Response, error) {
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	return []govultr.VPCInfo{{ID: "0b1e3a48-7a6c-4c1d-9b0e-1f2a3b4c5d6e", IPAddress: "10.1.96.3"}}, nil, nil
+}
+
+func (f *fakeVPCBareMetal) ListVPC2Info(_ context.Context, _ string) ([]govultr.VPC2Info, *http.Response, error) { //nolint:staticcheck
+	return []govultr.VPC2Info{{ID: "f9e8d7c6-b5a4-4321-8fed-cba987654321", IPAddress: "10.9.96.3"}}, nil, nil //nolint:staticcheck
+}
+
+func TestInstancesV2_NodeBareMetalAddresses_VPCOrder(t *testing.T) {
+	baremetal := &govultr.BareMetalServer{ID: "cb676a46-66fd-4dfb-b839-443f2e6c0b60", Label: "ccm-test-bm", MainIP: "149.28.225.111"}
+
+	tests := []struct {
+		name     string
+		cfg      NodeAddressConfig
+		expected []string
+	}{
+		{name: "lowest VPC ID first without a policy", expected: []string{"10.1.96.3", "10.9.96.3"}},
+		{name: "named VPC already lowest", cfg: NodeAddressConfig{InternalVPC: "0b1e3a48-7a6c-4c1d-9b0e-1f2a3b4c5d6e"}, expected: []string{"10.1.96.3", "10.9.96.3"}},
+		{name: "named VPC first", cfg: NodeAddressConfig{InternalVPC: "f9e8d7c6-b5a4-4321-8fed-cba987654321"}, expected: []string{"10.9.96.3", "10.1.96.3"}},
+		{name: "other VPCs left out", cfg: NodeAddressConfig{OtherVPCAddresses: otherVPCAddressesNone}, expected: []string{"10.1.96.3"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			client.BareMetalServer = &fakeVPCBareMetal{}
+			instances := newInstancesV2(client, newInventory(client, CacheConfig{}), test.cfg, NodeMatchingConfig{}, nil).(*instancesv2)
+
+			addresses, err := instances.nodeBareMetalAddresses(context.TODO(), &v1.Node{}, baremetal)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var actual []string
+			for _, address := range addresses {
+				if address.Type == v1.NodeInternalIP {
+					actual = append(actual, address.Address)
+				}
+			}
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("expcted %+v got %+v", test.expected, actual)
+			}
+		})
+	}
+
+	client := newFakeClient()
+	client.BareMetalServer = &fakeVPCBareMetal{err: errors.New(`{"error":"bare metal not found","status":404}`)}
+	instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil).(*instancesv2)
+	if _, err := instances.nodeBareMetalAddresses(context.TODO(), &v1.Node{}, baremetal); !isAPINotFound(err) {
+		t.Errorf("expected a not found API error got %v", err)
+	}
+}
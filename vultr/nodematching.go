@@ -0,0 +1,211 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	cloudproviderapi "k8s.io/cloud-provider/api"
+	"k8s.io/klog/v2"
+)
+
+const (
+	nodeMatchLabel    = "label"
+	nodeMatchAddress  = "address"
+	nodeMatchHostname = "hostname"
+
+	// eventReasonAmbiguousServerMatch is recorded on a node which matches more than one server
+	eventReasonAmbiguousServerMatch = "AmbiguousServerMatch"
+)
+
+// errAmbiguousServerMatch is returned when a node matches more than one server, it is not a not found error
+// so the node is left alone until the servers are told apart
+var errAmbiguousServerMatch = errors.New("node matches more than one server")
+
+func validateNodeMatchStrategies(strategies []string) error {
+	seen := make(map[string]bool, len(strategies))
+	for _, strategy := range strategies {
+		switch strategy {
+		case nodeMatchLabel, nodeMatchAddress, nodeMatchHostname:
+		default:
+			return fmt.Errorf("%q is not supported, supported values are [%s %s %s]", strategy,
+				nodeMatchLabel, nodeMatchAddress, nodeMatchHostname)
+		}
+		if seen[strategy] {
+			return fmt.Errorf("%q is listed more than once", strategy)
+		}
+		seen[strategy] = true
+	}
+	return nil
+}
+
+// nodeMatchStrategies returns the configured strategies, matching by label if none are configured
+func (i *instancesv2) nodeMatchStrategies() []string {
+	if len(i.matchCfg.Strategies) == 0 {
+		return []string{nodeMatchLabel}
+	}
+	return i.matchCfg.Strategies
+}
+
+// instanceForNode matches a node without a providerID to an instance
+func (i *instancesv2) instanceForNode(ctx context.Context, node *v1.Node) (*govultr.Instance, error) {
+	return matchNodeServer(i, node, "instance", func(strategy string) ([]*govultr.Instance, error) {
+		switch strategy {
+		case nodeMatchAddress:
+			ips := nodeIPs(node)
+			if len(ips) == 0 {
+				return nil, nil
+			}
+			return i.inventory.instancesMatching(ctx, func(instance *govultr.Instance) bool {
+				return ipIn(ips, instance.MainIP, instance.InternalIP, instance.V6MainIP)
+			})
+		case nodeMatchHostname:
+			hostnames := nodeHostnames(node)
+			return i.inventory.instancesMatching(ctx, func(instance *govultr.Instance) bool {
+				return hostnameIn(hostnames, instance.Hostname, instance.Label)
+			})
+		}
+		return i.inventory.instances.byLabel(ctx, node.Name)
+	}, func(instance *govultr.Instance) string {
+		return instance.ID
+	})
+}
+
+// bareMetalForNode matches a node without a providerID to a bare metal server
+func (i *instancesv2) bareMetalForNode(ctx context.Context, node *v1.Node) (*govultr.BareMetalServer, error) {
+	return matchNodeServer(i, node, "baremetal", func(strategy string) ([]*govultr.BareMetalServer, error) {
+		switch strategy {
+		case nodeMatchAddress:
+			ips := nodeIPs(node)
+			if len(ips) == 0 {
+				return nil, nil
+			}
+			return i.inventory.bareMetalsMatching(ctx, func(bm *govultr.BareMetalServer) bool {
+				return ipIn(ips, bm.MainIP, bm.V6MainIP)
+			})
+		case nodeMatchHostname:
+			// bare metal servers don't report a hostname, their label usually is the hostname
+			hostnames := nodeHostnames(node)
+			return i.inventory.bareMetalsMatching(ctx, func(bm *govultr.BareMetalServer) bool {
+				return hostnameIn(hostnames, bm.Label)
+			})
+		}
+		return i.inventory.bareMetals.byLabel(ctx, node.Name)
+	}, func(bm *govultr.BareMetalServer) string {
+		return bm.ID
+	})
+}
+
+// matchNodeServer tries the strategies in order and returns the server matched by the first strategy which matches
+// any. A strategy matching more than one server is an error which is recorded as an event on the node.
+func matchNodeServer[T any](i *instancesv2, node *v1.Node, kind string, candidates func(strategy string) ([]*T, error), id func(*T) string) (*T, error) {
+	for _, strategy := range i.nodeMatchStrategies() {
+		servers, err := candidates(strategy)
+		if err != nil {
+			return nil, err
+		}
+
+		switch len(servers) {
+		case 0:
+			continue
+		case 1:
+			if strategy != nodeMatchLabel {
+				klog.Infof("matched node %s to %s %s by %s", node.Name, kind, id(servers[0]), strategy)
+			}
+			return servers[0], nil
+		}
+
+		ids := make([]string, 0, len(servers))
+		for _, server := range servers {
+			ids = append(ids, id(server))
+		}
+		message := fmt.Sprintf("node matches %d %ss by %s: %s, set the providerID of the node to pick one",
+			len(servers), kind, strategy, strings.Join(ids, ", "))
+		if i.recorder != nil {
+			i.recorder.Event(node, v1.EventTypeWarning, eventReasonAmbiguousServerMatch, message)
+		}
+		return nil, fmt.Errorf("%w: %s", errAmbiguousServerMatch, message)
+	}
+
+	return nil, cloudprovider.InstanceNotFound
+}
+
+// nodeIPs returns the IPs reported for the node and the IPs passed to kubelet with --node-ip
+func nodeIPs(node *v1.Node) []string {
+	var ips []string
+	for _, address := range node.Status.Addresses {
+		if address.Type == v1.NodeInternalIP || address.Type == v1.NodeExternalIP {
+			ips = append(ips, normalizeIP(address.Address))
+		}
+	}
+	for _, ip := range strings.Split(node.Annotations[cloudproviderapi.AnnotationAlphaProvidedIPAddr], ",") {
+		if ip = strings.TrimSpace(ip); ip != "" {
+			ips = append(ips, normalizeIP(ip))
+		}
+	}
+	return ips
+}
+
+// normalizeIP returns the canonical form of an IP so differently written IPv6 addresses compare equal
+func normalizeIP(address string) string {
+	if ip := net.ParseIP(address); ip != nil {
+		return ip.String()
+	}
+	return address
+}
+
+// nodeHostnames returns the node name and the hostnames reported for the node
+func nodeHostnames(node *v1.Node) []string {
+	hostnames := []string{normalizeHostname(node.Name)}
+	for _, address := range node.Status.Addresses {
+		if address.Type == v1.NodeHostName {
+			hostnames = append(hostnames, normalizeHostname(address.Address))
+		}
+	}
+	return hostnames
+}
+
+func normalizeHostname(hostname string) string {
+	return strings.ToLower(strings.TrimSuffix(hostname, "."))
+}
+
+// hostnameIn returns whether any non empty value is one of the hostnames, or the first DNS label of one, or
+// has one as its first DNS label. This way a kubelet using an FQDN matches a server labeled with the short
+// hostname and the other way around, while FQDNs in different domains don't match.
+func hostnameIn(hostnames []string, values ...string) bool {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		value = normalizeHostname(value)
+		valueShort, _, _ := strings.Cut(value, ".")
+		for _, hostname := range hostnames {
+			short, _, _ := strings.Cut(hostname, ".")
+			if value == hostname || value == short || valueShort == hostname {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ipIn returns whether any non empty value is one of the IPs
+func ipIn(ips []string, values ...string) bool {
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		value = normalizeIP(value)
+		for _, ip := range ips {
+			if ip == value {
+				return true
+			}
+		}
+	}
+	return false
+}
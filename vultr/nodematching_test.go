@@ -0,0 +1,173 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	cloudprovider "k8s.io/cloud-provider"
+)
+
+// fakeDuplicateInstance has two instances sharing a public IP and hostname
+type fakeDuplicateInstance struct {
+	govultr.InstanceService
+}
+
+func (f *fakeDuplicateInstance) instances() []govultr.Instance {
+	return []govultr.Instance{
+		{ID: "0c1a4f7e-9d2b-4b3a-8f6e-1a2b3c4d5e6f", Label: "worker-a", Hostname: "worker", MainIP: "149.28.225.110", Status: ACTIVE},
+		{ID: "7d8e9f0a-1b2c-4d3e-9f4a-5b6c7d8e9f0a", Label: "worker-b", Hostname: "worker", MainIP: "149.28.225.110", Status: ACTIVE},
+	}
+}
+
+func (f *fakeDuplicateInstance) Get(_ context.Context, id string) (*govultr.Instance, *http.Response, error) {
+	for _, instance := range f.instances() {
+		if instance.ID == id {
+			return &instance, nil, nil
+		}
+	}
+	return nil, nil, errors.New(`{"error":"invalid instance ID","status":404}`)
+}
+
+func (f *fakeDuplicateInstance) List(_ context.Context, _ *govultr.ListOptions) ([]govultr.Instance, *govultr.Meta, *http.Response, error) {
+	return f.instances(), &govultr.Meta{Links: &govultr.Links{}}, nil, nil
+}
+
+func TestInstancesV2_InstanceMetadata_NodeMatching(t *testing.T) {
+	tests := []struct {
+		name       string
+		strategies []string
+		node       *v1.Node
+		expected   string
+	}{
+		{
+			name:       "label",
+			strategies: []string{nodeMatchLabel},
+			node:       &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"}},
+			expected:   "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8",
+		},
+		{
+			name:       "address",
+			strategies: []string{nodeMatchLabel, nodeMatchAddress},
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker-1"},
+				Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+					{Type: v1.NodeInternalIP, Address: "10.1.95.4"},
+				}},
+			},
+			expected: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8",
+		},
+		{
+			name:       "provided node IP",
+			strategies: []string{nodeMatchAddress},
+			node: &v1.Node{ObjectMeta: metav1.ObjectMeta{
+				Name:        "worker-1",
+				Annotations: map[string]string{"alpha.kubernetes.io/provided-node-ip": "149.28.225.110"},
+			}},
+			expected: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8",
+		},
+		{
+			name:       "hostname",
+			strategies: []string{nodeMatchLabel, nodeMatchHostname},
+			node:       &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "ccm-test.example.com"}},
+			expected:   "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8",
+		},
+		{
+			name:       "bare metal hostname",
+			strategies: []string{nodeMatchLabel, nodeMatchHostname},
+			node:       &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "ccm-test-bm.example.com"}},
+			expected:   "vultr://cb676a46-66fd-4dfb-b839-443f2e6c0b60",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{},
+				NodeMatchingConfig{Strategies: test.strategies}, nil)
+
+			actual, err := instances.InstanceMetadata(context.TODO(), test.node)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual.ProviderID != test.expected {
+				t.Errorf("expcted %s got %s", test.expected, actual.ProviderID)
+			}
+		})
+	}
+}
+
+func TestInstancesV2_InstanceExists_NodeMatchingLabelOnly(t *testing.T) {
+	client := newFakeClient()
+	instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil)
+
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "ccm-test.example.com"}}
+
+	exists, err := instances.InstanceExists(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exists {
+		t.Error("expected no server to match by label")
+	}
+}
+
+func TestInstancesV2_InstanceMetadata_NodeMatchingAmbiguous(t *testing.T) {
+	for _, strategy := range []string{nodeMatchAddress, nodeMatchHostname} {
+		t.Run(strategy, func(t *testing.T) {
+			client := &govultr.Client{Instance: &fakeDuplicateInstance{}}
+			recorder := record.NewFakeRecorder(1)
+			instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{},
+				NodeMatchingConfig{Strategies: []string{nodeMatchLabel, strategy}}, nil).(*instancesv2)
+			instances.setEventRecorder(recorder)
+
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "worker.example.com"},
+				Status: v1.NodeStatus{Addresses: []v1.NodeAddress{
+					{Type: v1.NodeExternalIP, Address: "149.28.225.110"},
+				}},
+			}
+
+			_, err := instances.InstanceMetadata(context.TODO(), node)
+			if !errors.Is(err, errAmbiguousServerMatch) {
+				t.Fatalf("expected ambiguous match error got %v", err)
+			}
+			if errors.Is(err, cloudprovider.InstanceNotFound) {
+				t.Error("expected ambiguous match not to be reported as not found")
+			}
+
+			event := <-recorder.Events
+			if !strings.Contains(event, eventReasonAmbiguousServerMatch) ||
+				!strings.Contains(event, "0c1a4f7e-9d2b-4b3a-8f6e-1a2b3c4d5e6f, 7d8e9f0a-1b2c-4d3e-9f4a-5b6c7d8e9f0a") {
+				t.Errorf("unexpected event %q", event)
+			}
+		})
+	}
+}
+
+func TestHostnameIn(t *testing.T) {
+	tests := []struct {
+		hostnames []string
+		value     string
+		expected  bool
+	}{
+		{hostnames: []string{"worker-1"}, value: "worker-1", expected: true},
+		{hostnames: []string{"worker-1.example.com"}, value: "worker-1", expected: true},
+		{hostnames: []string{"worker-1"}, value: "Worker-1.example.com.", expected: true},
+		{hostnames: []string{"worker-1.example.com"}, value: "worker-1.example.org", expected: false},
+		{hostnames: []string{"worker-1"}, value: "worker-10", expected: false},
+		{hostnames: []string{"worker-1"}, value: "", expected: false},
+	}
+
+	for _, test := range tests {
+		if actual := hostnameIn(test.hostnames, test.value); actual != test.expected {
+			t.Errorf("%v/%s: expcted %t got %t", test.hostnames, test.value, test.expected, actual)
+		}
+	}
+}
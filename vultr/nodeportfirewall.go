@@ -0,0 +1,445 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// nodePortFirewallGroupDescription is the description of the managed firewall group, followed by the cluster ID
+	nodePortFirewallGroupDescription = "vultr-ccm-nodeports"
+
+	// nodePortFirewallRuleNotesPrefix marks the rules of the group which are managed by the CCM, other rules are left alone
+	nodePortFirewallRuleNotesPrefix = "vultr-ccm:"
+
+	nodePortFirewallSyncPeriod = 5 * time.Minute
+
+	instanceFeatureDDOSProtection = "ddos_protection"
+)
+
+// nodePortFirewallController keeps a firewall group of the cluster open to the NodePorts and health check ports of
+// LoadBalancer services from the addresses of their load balancers, and attaches the group to the instances backing
+// nodes when attachToNodes is set.
+// Every change to a LoadBalancer service or new node queues a reconcile of the whole group so rules of removed
+// ports and services are pruned.
+type nodePortFirewallController struct {
+	client        *govultr.Client
+	loadbalancers *loadbalancers
+	instances     *instancesv2
+	serviceLister corelisters.ServiceLister
+	nodeLister    corelisters.NodeLister
+
+	description   string
+	attachToNodes bool
+	queue         chan struct{}
+}
+
+// nodePortFirewallRule is a rule of the managed group, identified by everything but its notes
+type nodePortFirewallRule struct {
+	ipType     string
+	protocol   string
+	subnet     string
+	subnetSize int
+	port       string
+	notes      string
+}
+
+func (r nodePortFirewallRule) key() string {
+	return fmt.Sprintf("%s/%s/%s/%d/%s", r.ipType, r.protocol, r.subnet, r.subnetSize, r.port)
+}
+
+// newNodePortFirewallController registers the controller with the service and node informers
+func newNodePortFirewallController(informerFactory informers.SharedInformerFactory, client *govultr.Client, lbs *loadbalancers, instances *instancesv2,
+	clusterID string, attachToNodes bool) (*nodePortFirewallController, error) {
+	c := &nodePortFirewallController{
+		client:        client,
+		loadbalancers: lbs,
+		instances:     instances,
+		serviceLister: informerFactory.Core().V1().Services().Lister(),
+		nodeLister:    informerFactory.Core().V1().Nodes().Lister(),
+		description:   nodePortFirewallGroupDescription + "-" + clusterID,
+		attachToNodes: attachToNodes,
+		queue:         make(chan struct{}, 1),
+	}
+	_, err := informerFactory.Core().V1().Services().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if service, ok := obj.(*v1.Service); ok && service.Spec.Type == v1.ServiceTypeLoadBalancer {
+				c.enqueue()
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldService, ok := oldObj.(*v1.Service)
+			if !ok {
+				return
+			}
+			service, ok := newObj.(*v1.Service)
+			if ok && nodePortFirewallChanged(oldService, service) {
+				c.enqueue()
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if service, ok := obj.(*v1.Service); ok && service.Spec.Type == v1.ServiceTypeLoadBalancer {
+				c.enqueue()
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = informerFactory.Core().V1().Nodes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(_ interface{}) {
+			c.enqueue()
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, ok := oldObj.(*v1.Node)
+			if !ok {
+				return
+			}
+			if node, ok := newObj.(*v1.Node); ok && oldNode.Spec.ProviderID != node.Spec.ProviderID {
+				c.enqueue()
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// nodePortFirewallChanged returns whether a service update can change the rules of the group
+func nodePortFirewallChanged(oldService, service *v1.Service) bool {
+	if oldService.Spec.Type != v1.ServiceTypeLoadBalancer && service.Spec.Type != v1.ServiceTypeLoadBalancer {
+		return false
+	}
+
+	return oldService.Spec.Type != service.Spec.Type ||
+		!reflect.DeepEqual(oldService.Spec.Ports, service.Spec.Ports) ||
+		!reflect.DeepEqual(oldService.Annotations, service.Annotations) ||
+		!reflect.DeepEqual(oldService.Status.LoadBalancer, service.Status.LoadBalancer)
+}
+
+// enqueue requests a reconcile, requests made while one is pending are merged
+func (c *nodePortFirewallController) enqueue() {
+	select {
+	case c.queue <- struct{}{}:
+	default:
+	}
+}
+
+// Run reconciles the group when requested and periodically until the context is done
+func (c *nodePortFirewallController) Run(ctx context.Context) {
+	ticker := time.NewTicker(nodePortFirewallSyncPeriod)
+	defer ticker.Stop()
+
+	c.enqueue()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-c.queue:
+		case <-ticker.C:
+		}
+
+		if err := c.reconcile(ctx); err != nil {
+			klog.Errorf("failed to reconcile node port firewall group: %v", err)
+		}
+	}
+}
+
+// reconcile makes the managed rules of the group match the LoadBalancer services and attaches the group to nodes
+// if enabled
+func (c *nodePortFirewallController) reconcile(ctx context.Context) error {
+	desired, err := c.desiredRules(ctx)
+	if err != nil {
+		return err
+	}
+
+	group, err := c.ensureGroup(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := c.syncRules(ctx, group.ID, desired); err != nil {
+		return err
+	}
+
+	if !c.attachToNodes {
+		return nil
+	}
+	return c.attachNodes(ctx, group.ID)
+}
+
+// desiredRules returns the rules for every LoadBalancer service with a load balancer. Any error looking up a load
+// balancer fails the reconcile, so rules are never pruned because of a failed lookup.
+func (c *nodePortFirewallController) desiredRules(ctx context.Context) (map[string]nodePortFirewallRule, error) {
+	services, err := c.serviceLister.List(labels.Everything())
+	if err != nil {
+		return nil, fmt.Errorf("failed to list services: %w", err)
+	}
+	sort.Slice(services, func(a, b int) bool {
+		return services[a].Namespace+"/"+services[a].Name < services[b].Namespace+"/"+services[b].Name
+	})
+
+	rules := make(map[string]nodePortFirewallRule)
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+
+		service = c.loadbalancers.withDefaultAnnotations(service)
+		if strings.EqualFold(service.Annotations[annoVultrLoadBalancerCreate], "false") {
+			continue
+		}
+
+		lb, err := c.loadbalancers.getVultrLB(ctx, service)
+		if err == errLbNotFound || err == errLbNotOwned || isLegacyLB(err) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to get load balancer of service %s/%s: %w", service.Namespace, service.Name, err)
+		}
+
+		for _, rule := range nodePortFirewallRules(service, lb) {
+			if _, ok := rules[rule.key()]; !ok {
+				rules[rule.key()] = rule
+			}
+		}
+	}
+
+	return rules, nil
+}
+
+// nodePortFirewallRules returns the rules allowing the load balancer of the service to reach its backend
+// and health check ports on the nodes
+func nodePortFirewallRules(service *v1.Service, lb *govultr.LoadBalancer) []nodePortFirewallRule {
+	ports := make(map[string]string)
+
+	forwardingRules, err := buildForwardingRules(service)
+	if err != nil {
+		klog.Warningf("skipping node port firewall rules of service %s/%s: %v", service.Namespace, service.Name, err)
+		return nil
+	}
+	for _, rule := range forwardingRules {
+		if rule.BackendPort > 0 {
+			ports[firewallProtocol(rule.BackendProtocol)+"/"+strconv.Itoa(rule.BackendPort)] = firewallProtocol(rule.BackendProtocol)
+		}
+	}
+
+	if healthCheck, err := buildHealthChecks(service); err != nil {
+		klog.Warningf("skipping health check firewall rule of service %s/%s: %v", service.Namespace, service.Name, err)
+	} else if healthCheck.Port > 0 {
+		ports[firewallProtocol(healthCheck.Protocol)+"/"+strconv.Itoa(healthCheck.Port)] = firewallProtocol(healthCheck.Protocol)
+	}
+
+	type source struct {
+		ipType string
+		subnet string
+		size   int
+	}
+	var sources []source
+	if lb.IPV4 != "" {
+		sources = append(sources, source{ipType: "v4", subnet: lb.IPV4, size: 32})
+	}
+	if lb.IPV6 != "" {
+		sources = append(sources, source{ipType: "v6", subnet: lb.IPV6, size: 128})
+	}
+
+	var rules []nodePortFirewallRule
+	for key, protocol := range ports {
+		_, port, _ := strings.Cut(key, "/")
+		for _, src := range sources {
+			rules = append(rules, nodePortFirewallRule{
+				ipType:     src.ipType,
+				protocol:   protocol,
+				subnet:     src.subnet,
+				subnetSize: src.size,
+				port:       port,
+				notes:      nodePortFirewallRuleNotesPrefix + " " + service.Namespace + "/" + service.Name,
+			})
+		}
+	}
+
+	return rules
+}
+
+// firewallProtocol returns the firewall protocol carrying a load balancer protocol
+func firewallProtocol(protocol string) string {
+	if protocol == protocolUDP {
+		return protocolUDP
+	}
+	return protocolTCP
+}
+
+// ensureGroup returns the managed firewall group, creating it if it does not exist
+func (c *nodePortFirewallController) ensureGroup(ctx context.Context) (*govultr.FirewallGroup, error) {
+	groups, err := listAll(ctx, func(ctx context.Context, opts *govultr.ListOptions) ([]govultr.FirewallGroup, *govultr.Meta, error) {
+		groups, meta, resp, err := c.client.FirewallGroup.List(ctx, opts) //nolint:bodyclose
+		return groups, meta, newAPIError(resp, err)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list firewall groups: %w", err)
+	}
+
+	var matches []govultr.FirewallGroup
+	for _, group := range groups {
+		if group.Description == c.description {
+			matches = append(matches, group)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		group, resp, err := c.client.FirewallGroup.Create(ctx, &govultr.FirewallGroupReq{Description: c.description}) //nolint:bodyclose
+		if err != nil {
+			return nil, fmt.Errorf("failed to create firewall group %s: %w", c.description, newAPIError(resp, err))
+		}
+		klog.Infof("created firewall group %s (%s)", c.description, group.ID)
+		return group, nil
+	case 1:
+		return &matches[0], nil
+	}
+
+	ids := make([]string, 0, len(matches))
+	for _, group := range matches {
+		ids = append(ids, group.ID)
+	}
+	return nil, fmt.Errorf("multiple firewall groups found with description %q: IDs %v - unique description required", c.description, ids)
+}
+
+// syncRules creates the missing rules and deletes the managed rules which are no longer desired
+func (c *nodePortFirewallController) syncRules(ctx context.Context, groupID string, desired map[string]nodePortFirewallRule) error {
+	existing, err := listAll(ctx, func(ctx context.Context, opts *govultr.ListOptions) ([]govultr.FirewallRule, *govultr.Meta, error) {
+		rules, meta, resp, err := c.client.FirewallRule.List(ctx, groupID, opts) //nolint:bodyclose
+		return rules, meta, newAPIError(resp, err)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list rules of firewall group %s: %w", groupID, err)
+	}
+
+	present := make(map[string]bool, len(existing))
+	for _, rule := range existing {
+		if !strings.HasPrefix(rule.Notes, nodePortFirewallRuleNotesPrefix) {
+			continue
+		}
+
+		key := nodePortFirewallRule{
+			ipType:     rule.IPType,
+			protocol:   rule.Protocol,
+			subnet:     rule.Subnet,
+			subnetSize: rule.SubnetSize,
+			port:       rule.Port,
+		}.key()
+		if _, ok := desired[key]; ok && !present[key] {
+			present[key] = true
+			continue
+		}
+
+		if err := c.client.FirewallRule.Delete(ctx, groupID, rule.ID); err != nil {
+			return fmt.Errorf("failed to delete firewall rule %d: %w", rule.ID, newAPIError(nil, err))
+		}
+		klog.Infof("deleted firewall rule %s %s %s/%d port %s (%s)", rule.IPType, rule.Protocol, rule.Subnet, rule.SubnetSize, rule.Port, rule.Notes)
+	}
+
+	keys := make([]string, 0, len(desired))
+	for key := range desired {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if present[key] {
+			continue
+		}
+
+		rule := desired[key]
+		_, resp, err := c.client.FirewallRule.Create(ctx, groupID, &govultr.FirewallRuleReq{ //nolint:bodyclose
+			IPType:     rule.ipType,
+			Protocol:   rule.protocol,
+			Subnet:     rule.subnet,
+			SubnetSize: rule.subnetSize,
+			Port:       rule.port,
+			Notes:      rule.notes,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create firewall rule %s %s %s/%d port %s: %w", rule.ipType, rule.protocol,
+				rule.subnet, rule.subnetSize, rule.port, newAPIError(resp, err))
+		}
+		klog.Infof("created firewall rule %s %s %s/%d port %s (%s)", rule.ipType, rule.protocol, rule.subnet, rule.subnetSize, rule.port, rule.notes)
+	}
+
+	return nil
+}
+
+// attachNodes attaches the group to the instances backing nodes which have no firewall group. Instances with another
+// group are left alone since an instance can only have one group, and bare metal servers don't support firewall groups.
+// A node which fails does not stop the others from being attached, the errors are returned together.
+func (c *nodePortFirewallController) attachNodes(ctx context.Context, groupID string) error {
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		return fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	var errs []error
+	for _, node := range nodes {
+		server, err := c.instances.getVultrServer(ctx, node)
+		if err != nil {
+			if !isServerNotFound(err) {
+				errs = append(errs, fmt.Errorf("node %s: %w", node.Name, err))
+			}
+			continue
+		}
+
+		if server.bareMetal != nil {
+			klog.V(logLevelDebug).Infof("not attaching firewall group to node %s, bare metal servers don't support firewall groups", node.Name)
+			continue
+		}
+
+		instance := server.instance
+		switch instance.FirewallGroupID {
+		case groupID:
+			continue
+		case "":
+		default:
+			klog.Warningf("not attaching firewall group %s to node %s, its instance already has firewall group %s", groupID, node.Name, instance.FirewallGroupID)
+			continue
+		}
+
+		// tags and DDoS protection are not omitted when empty so their current values are sent to keep them
+		tags := instance.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		_, resp, err := c.client.Instance.Update(ctx, instance.ID, &govultr.InstanceUpdateReq{ //nolint:bodyclose
+			FirewallGroupID: groupID,
+			Tags:            tags,
+			DDOSProtection:  govultr.BoolToBoolPtr(slices.Contains(instance.Features, instanceFeatureDDOSProtection)),
+		})
+		c.instances.inventory.instanceChanged(instance.ID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to attach firewall group %s to node %s: %w", groupID, node.Name, newAPIError(resp, err)))
+			continue
+		}
+		klog.Infof("attached firewall group %s to node %s", groupID, node.Name)
+	}
+
+	return errors.Join(errs...)
+}
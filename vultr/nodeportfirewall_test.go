@@ -0,0 +1,221 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+type fakeFirewallGroup struct {
+	govultr.FirewallGroupService
+	groups []govultr.FirewallGroup
+}
+
+func (f *fakeFirewallGroup) Create(_ context.Context, req *govultr.FirewallGroupReq) (*govultr.FirewallGroup, *http.Response, error) {
+	group := govultr.FirewallGroup{ID: "1d5a6b2c-3e4f-4a5b-8c6d-7e8f9a0b1c2d", Description: req.Description}
+	f.groups = append(f.groups, group)
+	return &group, nil, nil
+}
+
+func (f *fakeFirewallGroup) List(_ context.Context, _ *govultr.ListOptions) ([]govultr.FirewallGroup, *govultr.Meta, *http.Response, error) {
+	return f.groups, &govultr.Meta{Links: &govultr.Links{}}, nil, nil
+}
+
+type fakeFirewallRule struct {
+	govultr.FireWallRuleService
+	rules  []govultr.FirewallRule
+	nextID int
+}
+
+func (f *fakeFirewallRule) Create(_ context.Context, _ string, req *govultr.FirewallRuleReq) (*govultr.FirewallRule, *http.Response, error) {
+	f.nextID++
+	rule := govultr.FirewallRule{
+		ID:         f.nextID,
+		Action:     "accept",
+		IPType:     req.IPType,
+		Protocol:   req.Protocol,
+		Subnet:     req.Subnet,
+		SubnetSize: req.SubnetSize,
+		Port:       req.Port,
+		Notes:      req.Notes,
+	}
+	f.rules = append(f.rules, rule)
+	return &rule, nil, nil
+}
+
+func (f *fakeFirewallRule) Delete(_ context.Context, _ string, id int) error {
+	for i, rule := range f.rules {
+		if rule.ID == id {
+			f.rules = append(f.rules[:i], f.rules[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (f *fakeFirewallRule) List(_ context.Context, _ string, _ *govultr.ListOptions) ([]govultr.FirewallRule, *govultr.Meta, *http.Response, error) {
+	return append([]govultr.FirewallRule(nil), f.rules...), &govultr.Meta{Links: &govultr.Links{}}, nil, nil
+}
+
+// fakeFirewallInstance records instance updates and fails the first failUpdates of them
+type fakeFirewallInstance struct {
+	FakeInstance
+	updates     []govultr.InstanceUpdateReq
+	failUpdates int
+}
+
+func (f *fakeFirewallInstance) Update(_ context.Context, _ string, req *govultr.InstanceUpdateReq) (*govultr.Instance, *http.Response, error) {
+	f.updates = append(f.updates, *req)
+	if len(f.updates) <= f.failUpdates {
+		return nil, nil, errors.New("update failed")
+	}
+	return nil, nil, nil
+}
+
+func TestNodePortFirewallController_Reconcile(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "web",
+			Namespace:   "default",
+			Annotations: map[string]string{annoVultrLoadBalancerID: "6334f227-6d96-4cbd-9bcb-5be0759354fa"},
+		},
+		Spec: v1.ServiceSpec{
+			Type: v1.ServiceTypeLoadBalancer,
+			Ports: []v1.ServicePort{
+				{Name: "http", Port: 80, NodePort: 30080, Protocol: v1.ProtocolTCP},
+				{Name: "https", Port: 443, NodePort: 30443, Protocol: v1.ProtocolTCP},
+			},
+		},
+	}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+	}
+
+	informerFactory := informers.NewSharedInformerFactory(fake.NewClientset(service, node), 0)
+
+	fakeGroups := &fakeFirewallGroup{}
+	fakeRules := &fakeFirewallRule{
+		rules: []govultr.FirewallRule{
+			{ID: 1, IPType: "v4", Protocol: "tcp", Subnet: "203.0.113.0", SubnetSize: 24, Port: "22", Notes: "ssh"},
+			{ID: 2, IPType: "v4", Protocol: "tcp", Subnet: "192.168.0.1", SubnetSize: 32, Port: "30080", Notes: "vultr-ccm: default/web"},
+			{ID: 3, IPType: "v4", Protocol: "tcp", Subnet: "192.168.0.1", SubnetSize: 32, Port: "31999", Notes: "vultr-ccm: default/deleted"},
+		},
+		nextID: 3,
+	}
+	fakeInstance := &fakeFirewallInstance{}
+
+	client := newFakeClient()
+	client.FirewallGroup = fakeGroups
+	client.FirewallRule = fakeRules
+	client.Instance = fakeInstance
+
+	inv := newInventory(client, CacheConfig{})
+	lbs := newLoadbalancers(client, inv, "ewr", &CloudConfig{}).(*loadbalancers)
+	instances := newInstancesV2(client, inv, NodeAddressConfig{}, NodeMatchingConfig{}, nil).(*instancesv2)
+
+	controller, err := newNodePortFirewallController(informerFactory, client, lbs, instances, "prod", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	informerFactory.Start(stop)
+	informerFactory.WaitForCacheSync(stop)
+
+	if err := controller.reconcile(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(fakeGroups.groups) != 1 || fakeGroups.groups[0].Description != "vultr-ccm-nodeports-prod" {
+		t.Fatalf("expected firewall group vultr-ccm-nodeports-prod got %+v", fakeGroups.groups)
+	}
+
+	var actual []string
+	for _, rule := range fakeRules.rules {
+		actual = append(actual, rule.Subnet+" "+rule.Port+" "+rule.Notes)
+	}
+	sort.Strings(actual)
+	expected := []string{
+		"192.168.0.1 30080 vultr-ccm: default/web",
+		"192.168.0.1 30443 vultr-ccm: default/web",
+		"203.0.113.0 22 ssh",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expcted %+v got %+v", expected, actual)
+	}
+
+	if len(fakeInstance.updates) != 1 {
+		t.Fatalf("expected the firewall group to be attached once got %d updates", len(fakeInstance.updates))
+	}
+	update := fakeInstance.updates[0]
+	if update.FirewallGroupID != "1d5a6b2c-3e4f-4a5b-8c6d-7e8f9a0b1c2d" {
+		t.Errorf("unexpected firewall group %s", update.FirewallGroupID)
+	}
+	expectedTags := []string{"pool=batch", "taint:dedicated=batch:NoSchedule"}
+	if !reflect.DeepEqual(update.Tags, expectedTags) {
+		t.Errorf("expcted tags %+v to be kept got %+v", expectedTags, update.Tags)
+	}
+}
+
+func TestNodePortFirewallController_AttachNodes(t *testing.T) {
+	nodes := []runtime.Object{
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"},
+			Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+		},
+		&v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: "ccm-test-2"},
+			Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f9"},
+		},
+	}
+
+	informerFactory := informers.NewSharedInformerFactory(fake.NewClientset(nodes...), 0)
+
+	fakeInstance := &fakeFirewallInstance{failUpdates: 1}
+
+	client := newFakeClient()
+	client.FirewallGroup = &fakeFirewallGroup{}
+	client.FirewallRule = &fakeFirewallRule{}
+	client.Instance = fakeInstance
+
+	inv := newInventory(client, CacheConfig{})
+	lbs := newLoadbalancers(client, inv, "ewr", &CloudConfig{}).(*loadbalancers)
+	instances := newInstancesV2(client, inv, NodeAddressConfig{}, NodeMatchingConfig{}, nil).(*instancesv2)
+
+	controller, err := newNodePortFirewallController(informerFactory, client, lbs, instances, "prod", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	informerFactory.Start(stop)
+	informerFactory.WaitForCacheSync(stop)
+
+	if err := controller.reconcile(context.TODO()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(fakeInstance.updates) != 0 {
+		t.Fatalf("expected no nodes to be attached by default got %d updates", len(fakeInstance.updates))
+	}
+
+	controller.attachToNodes = true
+	if err := controller.reconcile(context.TODO()); err == nil {
+		t.Fatal("expected the failed update to be returned")
+	}
+	if len(fakeInstance.updates) != 2 {
+		t.Errorf("expected both nodes to be attached after a failure got %d updates", len(fakeInstance.updates))
+	}
+}
@@ -0,0 +1,117 @@
+package vultr
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+const nodeSelectorWorkers = 2
+
+// selectBackendNodes returns the nodes matching the node selector of the service. A selector matching none of
+// the nodes is an error unless empty backends are allowed, so a typo in the selector or a relabeled node pool
+// does not take the load balancer down.
+func (l *loadbalancers) selectBackendNodes(service *v1.Service, annotations *lbAnnotations, nodes []*v1.Node) ([]*v1.Node, error) {
+	if annotations.nodeSelector == nil {
+		return nodes, nil
+	}
+
+	var selected []*v1.Node
+	for _, node := range nodes {
+		if annotations.nodeSelector.Matches(labels.Set(node.Labels)) {
+			selected = append(selected, node)
+		}
+	}
+
+	if len(selected) == 0 && len(nodes) > 0 && annotations.allowEmptyBackends {
+		klog.Warningf("node selector %q of service %s/%s matches no node", annotations.nodeSelector, service.Namespace, service.Name)
+		l.event(service, v1.EventTypeWarning, eventReasonLBNoBackendNodes,
+			"Node selector %q matches none of the %d nodes, the Vultr API keeps the nodes attached last", annotations.nodeSelector, len(nodes))
+		return selected, nil
+	}
+
+	if len(selected) == 0 && len(nodes) > 0 {
+		l.event(service, v1.EventTypeWarning, eventReasonLBNoBackendNodes,
+			"Node selector %q matches none of the %d nodes, keeping the current nodes of the load balancer", annotations.nodeSelector, len(nodes))
+		return nil, fmt.Errorf("%s %q matches none of the %d nodes, set %s to \"true\" to allow a load balancer without backends",
+			annoVultrLBNodeSelector, annotations.nodeSelector, len(nodes), annoVultrLBAllowEmptyBackends)
+	}
+
+	klog.V(logLevelDebug).Infof("node selector %q of service %s/%s matches %d of %d nodes",
+		annotations.nodeSelector, service.Namespace, service.Name, len(selected), len(nodes))
+	return selected, nil
+}
+
+// watchNodeLabels queues services with a node selector when the labels of a node change whether it matches,
+// the service controller only reconciles load balancers on label changes it knows about. The queue is synced by
+// runNodeSelectorWorkers.
+func (l *loadbalancers) watchNodeLabels(informerFactory informers.SharedInformerFactory) error {
+	l.nodeSelectorQueue = newKeyQueue("node-selectors")
+
+	_, err := informerFactory.Core().V1().Nodes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, okOld := oldObj.(*v1.Node)
+			newNode, okNew := newObj.(*v1.Node)
+			if !okOld || !okNew || reflect.DeepEqual(oldNode.Labels, newNode.Labels) {
+				return
+			}
+			l.queueNodeSelectorServices(oldNode, newNode)
+		},
+	})
+	return err
+}
+
+// queueNodeSelectorServices queues every service whose node selector matches only one of the old and new node
+func (l *loadbalancers) queueNodeSelectorServices(oldNode, newNode *v1.Node) {
+	services, err := l.serviceLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list services for node %s label change: %v", newNode.Name, err)
+		return
+	}
+
+	for _, service := range services {
+		if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+			continue
+		}
+
+		annotations, _ := parseLBAnnotations(l.withDefaultAnnotations(service))
+		selector := annotations.nodeSelector
+		if selector == nil || selector.Matches(labels.Set(oldNode.Labels)) == selector.Matches(labels.Set(newNode.Labels)) {
+			continue
+		}
+
+		klog.Infof("labels of node %s changed whether it matches the node selector of service %s/%s, updating its load balancer",
+			newNode.Name, service.Namespace, service.Name)
+		l.nodeSelectorQueue.Add(service.Namespace + "/" + service.Name)
+	}
+}
+
+// runNodeSelectorWorkers syncs the services queued by watchNodeLabels until the context is done
+func (l *loadbalancers) runNodeSelectorWorkers(ctx context.Context) {
+	if l.nodeSelectorQueue == nil {
+		return
+	}
+	runKeyWorkers(ctx, l.nodeSelectorQueue, nodeSelectorWorkers, l.syncNodeSelector)
+}
+
+// syncNodeSelector annotates the service so the service controller updates the nodes of its load balancer
+func (l *loadbalancers) syncNodeSelector(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		klog.Errorf("invalid service key %q: %v", key, err)
+		return nil
+	}
+
+	err = l.touchService(ctx, namespace, name, annoVultrLBNodesLastUpdatedTime)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,162 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func selectorNodes() []*v1.Node {
+	return []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "node1", Labels: map[string]string{"node-role": "edge"}}, Spec: v1.NodeSpec{ProviderID: "vultr://123"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node2", Labels: map[string]string{"node-role": "worker"}}, Spec: v1.NodeSpec{ProviderID: "vultr://124"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "node3", Labels: map[string]string{"node-role": "edge"}}, Spec: v1.NodeSpec{ProviderID: "vultr://125"}},
+	}
+}
+
+func TestParseLBAnnotations_NodeSelector(t *testing.T) {
+	annotations, problems := parseLBAnnotations(localService(map[string]string{annoVultrLBNodeSelector: "node-role in (edge,ingress)"}))
+	if err := problems.err(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if annotations.nodeSelector == nil || annotations.nodeSelector.String() != "node-role in (edge,ingress)" {
+		t.Errorf("expcted %q got %v", "node-role in (edge,ingress)", annotations.nodeSelector)
+	}
+
+	_, problems = parseLBAnnotations(localService(map[string]string{annoVultrLBNodeSelector: "node-role=="}))
+	if problems.err() != nil {
+		t.Errorf("expcted an empty value to be valid got %v", problems.err())
+	}
+
+	_, problems = parseLBAnnotations(localService(map[string]string{annoVultrLBNodeSelector: "node-role in edge"}))
+	if len(problems.errors) != 1 {
+		t.Errorf("expcted 1 error got %+v", problems.errors)
+	}
+}
+
+func TestLoadbalancers_BuildLoadBalancerRequest_NodeSelector(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    []string
+		expectErr   bool
+	}{
+		{
+			name:     "no selector",
+			expected: []string{"123", "124", "125"},
+		},
+		{
+			name:        "matching nodes",
+			annotations: map[string]string{annoVultrLBNodeSelector: "node-role=edge"},
+			expected:    []string{"123", "125"},
+		},
+		{
+			name:        "no matching node",
+			annotations: map[string]string{annoVultrLBNodeSelector: "node-role=ingress"},
+			expectErr:   true,
+		},
+		{
+			name:        "no matching node allowed",
+			annotations: map[string]string{annoVultrLBNodeSelector: "node-role=ingress", annoVultrLBAllowEmptyBackends: "true"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{}).(*loadbalancers)
+			recorder := record.NewFakeRecorder(10)
+			lb.setEventRecorder(recorder)
+			svc := localService(test.annotations)
+
+			req, err := lb.buildLoadBalancerRequest(context.Background(), svc, selectorNodes())
+			if test.expectErr {
+				if err == nil {
+					t.Errorf("expcted an error got %+v", req.Instances)
+				}
+				if len(recorder.Events) != 1 || !strings.HasPrefix(<-recorder.Events, "Warning "+eventReasonLBNoBackendNodes) {
+					t.Errorf("expcted a %s warning event", eventReasonLBNoBackendNodes)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(req.Instances, test.expected) {
+				t.Errorf("expcted %+v got %+v", test.expected, req.Instances)
+			}
+		})
+	}
+}
+
+func TestLoadbalancers_SyncNodeSelectors(t *testing.T) {
+	client := newFakeClient()
+	lb := newLoadbalancers(client, newInventory(client, CacheConfig{}), "1", &CloudConfig{}).(*loadbalancers)
+	edge := localService(map[string]string{annoVultrLBNodeSelector: "node-role=edge"})
+	worker := localService(map[string]string{annoVultrLBNodeSelector: "node-role=worker"})
+	worker.Name = "worker"
+	setFakeKubeClient(t, lb, edge, worker)
+	lb.nodeSelectorQueue = newKeyQueue("node-selectors")
+	defer lb.nodeSelectorQueue.ShutDown()
+
+	annotated := func(name string) bool {
+		actual, err := lb.kubeClient.CoreV1().Services(v1.NamespaceDefault).Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		_, ok := actual.Annotations[annoVultrLBNodesLastUpdatedTime]
+		return ok
+	}
+
+	node := selectorNodes()[1]
+
+	// a label change which does not change whether the node matches leaves the services alone
+	zoned := node.DeepCopy()
+	zoned.Labels["zone"] = "a"
+	lb.queueNodeSelectorServices(node, zoned)
+	if lb.nodeSelectorQueue.Len() != 0 {
+		t.Errorf("expcted no service to be queued got %d", lb.nodeSelectorQueue.Len())
+	}
+
+	edgeNode := zoned.DeepCopy()
+	edgeNode.Labels["node-role"] = "edge"
+	lb.queueNodeSelectorServices(zoned, edgeNode)
+	if lb.nodeSelectorQueue.Len() != 2 {
+		t.Fatalf("expcted both services to be queued got %d", lb.nodeSelectorQueue.Len())
+	}
+	if annotated("lb-name") || annotated("worker") {
+		t.Error("expcted no service to be annotated before the queue is synced")
+	}
+
+	for range 2 {
+		processNextKey(context.Background(), lb.nodeSelectorQueue, lb.syncNodeSelector)
+	}
+	if !annotated("lb-name") || !annotated("worker") {
+		t.Errorf("expcted both services to be annotated with %s", annoVultrLBNodesLastUpdatedTime)
+	}
+
+	// failed updates are returned so the key is retried, services which are gone are dropped
+	lb.kubeClient.(*fake.Clientset).PrependReactor("patch", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.PatchAction).GetName() == "missing" {
+			return true, nil, apierrors.NewNotFound(v1.Resource("services"), "missing")
+		}
+		return true, nil, errors.New("connection refused")
+	})
+	if err := lb.syncNodeSelector(context.Background(), v1.NamespaceDefault+"/lb-name"); err == nil {
+		t.Error("expcted the failed update to be returned")
+	}
+	if err := lb.syncNodeSelector(context.Background(), v1.NamespaceDefault+"/missing"); err != nil {
+		t.Errorf("expcted a missing service to be dropped got %v", err)
+	}
+}
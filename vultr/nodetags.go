@@ -0,0 +1,399 @@
+package vultr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// tagTaintPrefix marks server tags which are synced as taints, taint:<key>[=<value>][:<effect>]
+	tagTaintPrefix = "taint:"
+
+	// annoNodeTagLabels lists the label keys synced from tags so they can be removed with the tag
+	annoNodeTagLabels = "vultr.com/tag-labels"
+
+	// annoNodeTagTaints lists the taints synced from tags as <key>:<effect> so they can be removed with the tag
+	annoNodeTagTaints = "vultr.com/tag-taints"
+
+	// eventReasonNodeTagConflict is recorded on a node with labels or taints set by tags which were not synced from tags
+	eventReasonNodeTagConflict = "NodeTagConflict"
+
+	nodeTagSyncPeriod = 5 * time.Minute
+	nodeTagWorkers    = 2
+)
+
+// reservedKeyRegex matches label and taint keys which can not be set from tags, like the node lifecycle taints
+var reservedKeyRegex = regexp.MustCompile(`(^|\.)(kubernetes\.io|k8s\.io|vultr\.com)/`)
+
+// nodeTagController keeps the labels and taints of nodes in sync with the tags of the Vultr servers backing
+// them. Tags of the form <key>=<value> become labels and tags prefixed with taint: become taints. Keys synced
+// from tags are recorded on the node so they are removed once the tag is removed, other keys are left alone.
+type nodeTagController struct {
+	kubeClient kubernetes.Interface
+	nodeLister corelisters.NodeLister
+	instances  *instancesv2
+	queue      workqueue.TypedRateLimitingInterface[string]
+}
+
+// newNodeTagController registers the controller with the node informer, new nodes are queued when they are added
+func newNodeTagController(kubeClient kubernetes.Interface, informerFactory informers.SharedInformerFactory, instances *instancesv2) (*nodeTagController, error) {
+	c := &nodeTagController{
+		kubeClient: kubeClient,
+		nodeLister: informerFactory.Core().V1().Nodes().Lister(),
+		instances:  instances,
+		queue:      newKeyQueue("node-tags"),
+	}
+
+	_, err := informerFactory.Core().V1().Nodes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*v1.Node); ok {
+				c.queue.Add(node.Name)
+			}
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Run syncs the queued nodes until the context is done. Every node is queued periodically since tag changes
+// are not visible to the cluster.
+func (c *nodeTagController) Run(ctx context.Context) {
+	go runKeyWorkers(ctx, c.queue, nodeTagWorkers, c.syncKey)
+
+	ticker := time.NewTicker(nodeTagSyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.enqueueAll()
+		}
+	}
+}
+
+func (c *nodeTagController) enqueueAll() {
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list nodes for tag sync: %v", err)
+		return
+	}
+
+	for _, node := range nodes {
+		c.queue.Add(node.Name)
+	}
+}
+
+// syncKey syncs the tags of the node with the given name, nodes which were removed are skipped
+func (c *nodeTagController) syncKey(ctx context.Context, name string) error {
+	node, err := c.nodeLister.Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := c.syncNode(ctx, node); err != nil {
+		return fmt.Errorf("failed to sync tags of node %s: %w", name, err)
+	}
+	return nil
+}
+
+// syncNode applies the tags of the server backing the node to the node
+func (c *nodeTagController) syncNode(ctx context.Context, node *v1.Node) error {
+	server, err := c.instances.getVultrServer(ctx, node)
+	if err != nil {
+		if isServerNotFound(err) {
+			klog.V(logLevelDebug).Infof("skipping tag sync of node %s, no server found", node.Name)
+			return nil
+		}
+		return err
+	}
+
+	var tags []string
+	if server.bareMetal != nil {
+		tags = server.bareMetal.Tags
+	} else {
+		tags = server.instance.Tags
+	}
+	desiredLabels, desiredTaints := parseNodeTags(tags)
+
+	updated := node.DeepCopy()
+	changed, conflicts := applyNodeTags(updated, desiredLabels, desiredTaints)
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		message := fmt.Sprintf("tags set %s which the node already has, remove them from the node to sync them from tags",
+			strings.Join(conflicts, ", "))
+		klog.Warningf("node %s: %s", node.Name, message)
+		if c.instances.recorder != nil {
+			c.instances.recorder.Event(node, v1.EventTypeWarning, eventReasonNodeTagConflict, message)
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	patch, err := nodeTagPatch(node, updated)
+	if err != nil {
+		return err
+	}
+
+	// a conflict means the node changed since it was listed, the key is retried with the newer node
+	if _, err := c.kubeClient.CoreV1().Nodes().Patch(ctx, node.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return err
+	}
+
+	klog.Infof("synced tags of node %s: labels %v, taints %v", node.Name, desiredLabels, desiredTaints)
+	return nil
+}
+
+// nodeTagPatch returns a strategic merge patch of the labels, taints and tracking annotations changed from the
+// original node. The taints are replaced as a whole, so the patch is conditional on the resource version of the
+// original node when they changed to not drop taints added meanwhile.
+func nodeTagPatch(original, updated *v1.Node) ([]byte, error) {
+	originalJSON, err := json.Marshal(original)
+	if err != nil {
+		return nil, err
+	}
+	updatedJSON, err := json.Marshal(updated)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := strategicpatch.CreateTwoWayMergePatch(originalJSON, updatedJSON, v1.Node{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create patch: %w", err)
+	}
+	if equality.Semantic.DeepEqual(original.Spec.Taints, updated.Spec.Taints) || original.ResourceVersion == "" {
+		return patch, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(patch, &fields); err != nil {
+		return nil, err
+	}
+	metadata, _ := fields["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+		fields["metadata"] = metadata
+	}
+	metadata["resourceVersion"] = original.ResourceVersion
+
+	return json.Marshal(fields)
+}
+
+// parseNodeTags returns the labels and taints described by server tags, tags of any other form are ignored
+func parseNodeTags(tags []string) (map[string]string, []v1.Taint) {
+	sorted := append([]string(nil), tags...)
+	sort.Strings(sorted)
+
+	nodeLabels := make(map[string]string)
+	taintsByID := make(map[string]v1.Taint)
+
+	for _, tag := range sorted {
+		if rest, ok := strings.CutPrefix(tag, tagTaintPrefix); ok {
+			taint, err := parseTaintTag(rest)
+			if err != nil {
+				klog.Warningf("ignoring tag %q: %v", tag, err)
+				continue
+			}
+			if _, exists := taintsByID[taintID(taint)]; !exists {
+				taintsByID[taintID(taint)] = taint
+			}
+			continue
+		}
+
+		key, value, ok := strings.Cut(tag, "=")
+		if !ok {
+			continue
+		}
+		if err := validateTagLabel(key, value); err != nil {
+			klog.Warningf("ignoring tag %q: %v", tag, err)
+			continue
+		}
+		if _, exists := nodeLabels[key]; !exists {
+			nodeLabels[key] = value
+		}
+	}
+
+	taints := make([]v1.Taint, 0, len(taintsByID))
+	for _, taint := range taintsByID {
+		taints = append(taints, taint)
+	}
+	sort.Slice(taints, func(a, b int) bool {
+		return taintID(taints[a]) < taintID(taints[b])
+	})
+
+	return nodeLabels, taints
+}
+
+// parseTaintTag parses <key>[=<value>][:<effect>], the effect defaults to NoSchedule
+func parseTaintTag(tag string) (v1.Taint, error) {
+	taint := v1.Taint{Effect: v1.TaintEffectNoSchedule}
+
+	if i := strings.LastIndex(tag, ":"); i >= 0 {
+		taint.Effect = v1.TaintEffect(tag[i+1:])
+		tag = tag[:i]
+	}
+
+	switch taint.Effect {
+	case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+	default:
+		return v1.Taint{}, fmt.Errorf("unsupported taint effect %q", taint.Effect)
+	}
+
+	taint.Key, taint.Value, _ = strings.Cut(tag, "=")
+	if errs := validation.IsQualifiedName(taint.Key); len(errs) > 0 {
+		return v1.Taint{}, fmt.Errorf("invalid taint key: %s", strings.Join(errs, ", "))
+	}
+	if reservedKeyRegex.MatchString(taint.Key) {
+		return v1.Taint{}, fmt.Errorf("taint key %s uses a reserved prefix", taint.Key)
+	}
+	if errs := validation.IsValidLabelValue(taint.Value); len(errs) > 0 {
+		return v1.Taint{}, fmt.Errorf("invalid taint value: %s", strings.Join(errs, ", "))
+	}
+
+	return taint, nil
+}
+
+func validateTagLabel(key, value string) error {
+	if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+		return fmt.Errorf("invalid label key: %s", strings.Join(errs, ", "))
+	}
+	if reservedKeyRegex.MatchString(key) {
+		return fmt.Errorf("label key %s uses a reserved prefix", key)
+	}
+	if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+		return fmt.Errorf("invalid label value: %s", strings.Join(errs, ", "))
+	}
+	return nil
+}
+
+// taintID identifies a taint on a node, a node can have a taint with the same key once per effect
+func taintID(taint v1.Taint) string {
+	return taint.Key + ":" + string(taint.Effect)
+}
+
+// applyNodeTags sets the labels and taints synced from tags on the node and removes the ones synced earlier
+// which are no longer tagged. Label keys and taints the node already has which were not synced from tags are
+// left alone. Returns whether the node was changed and the label keys and taint IDs left alone.
+func applyNodeTags(node *v1.Node, desiredLabels map[string]string, desiredTaints []v1.Taint) (bool, []string) {
+	original := node.DeepCopy()
+
+	if node.Labels == nil {
+		node.Labels = make(map[string]string)
+	}
+	if node.Annotations == nil {
+		node.Annotations = make(map[string]string)
+	}
+
+	var conflicts []string
+
+	ownedLabels := make(map[string]bool)
+	for _, key := range splitTagList(node.Annotations[annoNodeTagLabels]) {
+		ownedLabels[key] = true
+		if _, ok := desiredLabels[key]; !ok {
+			delete(node.Labels, key)
+		}
+	}
+
+	labelKeys := make([]string, 0, len(desiredLabels))
+	for key, value := range desiredLabels {
+		if _, exists := node.Labels[key]; exists && !ownedLabels[key] {
+			conflicts = append(conflicts, key)
+			continue
+		}
+		node.Labels[key] = value
+		labelKeys = append(labelKeys, key)
+	}
+	sort.Strings(labelKeys)
+
+	desiredTaintIDs := make(map[string]v1.Taint, len(desiredTaints))
+	for _, taint := range desiredTaints {
+		desiredTaintIDs[taintID(taint)] = taint
+	}
+
+	owned := make(map[string]bool)
+	for _, id := range splitTagList(node.Annotations[annoNodeTagTaints]) {
+		owned[id] = true
+	}
+
+	var taints []v1.Taint
+	for _, taint := range node.Spec.Taints {
+		id := taintID(taint)
+		if desired, ok := desiredTaintIDs[id]; ok {
+			if owned[id] {
+				taints = append(taints, desired)
+			} else {
+				taints = append(taints, taint)
+				conflicts = append(conflicts, id)
+			}
+			delete(desiredTaintIDs, id)
+			continue
+		}
+		if owned[id] {
+			continue
+		}
+		taints = append(taints, taint)
+	}
+
+	taintIDs := make([]string, 0, len(desiredTaints))
+	for _, taint := range desiredTaints {
+		id := taintID(taint)
+		if _, ok := desiredTaintIDs[id]; ok {
+			taints = append(taints, taint)
+			taintIDs = append(taintIDs, id)
+		} else if owned[id] {
+			taintIDs = append(taintIDs, id)
+		}
+	}
+	node.Spec.Taints = taints
+
+	setTagList(node.Annotations, annoNodeTagLabels, labelKeys)
+	setTagList(node.Annotations, annoNodeTagTaints, taintIDs)
+
+	changed := !equality.Semantic.DeepEqual(original.Labels, node.Labels) ||
+		!equality.Semantic.DeepEqual(original.Annotations, node.Annotations) ||
+		!equality.Semantic.DeepEqual(original.Spec.Taints, node.Spec.Taints)
+	return changed, conflicts
+}
+
+func splitTagList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+func setTagList(annotations map[string]string, key string, values []string) {
+	if len(values) == 0 {
+		delete(annotations, key)
+		return
+	}
+	annotations[key] = strings.Join(values, ",")
+}
@@ -0,0 +1,213 @@
+package vultr
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseNodeTags(t *testing.T) {
+	labels, taints := parseNodeTags([]string{
+		"role=ingress",
+		"pool=batch",
+		"plain",
+		"kubernetes.io/role=master",
+		"taint:dedicated=ingress:NoExecute",
+		"taint:gpu",
+		"taint:broken:Sometimes",
+		"taint:node.kubernetes.io/not-ready:NoExecute",
+		"taint:node.cloudprovider.kubernetes.io/uninitialized",
+	})
+
+	expectedLabels := map[string]string{"role": "ingress", "pool": "batch"}
+	if !reflect.DeepEqual(labels, expectedLabels) {
+		t.Errorf("expcted %+v got %+v", expectedLabels, labels)
+	}
+
+	expectedTaints := []v1.Taint{
+		{Key: "dedicated", Value: "ingress", Effect: v1.TaintEffectNoExecute},
+		{Key: "gpu", Effect: v1.TaintEffectNoSchedule},
+	}
+	if !reflect.DeepEqual(taints, expectedTaints) {
+		t.Errorf("expcted %+v got %+v", expectedTaints, taints)
+	}
+}
+
+func TestApplyNodeTags(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "ccm-test",
+			Labels: map[string]string{
+				"role":  "ingress",
+				"pool":  "web",
+				"owner": "ops",
+			},
+			Annotations: map[string]string{
+				annoNodeTagLabels: "pool,role",
+				annoNodeTagTaints: "dedicated:NoSchedule",
+			},
+		},
+		Spec: v1.NodeSpec{
+			Taints: []v1.Taint{
+				{Key: "dedicated", Value: "ingress", Effect: v1.TaintEffectNoSchedule},
+				{Key: "manual", Effect: v1.TaintEffectNoSchedule},
+			},
+		},
+	}
+
+	desiredTaints := []v1.Taint{{Key: "gpu", Effect: v1.TaintEffectNoSchedule}}
+	changed, conflicts := applyNodeTags(node, map[string]string{"pool": "batch"}, desiredTaints)
+	if !changed || conflicts != nil {
+		t.Fatalf("expected node to be changed without conflicts got %+v", conflicts)
+	}
+
+	expectedLabels := map[string]string{"pool": "batch", "owner": "ops"}
+	if !reflect.DeepEqual(node.Labels, expectedLabels) {
+		t.Errorf("expcted %+v got %+v", expectedLabels, node.Labels)
+	}
+
+	expectedTaints := []v1.Taint{
+		{Key: "manual", Effect: v1.TaintEffectNoSchedule},
+		{Key: "gpu", Effect: v1.TaintEffectNoSchedule},
+	}
+	if !reflect.DeepEqual(node.Spec.Taints, expectedTaints) {
+		t.Errorf("expcted %+v got %+v", expectedTaints, node.Spec.Taints)
+	}
+
+	expectedAnnotations := map[string]string{annoNodeTagLabels: "pool", annoNodeTagTaints: "gpu:NoSchedule"}
+	if !reflect.DeepEqual(node.Annotations, expectedAnnotations) {
+		t.Errorf("expcted %+v got %+v", expectedAnnotations, node.Annotations)
+	}
+
+	if changed, _ := applyNodeTags(node, map[string]string{"pool": "batch"}, desiredTaints); changed {
+		t.Error("expected applying the same tags again not to change the node")
+	}
+}
+
+func TestApplyNodeTags_Conflicts(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "ccm-test",
+			Labels: map[string]string{"pool": "web"},
+		},
+		Spec: v1.NodeSpec{
+			Taints: []v1.Taint{{Key: "dedicated", Value: "web", Effect: v1.TaintEffectNoSchedule}},
+		},
+	}
+
+	desiredTaints := []v1.Taint{
+		{Key: "dedicated", Value: "batch", Effect: v1.TaintEffectNoSchedule},
+		{Key: "gpu", Effect: v1.TaintEffectNoSchedule},
+	}
+	changed, conflicts := applyNodeTags(node, map[string]string{"pool": "batch", "role": "ingress"}, desiredTaints)
+	if !changed {
+		t.Fatal("expected node to be changed")
+	}
+
+	expectedConflicts := []string{"pool", "dedicated:NoSchedule"}
+	if !reflect.DeepEqual(conflicts, expectedConflicts) {
+		t.Errorf("expcted %+v got %+v", expectedConflicts, conflicts)
+	}
+
+	expectedLabels := map[string]string{"pool": "web", "role": "ingress"}
+	if !reflect.DeepEqual(node.Labels, expectedLabels) {
+		t.Errorf("expcted %+v got %+v", expectedLabels, node.Labels)
+	}
+
+	expectedTaints := []v1.Taint{
+		{Key: "dedicated", Value: "web", Effect: v1.TaintEffectNoSchedule},
+		{Key: "gpu", Effect: v1.TaintEffectNoSchedule},
+	}
+	if !reflect.DeepEqual(node.Spec.Taints, expectedTaints) {
+		t.Errorf("expcted %+v got %+v", expectedTaints, node.Spec.Taints)
+	}
+
+	// keys which were not synced from tags are not recorded, so they are kept once the tags are removed
+	expectedAnnotations := map[string]string{annoNodeTagLabels: "role", annoNodeTagTaints: "gpu:NoSchedule"}
+	if !reflect.DeepEqual(node.Annotations, expectedAnnotations) {
+		t.Errorf("expcted %+v got %+v", expectedAnnotations, node.Annotations)
+	}
+
+	applyNodeTags(node, nil, nil)
+	if node.Labels["pool"] != "web" || len(node.Spec.Taints) != 1 || node.Spec.Taints[0].Value != "web" {
+		t.Errorf("expected the labels and taints not synced from tags to be kept got %+v %+v", node.Labels, node.Spec.Taints)
+	}
+}
+
+func TestNodeTagController_SyncNode(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+	}
+
+	kubeClient := fake.NewClientset(node)
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+
+	client := newFakeClient()
+	instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil).(*instancesv2)
+
+	controller, err := newNodeTagController(kubeClient, informerFactory, instances)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	informerFactory.Start(context.TODO().Done())
+	informerFactory.WaitForCacheSync(context.TODO().Done())
+
+	// nodes are queued by the informer and synced by the workers
+	if controller.queue.Len() != 1 {
+		t.Fatalf("expcted %+v queued nodes got %+v", 1, controller.queue.Len())
+	}
+	processNextKey(context.TODO(), controller.queue, controller.syncKey)
+
+	for _, action := range kubeClient.Actions() {
+		if action.GetVerb() == "update" {
+			t.Errorf("expected the node to be patched got %+v", action)
+		}
+	}
+
+	actual, err := kubeClient.CoreV1().Nodes().Get(context.TODO(), "ccm-test", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if actual.Labels["pool"] != "batch" {
+		t.Errorf("expected label pool=batch got %+v", actual.Labels)
+	}
+
+	expectedTaints := []v1.Taint{{Key: "dedicated", Value: "batch", Effect: v1.TaintEffectNoSchedule}}
+	if !reflect.DeepEqual(actual.Spec.Taints, expectedTaints) {
+		t.Errorf("expcted %+v got %+v", expectedTaints, actual.Spec.Taints)
+	}
+}
+
+func TestNodeTagPatch(t *testing.T) {
+	original := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "ccm-test", ResourceVersion: "42", Labels: map[string]string{"owner": "ops"}}}
+
+	labeled := original.DeepCopy()
+	applyNodeTags(labeled, map[string]string{"pool": "batch"}, nil)
+	patch, err := nodeTagPatch(original, labeled)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected := `{"metadata":{"annotations":{"vultr.com/tag-labels":"pool"},"labels":{"pool":"batch"}}}`
+	if string(patch) != expected {
+		t.Errorf("expcted %+v got %+v", expected, string(patch))
+	}
+
+	tainted := original.DeepCopy()
+	applyNodeTags(tainted, nil, []v1.Taint{{Key: "gpu", Effect: v1.TaintEffectNoSchedule}})
+	patch, err = nodeTagPatch(original, tainted)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	expected = `{"metadata":{"annotations":{"vultr.com/tag-taints":"gpu:NoSchedule"},"resourceVersion":"42"},"spec":{"taints":[{"effect":"NoSchedule","key":"gpu"}]}}`
+	if string(patch) != expected {
+		t.Errorf("expcted %+v got %+v", expected, string(patch))
+	}
+}
@@ -0,0 +1,104 @@
+package vultr
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/klog/v2"
+)
+
+const (
+	planLabelFamily    = "vultr.com/plan-family"
+	planLabelVCPUs     = "vultr.com/vcpus"
+	planLabelMemoryMB  = "vultr.com/memory-mb"
+	planLabelDiskType  = "vultr.com/disk-type"
+	planLabelGPUModel  = "vultr.com/gpu-model"
+	planLabelGPUVRAMGB = "vultr.com/gpu-vram-gb"
+)
+
+// instancePlanDiskTypes maps the instance plan types with a known kind of storage to that storage
+var instancePlanDiskTypes = map[string]string{
+	"vc2": "ssd",
+	"vhf": "nvme",
+	"vhp": "nvme",
+	"voc": "nvme",
+}
+
+// invalidLabelValueChars matches the characters which are not allowed in a label value
+var invalidLabelValueChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// planLabels returns the node labels describing the plan of a server. The labels are best-effort, plans missing
+// from the catalog or a catalog which can't be fetched have no labels rather than failing the node metadata.
+func (i *instancesv2) planLabels(ctx context.Context, kind serverKind, planID string) map[string]string {
+	labels := make(map[string]string)
+
+	if kind == serverKindBareMetal {
+		plan, err := i.inventory.bareMetalPlan(ctx, planID)
+		if err != nil {
+			klog.Errorf("failed to get baremetal plan %s, no plan labels are added: %v", planID, err)
+			return labels
+		}
+		if plan == nil {
+			klog.Warningf("baremetal plan %s is not in the plans catalog, no plan labels are added", planID)
+			return labels
+		}
+
+		vcpus := plan.CPUThreads
+		if vcpus == 0 {
+			vcpus = plan.CPUCount
+		}
+
+		setLabel(labels, planLabelFamily, planFamily(plan.ID))
+		setIntLabel(labels, planLabelVCPUs, vcpus)
+		setIntLabel(labels, planLabelMemoryMB, plan.RAM)
+		setLabel(labels, planLabelDiskType, strings.ToLower(plan.Type))
+		return labels
+	}
+
+	plan, err := i.inventory.plan(ctx, planID)
+	if err != nil {
+		klog.Errorf("failed to get plan %s, no plan labels are added: %v", planID, err)
+		return labels
+	}
+	if plan == nil {
+		klog.Warningf("plan %s is not in the plans catalog, no plan labels are added", planID)
+		return labels
+	}
+
+	setLabel(labels, planLabelFamily, planFamily(plan.ID))
+	setIntLabel(labels, planLabelVCPUs, plan.VCPUCount)
+	setIntLabel(labels, planLabelMemoryMB, plan.RAM)
+	setLabel(labels, planLabelDiskType, instancePlanDiskTypes[plan.Type])
+	if plan.GPUType != "" {
+		setLabel(labels, planLabelGPUModel, plan.GPUType)
+		setIntLabel(labels, planLabelGPUVRAMGB, plan.GPUVRAM)
+	}
+
+	return labels
+}
+
+// planFamily returns the family of a plan, the prefix of its ID such as vc2 for vc2-4c-8gb
+func planFamily(planID string) string {
+	family, _, _ := strings.Cut(planID, "-")
+	return family
+}
+
+// setIntLabel adds a label for a positive number, zero means the catalog did not include it
+func setIntLabel(labels map[string]string, key string, value int) {
+	if value > 0 {
+		setLabel(labels, key, strconv.Itoa(value))
+	}
+}
+
+// setLabel adds a label if the value is not empty, characters which are not allowed in label values are replaced
+func setLabel(labels map[string]string, key, value string) {
+	value = strings.Trim(invalidLabelValueChars.ReplaceAllString(value, "-"), "-_.")
+	if value == "" || len(validation.IsValidLabelValue(value)) > 0 {
+		return
+	}
+
+	labels[key] = value
+}
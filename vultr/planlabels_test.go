@@ -0,0 +1,137 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestInstancesV2_InstanceMetadata_PlanLabels(t *testing.T) {
+	tests := []struct {
+		name     string
+		node     *v1.Node
+		expected map[string]string
+	}{
+		{
+			name: "instance",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"},
+				Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+			},
+			expected: map[string]string{
+				bareMetalLabel:    "false",
+				hostGroupLabel:    "0c51cc3d-529e-4e03-ad86-fd0af47467ba",
+				planLabelFamily:   "vc2",
+				planLabelVCPUs:    "4",
+				planLabelMemoryMB: "8192",
+				planLabelDiskType: "ssd",
+			},
+		},
+		{
+			name: "bare metal",
+			node: &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ccm-test-bm",
+					Labels: map[string]string{bareMetalLabel: "true"},
+				},
+				Spec: v1.NodeSpec{ProviderID: "vultr://cb676a46-66fd-4dfb-b839-443f2e6c0b60"},
+			},
+			expected: map[string]string{
+				bareMetalLabel:    "true",
+				hostGroupLabel:    "cb676a46-66fd-4dfb-b839-443f2e6c0b60",
+				planLabelFamily:   "vbm",
+				planLabelVCPUs:    "48",
+				planLabelMemoryMB: "261120",
+				planLabelDiskType: "nvme",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := newFakeClient()
+			instances := newInstancesV2(client, newInventory(client, CacheConfig{Plans: defaultPlanCacheTTL}), NodeAddressConfig{}, NodeMatchingConfig{}, nil)
+
+			actual, err := instances.InstanceMetadata(context.TODO(), test.node)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(actual.AdditionalLabels, test.expected) {
+				t.Errorf("expcted %+v got %+v", test.expected, actual.AdditionalLabels)
+			}
+		})
+	}
+}
+
+func TestInstancesV2_PlanLabels_GPU(t *testing.T) {
+	client := newFakeClient()
+	instances := &instancesv2{client: client, inventory: newInventory(client, CacheConfig{}), kinds: newServerKindCache()}
+
+	labels := instances.planLabels(context.TODO(), serverKindInstance, "vcg-a100-1c-6g-4vram")
+
+	expected := map[string]string{
+		planLabelFamily:    "vcg",
+		planLabelVCPUs:     "1",
+		planLabelMemoryMB:  "6144",
+		planLabelGPUModel:  "NVIDIA_A100",
+		planLabelGPUVRAMGB: "4",
+	}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expcted %+v got %+v", expected, labels)
+	}
+
+	labels = instances.planLabels(context.TODO(), serverKindInstance, "vc2-unknown")
+	if len(labels) != 0 {
+		t.Errorf("expected no labels for a plan missing from the catalog got %+v", labels)
+	}
+}
+
+// fakeFailingPlan is a plans catalog which can not be fetched
+type fakeFailingPlan struct {
+	fakePlan
+}
+
+// List returns a server error
+func (f *fakeFailingPlan) List(_ context.Context, _ string, _ *govultr.ListOptions) ([]govultr.Plan, *govultr.Meta, *http.Response, error) {
+	return nil, nil, nil, errors.New(`{"error":"internal error","status":500}`)
+}
+
+func TestInstancesV2_InstanceMetadata_PlanCatalogUnavailable(t *testing.T) {
+	client := newFakeClient()
+	client.Plan = &fakeFailingPlan{}
+	instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil).(*instancesv2)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+	}
+	actual, err := instances.InstanceMetadata(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := actual.AdditionalLabels[planLabelFamily]; ok {
+		t.Errorf("expcted no plan labels got %+v", actual.AdditionalLabels)
+	}
+	if len(actual.NodeAddresses) == 0 {
+		t.Error("expcted node addresses")
+	}
+}
+
+func TestSetLabel(t *testing.T) {
+	labels := make(map[string]string)
+
+	setLabel(labels, planLabelGPUModel, "NVIDIA A100 (80GB)")
+	setLabel(labels, planLabelDiskType, "")
+
+	expected := map[string]string{planLabelGPUModel: "NVIDIA-A100-80GB"}
+	if !reflect.DeepEqual(labels, expected) {
+		t.Errorf("expcted %+v got %+v", expected, labels)
+	}
+}
@@ -0,0 +1,85 @@
+package vultr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+const (
+	SUSPENDED = "suspended" //nolint
+
+	powerStatusRunning = "running"
+	powerStatusStopped = "stopped"
+
+	serverStatusLocked            = "locked"
+	serverStatusInstallingBooting = "installingbooting"
+	serverStatusReinstalling      = "reinstalling"
+)
+
+// powerState is whether a server is running, as used for node shutdown detection
+type powerState int
+
+const (
+	powerStateUnknown powerState = iota
+	powerStateRunning
+	powerStateStopped
+	// powerStateTransitioning is a server being created, resized or reinstalled which is expected to come back
+	powerStateTransitioning
+)
+
+func (s powerState) String() string {
+	switch s {
+	case powerStateRunning:
+		return "running"
+	case powerStateStopped:
+		return "stopped"
+	case powerStateTransitioning:
+		return "transitioning"
+	default:
+		return "unknown"
+	}
+}
+
+// serverPowerState returns the power state of a bare metal server from its status fields.
+// Transitions are checked first since servers are powered off while they are resized or reinstalled.
+func serverPowerState(status, powerStatus, serverStatus string) powerState {
+	switch {
+	case status == PENDING || status == RESIZING:
+		return powerStateTransitioning
+	case serverStatus == serverStatusLocked || serverStatus == serverStatusInstallingBooting || serverStatus == serverStatusReinstalling:
+		return powerStateTransitioning
+	case status == SUSPENDED || powerStatus == powerStatusStopped:
+		return powerStateStopped
+	case powerStatus == powerStatusRunning:
+		return powerStateRunning
+	}
+
+	return powerStateUnknown
+}
+
+// bareMetalPowerInfo holds the status of a bare metal server with the power fields which govultr does not decode
+type bareMetalPowerInfo struct {
+	Status       string `json:"status"`
+	PowerStatus  string `json:"power_status"`
+	ServerStatus string `json:"server_status"`
+}
+
+// getBareMetalPowerInfo reads the status and power fields of a bare metal server from the API in one request,
+// the power fields are empty if the API did not report them
+func (i *instancesv2) getBareMetalPowerInfo(ctx context.Context, id string) (*bareMetalPowerInfo, error) {
+	req, err := i.client.NewRequest(ctx, http.MethodGet, fmt.Sprintf("/v2/bare-metals/%s", id), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	body := struct {
+		BareMetal bareMetalPowerInfo `json:"bare_metal"`
+	}{}
+	resp, err := i.client.DoWithContext(ctx, req, &body) //nolint:bodyclose
+	if err != nil {
+		return nil, newAPIError(resp, err)
+	}
+
+	return &body.BareMetal, nil
+}
@@ -0,0 +1,144 @@
+package vultr
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestServerPowerState(t *testing.T) {
+	tests := []struct {
+		status       string
+		powerStatus  string
+		serverStatus string
+		expected     powerState
+	}{
+		{status: ACTIVE, powerStatus: powerStatusRunning, serverStatus: "ok", expected: powerStateRunning},
+		{status: ACTIVE, powerStatus: powerStatusStopped, serverStatus: "ok", expected: powerStateStopped},
+		{status: SUSPENDED, powerStatus: powerStatusRunning, expected: powerStateStopped},
+		{status: RESIZING, powerStatus: powerStatusStopped, expected: powerStateTransitioning},
+		{status: PENDING, expected: powerStateTransitioning},
+		{status: ACTIVE, powerStatus: powerStatusStopped, serverStatus: serverStatusInstallingBooting, expected: powerStateTransitioning},
+		{status: ACTIVE, powerStatus: powerStatusRunning, serverStatus: serverStatusLocked, expected: powerStateTransitioning},
+		{status: ACTIVE, expected: powerStateUnknown},
+	}
+
+	for _, test := range tests {
+		actual := serverPowerState(test.status, test.powerStatus, test.serverStatus)
+		if actual != test.expected {
+			t.Errorf("%s/%s/%s: expcted %s got %s", test.status, test.powerStatus, test.serverStatus, test.expected, actual)
+		}
+	}
+}
+
+func TestInstancesV2_InstanceShutdown_BareMetal(t *testing.T) {
+	tests := map[string]struct {
+		powerStatus  string
+		serverStatus string
+		expected     bool
+	}{
+		"running":      {powerStatus: powerStatusRunning, serverStatus: "ok", expected: false},
+		"stopped":      {powerStatus: powerStatusStopped, serverStatus: "ok", expected: true},
+		"reinstalling": {powerStatus: powerStatusStopped, serverStatus: serverStatusReinstalling, expected: false},
+		"unreported":   {expected: false},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.URL.Path != "/v2/bare-metals/cb676a46-66fd-4dfb-b839-443f2e6c0b60" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				fmt.Fprintf(w, `{"bare_metal":{"id":"cb676a46-66fd-4dfb-b839-443f2e6c0b60","status":"active","power_status":%q,"server_status":%q}}`,
+					test.powerStatus, test.serverStatus)
+			}))
+			defer server.Close()
+
+			client := govultr.NewClient(server.Client())
+			if err := client.SetBaseURL(server.URL); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil)
+
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ccm-test-bm",
+					Labels: map[string]string{bareMetalLabel: "true"},
+				},
+				Spec: v1.NodeSpec{ProviderID: "vultr://cb676a46-66fd-4dfb-b839-443f2e6c0b60"},
+			}
+
+			actual, err := instances.InstanceShutdown(context.TODO(), node)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("expcted %t got %t", test.expected, actual)
+			}
+			if requests != 1 {
+				t.Errorf("expected the bare metal server to be fetched once got %d requests", requests)
+			}
+		})
+	}
+}
+
+// fakePowerInstance returns an instance with the given status fields
+type fakePowerInstance struct {
+	FakeInstance
+	status       string
+	powerStatus  string
+	serverStatus string
+}
+
+func (f *fakePowerInstance) Get(ctx context.Context, id string) (*govultr.Instance, *http.Response, error) {
+	instance, resp, err := f.FakeInstance.Get(ctx, id)
+	instance.Status, instance.PowerStatus, instance.ServerStatus = f.status, f.powerStatus, f.serverStatus
+	return instance, resp, err
+}
+
+func TestInstancesV2_InstanceShutdown_Instance(t *testing.T) {
+	tests := map[string]struct {
+		instance *fakePowerInstance
+		expected bool
+	}{
+		"running":  {instance: &fakePowerInstance{status: ACTIVE, powerStatus: powerStatusRunning, serverStatus: "ok"}, expected: false},
+		"stopped":  {instance: &fakePowerInstance{status: ACTIVE, powerStatus: powerStatusStopped, serverStatus: "ok"}, expected: true},
+		"resizing": {instance: &fakePowerInstance{status: RESIZING, powerStatus: powerStatusStopped}, expected: true},
+		"unknown":  {instance: &fakePowerInstance{status: ACTIVE}, expected: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := newFakeClient()
+			client.Instance = test.instance
+
+			instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, nil)
+
+			node := &v1.Node{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ccm-test",
+					Labels: map[string]string{bareMetalLabel: "false"},
+				},
+				Spec: v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+			}
+
+			actual, err := instances.InstanceShutdown(context.TODO(), node)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if actual != test.expected {
+				t.Errorf("expcted %t got %t", test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package vultr
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/informers"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+const (
+	reverseDNSPlaceholderNode    = "node"
+	reverseDNSPlaceholderCluster = "cluster"
+
+	reverseDNSSyncPeriod = 10 * time.Minute
+	reverseDNSWorkers    = 2
+)
+
+// reverseDNSPlaceholderRegex matches the {{<name>}} placeholders of a reverse DNS template
+var reverseDNSPlaceholderRegex = regexp.MustCompile(`\{\{\s*([^{}\s]*)\s*\}\}`)
+
+// reverseDNSTemplate renders the PTR record of a node, such as {{node}}.{{cluster}}.example.com
+type reverseDNSTemplate struct {
+	template string
+	cluster  string
+}
+
+// validateReverseDNSTemplate makes sure the template only uses known placeholders
+func validateReverseDNSTemplate(template string) error {
+	for _, match := range reverseDNSPlaceholderRegex.FindAllStringSubmatch(template, -1) {
+		switch match[1] {
+		case reverseDNSPlaceholderNode, reverseDNSPlaceholderCluster:
+		default:
+			return fmt.Errorf("unknown placeholder %s, supported placeholders are [{{%s}} {{%s}}]", match[0],
+				reverseDNSPlaceholderNode, reverseDNSPlaceholderCluster)
+		}
+	}
+	if !usesReverseDNSPlaceholder(template, reverseDNSPlaceholderNode) {
+		return fmt.Errorf("must contain {{%s}} so every node gets its own name", reverseDNSPlaceholderNode)
+	}
+	return nil
+}
+
+func usesReverseDNSPlaceholder(template, placeholder string) bool {
+	for _, match := range reverseDNSPlaceholderRegex.FindAllStringSubmatch(template, -1) {
+		if match[1] == placeholder {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the PTR record of the node, it has to be a valid DNS name
+func (t *reverseDNSTemplate) render(nodeName string) (string, error) {
+	name := reverseDNSPlaceholderRegex.ReplaceAllStringFunc(t.template, func(placeholder string) string {
+		switch reverseDNSPlaceholderRegex.FindStringSubmatch(placeholder)[1] {
+		case reverseDNSPlaceholderNode:
+			return nodeName
+		case reverseDNSPlaceholderCluster:
+			return t.cluster
+		}
+		return placeholder
+	})
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return "", fmt.Errorf("reverse DNS name %q of node %s is invalid: %s", name, nodeName, strings.Join(errs, ", "))
+	}
+	return name, nil
+}
+
+// reverseDNSNames are the names the PTR records of the public IPs of nodes are set to, only those are
+// reported as ExternalDNS addresses
+type reverseDNSNames struct {
+	mu    sync.Mutex
+	names map[string]string
+}
+
+func (n *reverseDNSNames) set(nodeName, name string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.names == nil {
+		n.names = make(map[string]string)
+	}
+	n.names[nodeName] = name
+}
+
+func (n *reverseDNSNames) get(nodeName string) string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return n.names[nodeName]
+}
+
+func (n *reverseDNSNames) forget(nodeName string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	delete(n.names, nodeName)
+}
+
+// reverseDNSController sets the PTR records of the public IPs of instances backing nodes to the name rendered
+// from the template, and resets them once the node is removed. Bare metal servers are skipped since the API
+// does not manage their reverse DNS.
+type reverseDNSController struct {
+	nodeLister corelisters.NodeLister
+	instances  *instancesv2
+	template   *reverseDNSTemplate
+	queue      workqueue.TypedRateLimitingInterface[string]
+
+	// deleted are the removed nodes whose records are not reset yet
+	mu      sync.Mutex
+	deleted map[string]*v1.Node
+}
+
+// newReverseDNSController registers the controller with the node informer, nodes are queued when they are
+// added, get their providerID or are deleted
+func newReverseDNSController(informerFactory informers.SharedInformerFactory, instances *instancesv2, template *reverseDNSTemplate) (*reverseDNSController, error) {
+	c := &reverseDNSController{
+		nodeLister: informerFactory.Core().V1().Nodes().Lister(),
+		instances:  instances,
+		template:   template,
+		queue:      newKeyQueue("reverse-dns"),
+		deleted:    make(map[string]*v1.Node),
+	}
+
+	_, err := informerFactory.Core().V1().Nodes().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if node, ok := obj.(*v1.Node); ok {
+				c.queue.Add(node.Name)
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldNode, ok := oldObj.(*v1.Node)
+			if !ok {
+				return
+			}
+			if node, ok := newObj.(*v1.Node); ok && oldNode.Spec.ProviderID != node.Spec.ProviderID {
+				c.queue.Add(node.Name)
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			node, ok := obj.(*v1.Node)
+			if !ok {
+				return
+			}
+			c.mu.Lock()
+			c.deleted[node.Name] = node
+			c.mu.Unlock()
+			c.queue.Add(node.Name)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Run syncs the queued nodes until the context is done. Every node is queued periodically so records changed
+// outside the CCM are restored.
+func (c *reverseDNSController) Run(ctx context.Context) {
+	go runKeyWorkers(ctx, c.queue, reverseDNSWorkers, c.syncKey)
+
+	ticker := time.NewTicker(reverseDNSSyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.enqueueAll()
+		}
+	}
+}
+
+func (c *reverseDNSController) enqueueAll() {
+	nodes, err := c.nodeLister.List(labels.Everything())
+	if err != nil {
+		klog.Errorf("failed to list nodes for reverse DNS sync: %v", err)
+		return
+	}
+
+	for _, node := range nodes {
+		c.queue.Add(node.Name)
+	}
+}
+
+// syncKey resets the records of the node with the given name if it was deleted and syncs the records of the
+// node which has the name now. Failures are retried, so the records of deleted nodes don't leak.
+func (c *reverseDNSController) syncKey(ctx context.Context, name string) error {
+	c.mu.Lock()
+	deleted := c.deleted[name]
+	c.mu.Unlock()
+
+	if deleted != nil {
+		if err := c.cleanupNode(ctx, deleted); err != nil {
+			return fmt.Errorf("failed to clean up reverse DNS of node %s: %w", name, err)
+		}
+		c.mu.Lock()
+		if c.deleted[name] == deleted {
+			delete(c.deleted, name)
+		}
+		c.mu.Unlock()
+	}
+
+	node, err := c.nodeLister.Get(name)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := c.syncNode(ctx, node); err != nil {
+		return fmt.Errorf("failed to sync reverse DNS of node %s: %w", name, err)
+	}
+	return nil
+}
+
+// syncNode sets the PTR records of the public IPs of the instance backing the node, the name is only reported
+// as the ExternalDNS address of the node while every record is set
+func (c *reverseDNSController) syncNode(ctx context.Context, node *v1.Node) error {
+	instance, err := c.instanceOf(ctx, node)
+	if instance == nil || err != nil {
+		if err == nil {
+			c.instances.dnsNames.forget(node.Name)
+		}
+		return err
+	}
+
+	name, err := c.template.render(node.Name)
+	if err != nil {
+		c.instances.dnsNames.forget(node.Name)
+		return err
+	}
+
+	records, err := c.reverseRecords(ctx, instance)
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range []string{instance.MainIP, instance.V6MainIP} {
+		if ip == "" || sameDNSName(records[normalizeIP(ip)], name) {
+			continue
+		}
+
+		reverse := &govultr.ReverseIP{IP: ip, Reverse: name}
+		if isIPv6(ip) {
+			err = c.instances.client.Instance.CreateReverseIPv6(ctx, instance.ID, reverse)
+		} else {
+			err = c.instances.client.Instance.CreateReverseIPv4(ctx, instance.ID, reverse)
+		}
+		if err != nil {
+			c.instances.dnsNames.forget(node.Name)
+			return fmt.Errorf("failed to set reverse DNS of %s to %s: %w", ip, name, newAPIError(nil, err))
+		}
+		klog.Infof("set reverse DNS of %s (node %s) to %s", ip, node.Name, name)
+	}
+
+	if instance.MainIP == "" && instance.V6MainIP == "" {
+		c.instances.dnsNames.forget(node.Name)
+		return nil
+	}
+	c.instances.dnsNames.set(node.Name, name)
+	return nil
+}
+
+// cleanupNode resets the PTR records of the deleted node which still hold its name, records changed since are left alone
+func (c *reverseDNSController) cleanupNode(ctx context.Context, node *v1.Node) error {
+	c.instances.dnsNames.forget(node.Name)
+	if node.Spec.ProviderID == "" {
+		return nil
+	}
+
+	instance, err := c.instanceOf(ctx, node)
+	if instance == nil || err != nil {
+		return err
+	}
+
+	name, err := c.template.render(node.Name)
+	if err != nil {
+		return err
+	}
+
+	records, err := c.reverseRecords(ctx, instance)
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range []string{instance.MainIP, instance.V6MainIP} {
+		if ip == "" || !sameDNSName(records[normalizeIP(ip)], name) {
+			continue
+		}
+
+		if isIPv6(ip) {
+			err = c.instances.client.Instance.DeleteReverseIPv6(ctx, instance.ID, ip)
+		} else {
+			err = c.instances.client.Instance.DefaultReverseIPv4(ctx, instance.ID, ip)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to reset reverse DNS of %s: %w", ip, newAPIError(nil, err))
+		}
+		klog.Infof("reset reverse DNS of %s (node %s)", ip, node.Name)
+	}
+
+	return nil
+}
+
+// instanceOf returns the instance backing the node, nil if there is none or the node is backed by bare metal
+func (c *reverseDNSController) instanceOf(ctx context.Context, node *v1.Node) (*govultr.Instance, error) {
+	server, err := c.instances.getVultrServer(ctx, node)
+	if err != nil {
+		if isServerNotFound(err) {
+			klog.V(logLevelDebug).Infof("skipping reverse DNS of node %s, no server found", node.Name)
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if server.bareMetal != nil {
+		klog.V(logLevelDebug).Infof("skipping reverse DNS of node %s, bare metal reverse DNS is not supported", node.Name)
+		return nil, nil
+	}
+
+	return server.instance, nil
+}
+
+// reverseRecords returns the PTR records of the public IPs of the instance by normalized IP
+func (c *reverseDNSController) reverseRecords(ctx context.Context, instance *govultr.Instance) (map[string]string, error) {
+	records := make(map[string]string)
+
+	if instance.MainIP != "" {
+		ipv4s, err := listAll(ctx, func(ctx context.Context, opts *govultr.ListOptions) ([]govultr.IPv4, *govultr.Meta, error) {
+			ips, meta, resp, err := c.instances.client.Instance.ListIPv4(ctx, instance.ID, opts) //nolint:bodyclose
+			return ips, meta, newAPIError(resp, err)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list IPv4 addresses of instance %s: %w", instance.ID, err)
+		}
+		for _, ip := range ipv4s {
+			records[normalizeIP(ip.IP)] = ip.Reverse
+		}
+	}
+
+	if instance.V6MainIP != "" {
+		ipv6s, resp, err := c.instances.client.Instance.ListReverseIPv6(ctx, instance.ID) //nolint:bodyclose
+		if err != nil {
+			return nil, fmt.Errorf("failed to list IPv6 reverse DNS of instance %s: %w", instance.ID, newAPIError(resp, err))
+		}
+		for _, ip := range ipv6s {
+			records[normalizeIP(ip.IP)] = ip.Reverse
+		}
+	}
+
+	return records, nil
+}
+
+// reverseDNSAddresses returns the NodeExternalDNS address of a node once the PTR records of its public IPs are set
+func (i *instancesv2) reverseDNSAddresses(node *v1.Node) []v1.NodeAddress {
+	if i.dnsTemplate == nil {
+		return nil
+	}
+
+	name := i.dnsNames.get(node.Name)
+	if name == "" {
+		return nil
+	}
+
+	return []v1.NodeAddress{{Type: v1.NodeExternalDNS, Address: name}}
+}
+
+func sameDNSName(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "."), strings.TrimSuffix(b, "."))
+}
+
+func isIPv6(address string) bool {
+	ip := net.ParseIP(address)
+	return ip != nil && ip.To4() == nil
+}
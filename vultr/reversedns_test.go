@@ -0,0 +1,238 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// fakeReverseDNSInstance keeps the reverse DNS records of a dual stack instance
+type fakeReverseDNSInstance struct {
+	FakeInstance
+	records map[string]string
+}
+
+func (f *fakeReverseDNSInstance) instance() govultr.Instance {
+	return govultr.Instance{
+		ID:       "75b95d83-47e2-4c0f-b273-cc9ce2b456f8",
+		Label:    "ccm-test",
+		MainIP:   "149.28.225.110",
+		V6MainIP: "2001:19f0:5:6d8b:5400:3ff:fe9b:1a2c",
+		Region:   "ewr",
+		Plan:     "vc2-4c-8gb",
+		Status:   ACTIVE,
+	}
+}
+
+func (f *fakeReverseDNSInstance) Get(_ context.Context, _ string) (*govultr.Instance, *http.Response, error) {
+	instance := f.instance()
+	return &instance, nil, nil
+}
+
+func (f *fakeReverseDNSInstance) List(_ context.Context, _ *govultr.ListOptions) ([]govultr.Instance, *govultr.Meta, *http.Response, error) {
+	return []govultr.Instance{f.instance()}, &govultr.Meta{Links: &govultr.Links{}}, nil, nil
+}
+
+func (f *fakeReverseDNSInstance) ListIPv4(_ context.Context, _ string, _ *govultr.ListOptions) ([]govultr.IPv4, *govultr.Meta, *http.Response, error) {
+	ip := f.instance().MainIP
+	return []govultr.IPv4{{IP: ip, Type: "main_ip", Reverse: f.records[ip]}}, &govultr.Meta{Links: &govultr.Links{}}, nil, nil
+}
+
+func (f *fakeReverseDNSInstance) ListReverseIPv6(_ context.Context, _ string) ([]govultr.ReverseIP, *http.Response, error) {
+	ip := f.instance().V6MainIP
+	if f.records[ip] == "" {
+		return nil, nil, nil
+	}
+	return []govultr.ReverseIP{{IP: ip, Reverse: f.records[ip]}}, nil, nil
+}
+
+func (f *fakeReverseDNSInstance) CreateReverseIPv4(_ context.Context, _ string, req *govultr.ReverseIP) error {
+	f.records[req.IP] = req.Reverse
+	return nil
+}
+
+func (f *fakeReverseDNSInstance) CreateReverseIPv6(_ context.Context, _ string, req *govultr.ReverseIP) error {
+	f.records[req.IP] = req.Reverse
+	return nil
+}
+
+func (f *fakeReverseDNSInstance) DefaultReverseIPv4(_ context.Context, _, ip string) error {
+	f.records[ip] = "149.28.225.110.vultrusercontent.com"
+	return nil
+}
+
+func (f *fakeReverseDNSInstance) DeleteReverseIPv6(_ context.Context, _, ip string) error {
+	delete(f.records, ip)
+	return nil
+}
+
+func TestReverseDNSTemplate(t *testing.T) {
+	tests := []struct {
+		template string
+		node     string
+		expected string
+		invalid  bool
+	}{
+		{template: "{{node}}.{{cluster}}.example.com", node: "worker-1", expected: "worker-1.prod.example.com"},
+		{template: "{{ node }}.example.com.", node: "Worker-1", expected: "worker-1.example.com"},
+		{template: "{{node}}.{{region}}.example.com", invalid: true},
+		{template: "{{cluster}}.example.com", invalid: true},
+	}
+
+	for _, test := range tests {
+		if err := validateReverseDNSTemplate(test.template); (err != nil) != test.invalid {
+			t.Errorf("%s: unexpected validation result %v", test.template, err)
+			continue
+		}
+		if test.invalid {
+			continue
+		}
+
+		actual, err := (&reverseDNSTemplate{template: test.template, cluster: "prod"}).render(test.node)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if actual != test.expected {
+			t.Errorf("expcted %s got %s", test.expected, actual)
+		}
+	}
+}
+
+func TestReverseDNSController_SyncAndCleanup(t *testing.T) {
+	fakeInstance := &fakeReverseDNSInstance{records: map[string]string{
+		"149.28.225.110": "149.28.225.110.vultrusercontent.com",
+	}}
+	client := newFakeClient()
+	client.Instance = fakeInstance
+
+	template := &reverseDNSTemplate{template: "{{node}}.{{cluster}}.example.com", cluster: "prod"}
+	instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, template).(*instancesv2)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+	}
+
+	informerFactory := informers.NewSharedInformerFactory(fake.NewClientset(node), 0)
+	controller, err := newReverseDNSController(informerFactory, instances, template)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the name is not reported before the records are set
+	metadata, err := instances.InstanceMetadata(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, address := range metadata.NodeAddresses {
+		if address.Type == v1.NodeExternalDNS {
+			t.Errorf("expected no ExternalDNS address got %+v", address)
+		}
+	}
+
+	if err := controller.syncNode(context.TODO(), node); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, ip := range []string{"149.28.225.110", "2001:19f0:5:6d8b:5400:3ff:fe9b:1a2c"} {
+		if fakeInstance.records[ip] != "ccm-test.prod.example.com" {
+			t.Errorf("expcted reverse DNS of %s to be ccm-test.prod.example.com got %q", ip, fakeInstance.records[ip])
+		}
+	}
+
+	metadata, err = instances.InstanceMetadata(context.TODO(), node)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	last := metadata.NodeAddresses[len(metadata.NodeAddresses)-1]
+	if last.Type != v1.NodeExternalDNS || last.Address != "ccm-test.prod.example.com" {
+		t.Errorf("expected ExternalDNS ccm-test.prod.example.com got %+v", metadata.NodeAddresses)
+	}
+
+	if err := controller.cleanupNode(context.TODO(), node); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if fakeInstance.records["149.28.225.110"] != "149.28.225.110.vultrusercontent.com" {
+		t.Errorf("expected IPv4 reverse DNS to be reset got %q", fakeInstance.records["149.28.225.110"])
+	}
+	if _, ok := fakeInstance.records["2001:19f0:5:6d8b:5400:3ff:fe9b:1a2c"]; ok {
+		t.Error("expected IPv6 reverse DNS to be deleted")
+	}
+}
+
+// fakeFailingResetInstance fails to reset the IPv4 reverse DNS until fail is cleared
+type fakeFailingResetInstance struct {
+	*fakeReverseDNSInstance
+	fail bool
+}
+
+func (f *fakeFailingResetInstance) DefaultReverseIPv4(ctx context.Context, id, ip string) error {
+	if f.fail {
+		return errors.New(`{"error":"internal error","status":500}`)
+	}
+	return f.fakeReverseDNSInstance.DefaultReverseIPv4(ctx, id, ip)
+}
+
+func TestReverseDNSController_CleanupRetried(t *testing.T) {
+	fakeInstance := &fakeFailingResetInstance{
+		fakeReverseDNSInstance: &fakeReverseDNSInstance{records: map[string]string{
+			"149.28.225.110": "ccm-test.prod.example.com",
+		}},
+		fail: true,
+	}
+	client := newFakeClient()
+	client.Instance = fakeInstance
+
+	template := &reverseDNSTemplate{template: "{{node}}.{{cluster}}.example.com", cluster: "prod"}
+	instances := newInstancesV2(client, newInventory(client, CacheConfig{}), NodeAddressConfig{}, NodeMatchingConfig{}, template).(*instancesv2)
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "ccm-test"},
+		Spec:       v1.NodeSpec{ProviderID: "vultr://75b95d83-47e2-4c0f-b273-cc9ce2b456f8"},
+	}
+	kubeClient := fake.NewClientset(node)
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+	controller, err := newReverseDNSController(informerFactory, instances, template)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.TODO())
+	defer cancel()
+	informerFactory.Start(ctx.Done())
+	informerFactory.WaitForCacheSync(ctx.Done())
+	processNextKey(ctx, controller.queue, controller.syncKey)
+
+	if err := kubeClient.CoreV1().Nodes().Delete(ctx, node.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := wait.PollUntilContextTimeout(ctx, 10*time.Millisecond, 5*time.Second, true, func(context.Context) (bool, error) {
+		return controller.queue.Len() == 1, nil
+	}); err != nil {
+		t.Fatalf("expected the deleted node to be queued: %v", err)
+	}
+
+	processNextKey(ctx, controller.queue, controller.syncKey)
+	if controller.queue.NumRequeues(node.Name) != 1 {
+		t.Errorf("expcted %+v requeues got %+v", 1, controller.queue.NumRequeues(node.Name))
+	}
+
+	fakeInstance.fail = false
+	processNextKey(ctx, controller.queue, controller.syncKey)
+	if fakeInstance.records["149.28.225.110"] != "149.28.225.110.vultrusercontent.com" {
+		t.Errorf("expected IPv4 reverse DNS to be reset got %q", fakeInstance.records["149.28.225.110"])
+	}
+	if len(controller.deleted) != 0 {
+		t.Errorf("expected no pending cleanups got %+v", controller.deleted)
+	}
+}
@@ -2,22 +2,29 @@ package vultr
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
 	"time"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
-	"k8s.io/client-go/tools/clientcmd"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/klog/v2"
 )
 
 // SecretWatch is the main structure for the secret watcher
 type SecretWatch struct {
-	kubeClient kubernetes.Interface
-	ctx        context.Context
-	secrets    map[string][]SecretList
+	kubeClient    kubernetes.Interface
+	serviceLister corelisters.ServiceLister
+	ctx           context.Context
+
+	mu      sync.Mutex
+	secrets map[string][]SecretList
 }
 
 // SecretList is meant to be stored as a slice of type SecretList which stores the name of the secret and it's service
@@ -31,16 +38,39 @@ const (
 )
 
 // SecretWatcher is a global variable of type SecretWatch. We use a global variable so that the SecretWatcher can be accessed globally
-// The watcher is meant to be ran as a go routine and in the current CCM we would not be able to run and access it globally otherwise
-var SecretWatcher SecretWatch
-
-// SetupSecretWatcher initializes the watcher
-func SetupSecretWatcher(ctx context.Context) {
-	SecretWatcher = SecretWatch{ctx: ctx, secrets: make(map[string][]SecretList)}
+// The watcher is driven by the shared secret informer which is started when the cloud provider is initialized
+var SecretWatcher = &SecretWatch{ctx: context.Background(), secrets: make(map[string][]SecretList)}
+
+// SetupSecretWatcher wires the watcher to the shared kube client and registers it with the secret informer
+func SetupSecretWatcher(ctx context.Context, kubeClient kubernetes.Interface, informerFactory informers.SharedInformerFactory) error {
+	SecretWatcher.mu.Lock()
+	SecretWatcher.ctx = ctx
+	SecretWatcher.kubeClient = kubeClient
+	SecretWatcher.serviceLister = informerFactory.Core().V1().Services().Lister()
+	SecretWatcher.mu.Unlock()
+
+	_, err := informerFactory.Core().V1().Secrets().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			SecretWatcher.onSecretEvent(obj, "Added")
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldSecret, okOld := oldObj.(*v1.Secret)
+			newSecret, okNew := newObj.(*v1.Secret)
+			// periodic resyncs deliver the same object again, only react to actual changes
+			if okOld && okNew && oldSecret.ResourceVersion == newSecret.ResourceVersion {
+				return
+			}
+			SecretWatcher.onSecretEvent(newObj, "Modified")
+		},
+	})
+	return err
 }
 
 // AddService adds a service to watch the corresponding secret for to the secretwatcher
 func (s *SecretWatch) AddService(svc *v1.Service, secretName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	// [namespace] -> ["secret-name/service-name"]
 	// Example [nginx] -> ["prod-tls-cert/nginx-frontend"]
 	if _, ok := s.secrets[svc.Namespace]; ok {
@@ -56,88 +86,58 @@ func (s *SecretWatch) AddService(svc *v1.Service, secretName string) {
 	klog.Infof("added secret %s to watcher", secretName)
 }
 
-// WatchSecrets is the main entrance into the execution of the secretwatcher
-func (s *SecretWatch) WatchSecrets() {
-	if err := s.getKubeClient(); err != nil {
-		klog.V(logLevel).Info(err)
+// onSecretEvent updates every service which references the secret
+func (s *SecretWatch) onSecretEvent(obj interface{}, eventType string) {
+	secret, ok := obj.(*v1.Secret)
+	if !ok {
 		return
 	}
 
-	watcher, err := s.kubeClient.CoreV1().Secrets("").Watch(s.ctx, metav1.ListOptions{Watch: true})
-	if err != nil {
-		klog.V(logLevel).Info(err)
-		return
+	s.mu.Lock()
+	var services []string
+	for _, sec := range s.secrets[secret.Namespace] {
+		if sec.Name == secret.Name {
+			services = append(services, sec.Service)
+		}
 	}
+	s.mu.Unlock()
 
-	for event := range watcher.ResultChan() {
-		secret := event.Object.(*v1.Secret)
-
-		switch event.Type {
-		case watch.Modified:
-			fallthrough //nolint
-		case watch.Added:
-			if _, ok := s.secrets[secret.Namespace]; ok {
-				for _, sec := range s.secrets[secret.Namespace] {
-					if sec.Name == secret.Name {
-						klog.V(logLevel).Infof("secret %s had a %s event", secret.Name, event.Type)
-						s.updateServiceFromSecret(sec.Service, secret.Namespace)
-					}
-				}
-			}
-		default:
-			continue
-		}
+	for _, svcName := range services {
+		klog.V(logLevel).Infof("secret %s had a %s event", secret.Name, eventType)
+		s.updateServiceFromSecret(svcName, secret.Namespace)
 	}
 }
 
 func (s *SecretWatch) updateServiceFromSecret(svcName, namespace string) {
-	if err := s.getKubeClient(); err != nil {
-		klog.V(logLevel).Info(err)
-	}
-
-	svc, err := s.kubeClient.CoreV1().Services(namespace).Get(s.ctx, svcName, metav1.GetOptions{})
-	if err != nil {
-		klog.V(logLevel).Info(err)
+	if s.kubeClient == nil || s.serviceLister == nil {
+		klog.V(logLevel).Info("secret watcher is not initialized")
+		return
 	}
 
-	svc.Annotations[annoVultrLBSSLLastUpdatedTime] = time.Now().String()
-
-	_, err = s.kubeClient.CoreV1().Services(namespace).Update(s.ctx, svc, metav1.UpdateOptions{})
-	if err != nil {
+	if _, err := s.serviceLister.Services(namespace).Get(svcName); err != nil {
 		klog.V(logLevel).Info(err)
+		return
 	}
 
-	klog.V(logLevel).Infof("service %s in namespace %s has been updated", svcName, namespace)
-}
-
-func (s *SecretWatch) getKubeClient() error {
-	if s.kubeClient != nil {
-		return nil
-	}
-
-	var (
-		kubeConfig *rest.Config
-		err        error
-		config     string
-	)
-
-	// If no kubeconfig was passed in or set then we want to default to an empty string
-	// This will have `clientcmd.BuildConfigFromFlags` default to `restclient.InClusterConfig()` which was existing behavior
-	if Options.KubeconfigFlag == nil || Options.KubeconfigFlag.Value.String() == "" {
-		config = ""
-	} else {
-		config = Options.KubeconfigFlag.Value.String()
+	patchData := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				annoVultrLBSSLLastUpdatedTime: time.Now().String(),
+			},
+		},
 	}
 
-	kubeConfig, err = clientcmd.BuildConfigFromFlags("", config)
+	patchBytes, err := json.Marshal(patchData)
 	if err != nil {
-		return err
+		klog.V(logLevel).Info(fmt.Errorf("failed to marshal patch: %w", err))
+		return
 	}
 
-	s.kubeClient, err = kubernetes.NewForConfig(kubeConfig)
+	_, err = s.kubeClient.CoreV1().Services(namespace).Patch(s.ctx, svcName, types.StrategicMergePatchType, patchBytes, metav1.PatchOptions{})
 	if err != nil {
-		return err
+		klog.V(logLevel).Info(err)
+		return
 	}
 
-	return nil
+	klog.V(logLevel).Infof("service %s in namespace %s has been updated", svcName, namespace)
 }
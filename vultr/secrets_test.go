@@ -0,0 +1,62 @@
+package vultr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSecretWatch_UpdatesServiceOnSecretChange(t *testing.T) {
+	svc := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "lb-name",
+			Namespace: v1.NamespaceDefault,
+		},
+	}
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "lb-tls",
+			Namespace:       v1.NamespaceDefault,
+			ResourceVersion: "1",
+		},
+	}
+
+	kubeClient := fake.NewClientset(svc, secret)
+	informerFactory := informers.NewSharedInformerFactory(kubeClient, 0)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	if err := SetupSecretWatcher(context.Background(), kubeClient, informerFactory); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	informerFactory.Start(stop)
+	informerFactory.WaitForCacheSync(stop)
+
+	SecretWatcher.AddService(svc, secret.Name)
+
+	updated := secret.DeepCopy()
+	updated.ResourceVersion = "2"
+	updated.Data = map[string][]byte{v1.TLSCertKey: []byte("cert")}
+	if _, err := kubeClient.CoreV1().Secrets(v1.NamespaceDefault).Update(context.Background(), updated, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 5*time.Second, true, func(ctx context.Context) (bool, error) {
+		current, err := kubeClient.CoreV1().Services(v1.NamespaceDefault).Get(ctx, svc.Name, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		_, ok := current.Annotations[annoVultrLBSSLLastUpdatedTime]
+		return ok, nil
+	})
+	if err != nil {
+		t.Errorf("expected %s annotation to be set on service: %v", annoVultrLBSSLLastUpdatedTime, err)
+	}
+}
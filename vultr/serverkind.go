@@ -0,0 +1,154 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/vultr/govultr/v3"
+	v1 "k8s.io/api/core/v1"
+	cloudprovider "k8s.io/cloud-provider"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// bareMetalLabel is set to "true" on nodes backed by a bare metal server and "false" on nodes backed by an instance
+	bareMetalLabel = "vultr.com/baremetal"
+
+	// bareMetalProviderIDPrefix marks the ID of a bare metal server in a providerID, vultr://bm/<id>
+	bareMetalProviderIDPrefix = "bm/"
+)
+
+// serverKind is the kind of Vultr server backing a node
+type serverKind int
+
+const (
+	serverKindUnknown serverKind = iota
+	serverKindInstance
+	serverKindBareMetal
+)
+
+// serverKindCache remembers whether an ID belongs to an instance or a bare metal server. IDs are removed once
+// their server is not found, so the cache only holds servers which exist.
+type serverKindCache struct {
+	mu    sync.RWMutex
+	kinds map[string]serverKind
+}
+
+func newServerKindCache() *serverKindCache {
+	return &serverKindCache{kinds: make(map[string]serverKind)}
+}
+
+func (c *serverKindCache) get(id string) serverKind {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.kinds[id]
+}
+
+func (c *serverKindCache) set(id string, kind serverKind) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.kinds[id] = kind
+}
+
+func (c *serverKindCache) forget(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.kinds, id)
+}
+
+// forgetKind removes the kind of the server backing the node from the cache
+func (i *instancesv2) forgetKind(node *v1.Node) {
+	if node.Spec.ProviderID == "" {
+		return
+	}
+	if id, err := vultrIDFromProviderID(node.Spec.ProviderID); err == nil {
+		i.kinds.forget(id)
+	}
+}
+
+// vultrServer is the server backing a node, exactly one of instance and bareMetal is set
+type vultrServer struct {
+	instance  *govultr.Instance
+	bareMetal *govultr.BareMetalServer
+}
+
+// isBareMetalProviderID returns whether the providerID is in the bare metal form vultr://bm/<id>
+func isBareMetalProviderID(providerID string) bool {
+	return strings.HasPrefix(providerID, ProviderName+"://"+bareMetalProviderIDPrefix)
+}
+
+// isServerNotFound returns whether a lookup failed because the server does not exist
+func isServerNotFound(err error) bool {
+	return errors.Is(err, cloudprovider.InstanceNotFound) || isAPINotFound(err)
+}
+
+// nodeKind returns the kind of server backing the node if it is known from the node label,
+// the providerID or an earlier lookup
+func (i *instancesv2) nodeKind(node *v1.Node) serverKind {
+	switch {
+	case node.Labels[bareMetalLabel] == "true" || isBareMetalProviderID(node.Spec.ProviderID):
+		return serverKindBareMetal
+	case node.Labels[bareMetalLabel] == "false":
+		return serverKindInstance
+	case node.Spec.ProviderID == "":
+		return serverKindUnknown
+	}
+
+	id, err := vultrIDFromProviderID(node.Spec.ProviderID)
+	if err != nil {
+		return serverKindUnknown
+	}
+	return i.kinds.get(id)
+}
+
+// getVultrServer returns the server backing the node. Nodes of an unknown kind are looked up as an
+// instance first and as a bare metal server if there is no such instance, the kind found is cached by ID
+// until the server is not found.
+func (i *instancesv2) getVultrServer(ctx context.Context, node *v1.Node) (*vultrServer, error) {
+	switch i.nodeKind(node) {
+	case serverKindBareMetal:
+		bm, err := i.getVultrBareMetal(ctx, node)
+		if err != nil {
+			if isServerNotFound(err) {
+				i.forgetKind(node)
+			}
+			return nil, err
+		}
+		return &vultrServer{bareMetal: bm}, nil
+	case serverKindInstance:
+		instance, err := i.getVultrInstance(ctx, node)
+		if err != nil {
+			if isServerNotFound(err) {
+				i.forgetKind(node)
+			}
+			return nil, err
+		}
+		return &vultrServer{instance: instance}, nil
+	}
+
+	instance, err := i.getVultrInstance(ctx, node)
+	if err == nil {
+		i.kinds.set(instance.ID, serverKindInstance)
+		return &vultrServer{instance: instance}, nil
+	}
+	if !isServerNotFound(err) {
+		return nil, err
+	}
+
+	bm, bmErr := i.getVultrBareMetal(ctx, node)
+	if bmErr != nil {
+		if isServerNotFound(bmErr) {
+			return nil, err
+		}
+		return nil, bmErr
+	}
+
+	klog.V(logLevelDebug).Infof("node %s is backed by bare metal server %s", node.Name, bm.ID)
+	i.kinds.set(bm.ID, serverKindBareMetal)
+	return &vultrServer{bareMetal: bm}, nil
+}
@@ -0,0 +1,127 @@
+package vultr
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/vultr/govultr/v3"
+	"golang.org/x/oauth2"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// apiKeyFileSyncPeriod is how often the API key file is checked for a new key
+	apiKeyFileSyncPeriod = 30 * time.Second
+)
+
+var _ oauth2.TokenSource = &fileTokenSource{}
+
+// apiKey is a Vultr API key and the time it was loaded
+type apiKey struct {
+	token    string
+	loadedAt time.Time
+}
+
+// fileTokenSource serves the Vultr API key stored in a file, typically a mounted Secret.
+// A new key written to the file is validated against the API before it replaces the current key.
+type fileTokenSource struct {
+	path     string
+	validate func(ctx context.Context, token string) error
+
+	key atomic.Pointer[apiKey]
+}
+
+// newFileTokenSource reads the initial API key from path. The validate func is called with every
+// new key found in the file and the key is only used once it returns nil.
+func newFileTokenSource(path string, validate func(ctx context.Context, token string) error) (*fileTokenSource, error) {
+	f := &fileTokenSource{
+		path:     path,
+		validate: validate,
+	}
+
+	token, err := f.readToken()
+	if err != nil {
+		return nil, err
+	}
+
+	f.key.Store(&apiKey{token: token, loadedAt: time.Now()})
+	return f, nil
+}
+
+// Token returns the current API key as a bearer token
+func (f *fileTokenSource) Token() (*oauth2.Token, error) {
+	return &oauth2.Token{AccessToken: f.key.Load().token}, nil
+}
+
+// KeyAge returns how long the current API key has been in use
+func (f *fileTokenSource) KeyAge() time.Duration {
+	return time.Since(f.key.Load().loadedAt)
+}
+
+// Run checks the file for a new API key until the context is done
+func (f *fileTokenSource) Run(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := f.reload(ctx); err != nil {
+			klog.Errorf("failed to reload API key from %s: %v", f.path, err)
+		}
+	}, apiKeyFileSyncPeriod)
+}
+
+// reload swaps in the key stored in the file if it changed and passes validation
+func (f *fileTokenSource) reload(ctx context.Context) error {
+	token, err := f.readToken()
+	if err != nil {
+		return err
+	}
+
+	current := f.key.Load()
+	if token == current.token {
+		return nil
+	}
+
+	if err := f.validate(ctx, token); err != nil {
+		return fmt.Errorf("new API key failed validation, continuing to use the current key: %w", err)
+	}
+
+	age := f.KeyAge()
+	f.key.Store(&apiKey{token: token, loadedAt: time.Now()})
+	klog.Infof("switched to new API key from %s, previous key was in use for %s", f.path, age.Round(time.Second))
+	return nil
+}
+
+func (f *fileTokenSource) readToken() (string, error) {
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read API key file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("API key file %s is empty", f.path)
+	}
+
+	return token, nil
+}
+
+// newAPIKeyValidator returns a func which checks an API key by requesting the account it belongs to
+func newAPIKeyValidator(baseURL string, timeout time.Duration) func(ctx context.Context, token string) error {
+	return func(ctx context.Context, token string) error {
+		httpClient := oauth2.NewClient(ctx, oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token}))
+		httpClient.Timeout = timeout
+
+		client := govultr.NewClient(httpClient)
+		if baseURL != "" {
+			if err := client.SetBaseURL(baseURL); err != nil {
+				return err
+			}
+		}
+
+		_, _, err := client.Account.Get(ctx) //nolint:bodyclose
+		return err
+	}
+}
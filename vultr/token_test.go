@@ -0,0 +1,71 @@
+package vultr
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileTokenSource_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api-key")
+	if err := os.WriteFile(path, []byte("initial-key\n"), 0o600); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	validate := func(_ context.Context, token string) error {
+		if token == "invalid-key" {
+			return errors.New(`{"error":"Invalid API token.","status":401}`)
+		}
+		return nil
+	}
+
+	src, err := newFileTokenSource(path, validate)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		contents  string
+		expected  string
+		expectErr bool
+	}{
+		{name: "unchanged key", contents: "initial-key\n", expected: "initial-key"},
+		{name: "invalid key is not used", contents: "invalid-key", expected: "initial-key", expectErr: true},
+		{name: "empty file is not used", contents: "", expected: "initial-key", expectErr: true},
+		{name: "valid key is swapped in", contents: "rotated-key\n", expected: "rotated-key"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := os.WriteFile(path, []byte(test.contents), 0o600); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			err := src.reload(context.Background())
+			if test.expectErr && err == nil {
+				t.Error("expected error got nil")
+			}
+			if !test.expectErr && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			token, err := src.Token()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if token.AccessToken != test.expected {
+				t.Errorf("expcted %+v got %+v", test.expected, token.AccessToken)
+			}
+		})
+	}
+}
+
+func TestFileTokenSource_MissingFile(t *testing.T) {
+	_, err := newFileTokenSource(filepath.Join(t.TempDir(), "missing"), func(context.Context, string) error { return nil })
+	if err == nil {
+		t.Error("expected error for missing API key file got nil")
+	}
+}
@@ -0,0 +1,213 @@
+package vultr
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"k8s.io/client-go/util/flowcontrol"
+	"k8s.io/klog/v2"
+)
+
+var _ http.RoundTripper = &retryTransport{}
+
+// retryTransport rate limits every request to the Vultr API and retries idempotent requests
+// which failed with a network error, a 429 or a 5xx using jittered exponential backoff.
+// Every attempt is bounded by its own timeout so a hanging attempt still leaves time for the retries.
+type retryTransport struct {
+	base        http.RoundTripper
+	rateLimiter flowcontrol.RateLimiter
+
+	maxRetries     int
+	baseDelay      time.Duration
+	maxDelay       time.Duration
+	attemptTimeout time.Duration
+
+	// retries is the number of retries done since start up
+	retries atomic.Uint64
+}
+
+// newRetryTransport returns a retry transport, attempts are not bounded by a timeout if attemptTimeout is 0
+func newRetryTransport(base http.RoundTripper, rateLimit RateLimitConfig, retry RetryConfig, attemptTimeout time.Duration) *retryTransport {
+	maxRetries := defaultMaxRetries
+	if retry.MaxRetries != nil {
+		maxRetries = *retry.MaxRetries
+	}
+
+	return &retryTransport{
+		base:           base,
+		rateLimiter:    flowcontrol.NewTokenBucketRateLimiter(rateLimit.QPS, rateLimit.Burst),
+		maxRetries:     maxRetries,
+		baseDelay:      retry.BaseDelay,
+		maxDelay:       retry.MaxDelay,
+		attemptTimeout: attemptTimeout,
+	}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	for attempt := 0; ; attempt++ {
+		if err := t.rateLimiter.Wait(ctx); err != nil {
+			return nil, fmt.Errorf("rate limiter: %w", err)
+		}
+
+		attemptReq, err := rewindRequest(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.roundTripAttempt(attemptReq)
+		if attempt >= t.maxRetries || !retryable(req, resp, err) {
+			return resp, err
+		}
+
+		delay, ok := t.backoff(attempt, resp)
+		if !ok {
+			return resp, err
+		}
+
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			drainBody(resp)
+		}
+
+		total := t.retries.Add(1)
+		apiRetriesTotal.WithLabelValues(apiOperation(req)).Inc()
+		klog.Warningf("retrying %s %s in %s (retry %d/%d, %d retries total): %s",
+			req.Method, req.URL.Path, delay.Round(time.Millisecond), attempt+1, t.maxRetries, total, reason)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// roundTripAttempt sends a single attempt bounded by the attempt timeout. The timeout also covers reading the
+// response body, its context is released when the body is closed.
+func (t *retryTransport) roundTripAttempt(req *http.Request) (*http.Response, error) {
+	if t.attemptTimeout <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.attemptTimeout)
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelOnCloseBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelOnCloseBody releases the context of an attempt once its response body is closed
+type cancelOnCloseBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnCloseBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// retryable returns whether a failed attempt may be sent again. Only idempotent requests whose
+// body can be replayed are retried.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if !isIdempotent(req.Method) {
+		return false
+	}
+
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+
+	if err != nil {
+		// a cancelled or expired request context is not worth another attempt
+		return req.Context().Err() == nil
+	}
+
+	return resp.StatusCode == http.StatusTooManyRequests ||
+		(resp.StatusCode >= http.StatusInternalServerError && resp.StatusCode != http.StatusNotImplemented)
+}
+
+// backoff returns how long to wait before the next attempt. A Retry-After header sent by the API is
+// honored, if it asks for a longer wait than the max delay no retry is done.
+func (t *retryTransport) backoff(attempt int, resp *http.Response) (time.Duration, bool) {
+	if resp != nil {
+		if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			return retryAfter, retryAfter <= t.maxDelay
+		}
+	}
+
+	delay := t.baseDelay << attempt
+	if delay <= 0 || delay > t.maxDelay {
+		delay = t.maxDelay
+	}
+
+	// jitter between half and the whole delay so clients don't retry in lockstep
+	half := delay / 2                  //nolint:mnd
+	return half + rand.N(half+1), true //nolint:gosec
+}
+
+// isIdempotent returns whether the method can safely be sent more than once
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// rewindRequest returns the request to send for an attempt, replaying the body on retries
+func rewindRequest(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.GetBody == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind request body: %w", err)
+	}
+
+	retryReq := req.Clone(req.Context())
+	retryReq.Body = body
+	return retryReq, nil
+}
+
+// parseRetryAfter parses a Retry-After header in either delay-seconds or HTTP-date form
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+
+	return 0, false
+}
+
+// drainBody reads and closes the body so the connection can be reused
+func drainBody(resp *http.Response) {
+	_, _ = io.Copy(io.Discard, resp.Body)
+	_ = resp.Body.Close()
+}
@@ -0,0 +1,125 @@
+package vultr
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vultr/govultr/v3"
+)
+
+func TestRetryTransport(t *testing.T) {
+	tests := []struct {
+		name             string
+		method           string
+		body             string
+		statuses         []int
+		retryAfter       string
+		expectedStatus   int
+		expectedAttempts int32
+	}{
+		{name: "get retried on 5xx", method: http.MethodGet, statuses: []int{503, 502, 200}, expectedStatus: 200, expectedAttempts: 3},
+		{name: "get gives up after max retries", method: http.MethodGet, statuses: []int{500, 500, 500, 500, 500}, expectedStatus: 500, expectedAttempts: 4},
+		{name: "get retried on 429 with retry-after", method: http.MethodGet, statuses: []int{429, 200}, retryAfter: "0", expectedStatus: 200, expectedAttempts: 2},
+		{name: "retry-after longer than max delay is not retried", method: http.MethodGet, statuses: []int{429, 200}, retryAfter: "120", expectedStatus: 429, expectedAttempts: 1},
+		{name: "put body is replayed", method: http.MethodPut, body: `{"label":"ccm-test"}`, statuses: []int{503, 200}, expectedStatus: 200, expectedAttempts: 2},
+		{name: "post is not retried", method: http.MethodPost, body: `{"label":"ccm-test"}`, statuses: []int{503, 200}, expectedStatus: 503, expectedAttempts: 1},
+		{name: "patch is not retried", method: http.MethodPatch, body: `{"label":"ccm-test"}`, statuses: []int{503, 200}, expectedStatus: 503, expectedAttempts: 1},
+		{name: "client errors are not retried", method: http.MethodGet, statuses: []int{404, 200}, expectedStatus: 404, expectedAttempts: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := attempts.Add(1)
+
+				body, _ := io.ReadAll(r.Body)
+				if string(body) != test.body {
+					t.Errorf("expcted %+v got %+v", test.body, string(body))
+				}
+
+				if test.retryAfter != "" {
+					w.Header().Set("Retry-After", test.retryAfter)
+				}
+				w.WriteHeader(test.statuses[attempt-1])
+			}))
+			defer server.Close()
+
+			client := &http.Client{Transport: newRetryTransport(http.DefaultTransport,
+				RateLimitConfig{QPS: 1000, Burst: 100},
+				RetryConfig{MaxRetries: govultr.IntToIntPtr(3), BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}, 0)}
+
+			req, err := http.NewRequest(test.method, server.URL, strings.NewReader(test.body))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != test.expectedStatus {
+				t.Errorf("expcted %+v got %+v", test.expectedStatus, resp.StatusCode)
+			}
+			if attempts.Load() != test.expectedAttempts {
+				t.Errorf("expcted %+v attempts got %+v", test.expectedAttempts, attempts.Load())
+			}
+		})
+	}
+}
+
+func TestRetryTransport_AttemptTimeout(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the first attempt hangs until it is abandoned
+		if attempts.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		_, _ = w.Write([]byte(`{"account":{}}`))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newRetryTransport(http.DefaultTransport,
+		RateLimitConfig{QPS: 1000, Burst: 100},
+		RetryConfig{MaxRetries: govultr.IntToIntPtr(1), BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}, 50*time.Millisecond)}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatalf("unexpected error reading the body: %v", err)
+	}
+
+	if string(body) != `{"account":{}}` {
+		t.Errorf("expcted %+v got %+v", `{"account":{}}`, string(body))
+	}
+	if attempts.Load() != 2 {
+		t.Errorf("expected the timed out attempt to be retried got %d attempts", attempts.Load())
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if delay, ok := parseRetryAfter("3"); !ok || delay != 3*time.Second {
+		t.Errorf("expcted %+v got %+v", 3*time.Second, delay)
+	}
+
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if delay, ok := parseRetryAfter(date); !ok || delay <= 59*time.Minute {
+		t.Errorf("expected delay of about an hour got %+v", delay)
+	}
+
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Error("expected invalid Retry-After to be ignored")
+	}
+}
@@ -0,0 +1,51 @@
+package vultr
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+)
+
+// newKeyQueue returns a queue of object keys which retries failed keys with exponential backoff
+func newKeyQueue(name string) workqueue.TypedRateLimitingInterface[string] {
+	return workqueue.NewTypedRateLimitingQueueWithConfig(
+		workqueue.DefaultTypedControllerRateLimiter[string](),
+		workqueue.TypedRateLimitingQueueConfig[string]{Name: name},
+	)
+}
+
+// runKeyWorkers syncs the keys of the queue with the given number of workers until the context is done, then
+// shuts the queue down. Keys whose sync fails are queued again with backoff.
+func runKeyWorkers(ctx context.Context, queue workqueue.TypedRateLimitingInterface[string], workers int, sync func(ctx context.Context, key string) error) {
+	defer queue.ShutDown()
+
+	for range workers {
+		go wait.UntilWithContext(ctx, func(ctx context.Context) {
+			for processNextKey(ctx, queue, sync) {
+			}
+		}, time.Second)
+	}
+
+	<-ctx.Done()
+}
+
+// processNextKey syncs the next key of the queue, it returns false once the queue is shut down
+func processNextKey(ctx context.Context, queue workqueue.TypedRateLimitingInterface[string], sync func(ctx context.Context, key string) error) bool {
+	key, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	defer queue.Done(key)
+
+	if err := sync(ctx, key); err != nil {
+		klog.Errorf("failed to sync %s, retrying: %v", key, err)
+		queue.AddRateLimited(key)
+		return true
+	}
+
+	queue.Forget(key)
+	return true
+}
@@ -3,8 +3,10 @@ package vultr
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
 
-	"github.com/vultr/govultr/v3"
 	"k8s.io/apimachinery/pkg/types"
 	cloudprovider "k8s.io/cloud-provider"
 )
@@ -12,36 +14,61 @@ import (
 var _ cloudprovider.Zones = &zones{}
 
 type zones struct {
-	client *govultr.Client
-	region string
+	inventory *inventory
+	region    string
 }
 
-func newZones(client *govultr.Client, zone string) cloudprovider.Zones {
-	return zones{client, zone}
+func newZones(inv *inventory, zone string) cloudprovider.Zones {
+	return zones{inv, zone}
+}
+
+// zoneForRegion returns the zone for the given region. Vultr regions are a single
+// failure domain so the zone and region share the same value.
+func zoneForRegion(region string) cloudprovider.Zone {
+	region = strings.ToLower(region)
+	return cloudprovider.Zone{FailureDomain: region, Region: region}
 }
 
 func (z zones) GetZone(_ context.Context) (cloudprovider.Zone, error) {
-	return cloudprovider.Zone{Region: z.region}, nil
+	return zoneForRegion(z.region), nil
 }
 
 func (z zones) GetZoneByProviderID(ctx context.Context, providerID string) (cloudprovider.Zone, error) {
 	id, err := vultrIDFromProviderID(providerID)
-	if err != nil {
-		return cloudprovider.Zone{}, nil
-	}
-	vultr, err := vultrByInstanceID(ctx, z.client, id)
 	if err != nil {
 		return cloudprovider.Zone{}, err
 	}
 
-	return cloudprovider.Zone{Region: vultr.Region}, nil
+	instance, instanceErr := z.inventory.instanceByID(ctx, id)
+	if instanceErr == nil {
+		return zoneForRegion(instance.Region), nil
+	}
+	// only a server which is not an instance can be a bare metal server, other errors say nothing about it
+	if !isAPINotFound(instanceErr) {
+		return cloudprovider.Zone{}, instanceErr
+	}
+
+	bm, bmErr := z.inventory.bareMetalByID(ctx, id)
+	if bmErr == nil {
+		return zoneForRegion(bm.Region), nil
+	}
+
+	return cloudprovider.Zone{}, fmt.Errorf("could not find instance or baremetal %q: instance: %v, baremetal: %v", id, instanceErr, bmErr)
 }
 
 func (z zones) GetZoneByNodeName(ctx context.Context, nodeName types.NodeName) (cloudprovider.Zone, error) {
-	vultr, err := vultrByInstanceName(ctx, z.client, nodeName)
+	instance, err := z.inventory.instanceByName(ctx, nodeName)
+	if err == nil {
+		return zoneForRegion(instance.Region), nil
+	}
+	if !errors.Is(err, cloudprovider.InstanceNotFound) {
+		return cloudprovider.Zone{}, err
+	}
+
+	bm, err := z.inventory.bareMetalByName(ctx, nodeName)
 	if err != nil {
-		return cloudprovider.Zone{}, nil
+		return cloudprovider.Zone{}, err
 	}
 
-	return cloudprovider.Zone{Region: vultr.Region}, nil
+	return zoneForRegion(bm.Region), nil
 }
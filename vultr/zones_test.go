@@ -2,17 +2,36 @@ package vultr
 
 import (
 	"context"
+	"errors"
+	"net/http"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/vultr/govultr/v3"
 	cloudprovider "k8s.io/cloud-provider"
 )
 
+func TestZones_GetZone(t *testing.T) {
+	client := newFakeClient()
+	zone := newZones(newInventory(client, CacheConfig{}), "ewr")
+
+	expected := cloudprovider.Zone{FailureDomain: "ewr", Region: "ewr"}
+	actual, err := zone.GetZone(context.TODO())
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expcted %+v got %+v", expected, actual)
+	}
+}
+
 func TestZones_GetZoneByNodeName(t *testing.T) {
 	client := newFakeClient()
-	zone := newZones(client, "ewr")
+	zone := newZones(newInventory(client, CacheConfig{}), "ewr")
 
-	expected := cloudprovider.Zone{Region: "ewr"}
+	expected := cloudprovider.Zone{FailureDomain: "ewr", Region: "ewr"}
 	actual, err := zone.GetZoneByNodeName(context.TODO(), "ccm-test")
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
@@ -23,11 +42,26 @@ func TestZones_GetZoneByNodeName(t *testing.T) {
 	}
 }
 
+func TestZones_GetZoneByNodeName_BareMetal(t *testing.T) {
+	client := newFakeClient()
+	zone := newZones(newInventory(client, CacheConfig{}), "ewr")
+
+	expected := cloudprovider.Zone{FailureDomain: "sjc", Region: "sjc"}
+	actual, err := zone.GetZoneByNodeName(context.TODO(), "ccm-test-bm")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expcted %+v got %+v", expected, actual)
+	}
+}
+
 func TestZones_GetZoneByProviderID(t *testing.T) {
 	client := newFakeClient()
-	zone := newZones(client, "ewr")
+	zone := newZones(newInventory(client, CacheConfig{}), "ewr")
 
-	expected := cloudprovider.Zone{Region: "ewr"}
+	expected := cloudprovider.Zone{FailureDomain: "ewr", Region: "ewr"}
 
 	actual, err := zone.GetZoneByProviderID(context.Background(), "vultr://576965")
 	if err != nil {
@@ -38,3 +72,53 @@ func TestZones_GetZoneByProviderID(t *testing.T) {
 		t.Errorf("expcted %+v got %+v", expected, actual)
 	}
 }
+
+func TestZones_GetZoneByProviderID_BareMetal(t *testing.T) {
+	client := &govultr.Client{
+		Instance:        &fakeMissingInstance{},
+		BareMetalServer: &fakeBareMetalServer{},
+	}
+	zone := newZones(newInventory(client, CacheConfig{}), "ewr")
+
+	expected := cloudprovider.Zone{FailureDomain: "sjc", Region: "sjc"}
+
+	actual, err := zone.GetZoneByProviderID(context.Background(), "vultr://cb676a46-66fd-4dfb-b839-443f2e6c0b60")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expcted %+v got %+v", expected, actual)
+	}
+}
+
+// fakeFailingInstance fails every lookup with a server error
+type fakeFailingInstance struct {
+	FakeInstance
+}
+
+func (f *fakeFailingInstance) Get(_ context.Context, _ string) (*govultr.Instance, *http.Response, error) {
+	return nil, nil, errors.New(`{"error":"internal error","status":500}`)
+}
+
+func TestZones_GetZoneByProviderID_InstanceError(t *testing.T) {
+	client := &govultr.Client{
+		Instance:        &fakeFailingInstance{},
+		BareMetalServer: &fakeBareMetalServer{},
+	}
+	zone := newZones(newInventory(client, CacheConfig{}), "ewr")
+
+	_, err := zone.GetZoneByProviderID(context.Background(), "vultr://cb676a46-66fd-4dfb-b839-443f2e6c0b60")
+	if err == nil || !strings.Contains(err.Error(), "internal error") {
+		t.Errorf("expected the instance error to be returned got %v", err)
+	}
+}
+
+func TestZones_GetZoneByProviderID_InvalidProviderID(t *testing.T) {
+	client := newFakeClient()
+	zone := newZones(newInventory(client, CacheConfig{}), "ewr")
+
+	if _, err := zone.GetZoneByProviderID(context.Background(), "aws://576965"); err == nil {
+		t.Error("expected error for invalid providerID got nil")
+	}
+}